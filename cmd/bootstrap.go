@@ -1,15 +1,25 @@
 package cmd
 
 import (
+	"database/sql"
 	"fmt"
 	"io"
+	"os"
+	"time"
 
 	"github.com/stormingluke/autoenv/internal/adapter/config"
 	"github.com/stormingluke/autoenv/internal/adapter/envfile"
+	"github.com/stormingluke/autoenv/internal/adapter/fsscan"
+	"github.com/stormingluke/autoenv/internal/adapter/git"
 	"github.com/stormingluke/autoenv/internal/adapter/github"
+	"github.com/stormingluke/autoenv/internal/adapter/gitlab"
 	"github.com/stormingluke/autoenv/internal/adapter/shell"
+	"github.com/stormingluke/autoenv/internal/adapter/source"
 	"github.com/stormingluke/autoenv/internal/adapter/sqlite"
+	"github.com/stormingluke/autoenv/internal/adapter/vault"
 	"github.com/stormingluke/autoenv/internal/app"
+	"github.com/stormingluke/autoenv/internal/domain"
+	"github.com/stormingluke/autoenv/internal/port"
 )
 
 type closers []io.Closer
@@ -22,46 +32,129 @@ func (c closers) CloseAll() {
 }
 
 type bootstrapResult struct {
-	app   *app.App
-	turso *sqlite.TursoDB
-	cc    closers
+	app      *app.App
+	turso    *sqlite.TursoDB
+	outbox   *sqlite.Outbox
+	projects *sqlite.ProjectRepo
+	defaults *sqlite.DefaultsRepo
+	cc       closers
 }
 
+// bootstrap opens everything a full command needs and, when sync.interval
+// is set, pulls the registry from Turso if the last sync is too old.
 func bootstrap() (*bootstrapResult, error) {
+	b, err := bootstrapNoAutoSync()
+	if err != nil {
+		return nil, err
+	}
+	if b.turso.Replicated() {
+		if _, err := b.app.DBSync.SyncIfDue(time.Now()); err != nil {
+			fmt.Fprintf(os.Stderr, "autoenv: automatic sync failed: %v\n", err)
+		}
+	}
+	return b, nil
+}
+
+func bootstrapNoAutoSync() (*bootstrapResult, error) {
 	var cc closers
 
 	cfg := config.Load()
 	if err := cfg.EnsureDir(); err != nil {
 		return nil, fmt.Errorf("ensure config dir: %w", err)
 	}
+	key, err := cfg.EncryptionKey()
+	if err != nil {
+		return nil, err
+	}
 
-	turso, err := sqlite.OpenTurso(cfg.ProjectsDBPath, cfg.TursoURL, cfg.TursoAuthToken)
+	turso, err := sqlite.OpenTurso(cfg.ProjectsDBPath, cfg.TursoURL, cfg.TursoAuthToken, key)
 	if err != nil {
 		return nil, fmt.Errorf("open projects db: %w", err)
 	}
 	cc.Add(turso)
 
-	sessDB, sessCloser, err := sqlite.OpenSessionsDB(cfg.SessionsDBPath)
+	sessDB, state, err := openLocalDBs(cfg, key, &cc)
 	if err != nil {
 		cc.CloseAll()
-		return nil, fmt.Errorf("open sessions db: %w", err)
+		return nil, err
+	}
+	stateDB, err := state.DB()
+	if err != nil {
+		cc.CloseAll()
+		return nil, fmt.Errorf("open state db: %w", err)
 	}
-	cc.Add(sessCloser)
 
-	projectRepo := sqlite.NewProjectRepo(turso.DB)
-	sessionRepo := sqlite.NewSessionRepo(sessDB)
 	defaultsRepo := sqlite.NewDefaultsRepo(turso.DB)
+	projectRepo, err := newProjectRepo(cfg, turso.DB, defaultsRepo)
+	if err != nil {
+		cc.CloseAll()
+		return nil, err
+	}
+	outbox := sqlite.NewOutbox(stateDB)
+	hasher, err := newHasher(cfg)
+	if err != nil {
+		cc.CloseAll()
+		return nil, err
+	}
+
+	var projects port.ProjectRepository = projectRepo
+	var defaults port.ConfigStore = defaultsRepo
+	if turso.Offline {
+		// Keep working from the last synced replica; writes wait in the
+		// outbox until the next `autoenv sync --db`.
+		fmt.Fprintf(os.Stderr, "autoenv: offline, using the local replica (%v)\n", turso.OfflineErr)
+		fmt.Fprintln(os.Stderr, "autoenv: changes are queued until the next `autoenv sync --db`")
+		projects = sqlite.NewQueuedProjectRepo(projectRepo, outbox)
+		defaults = sqlite.NewQueuedDefaultsRepo(defaultsRepo, outbox)
+	} else if err := sqlite.RunOnce(stateDB, "normalize-project-paths", projectRepo.Normalize); err != nil {
+		// Retried on the next command; a conflict must not lock the user
+		// out of the commands that resolve it.
+		fmt.Fprintf(os.Stderr, "autoenv: could not convert project paths to portable form: %v\n", err)
+	}
+	sessionRepo := sqlite.NewSessionRepo(sessDB)
+	usageRepo := sqlite.NewUsageRepo(state)
+
+	kv := vault.NewKVStore(vault.ResolveAddr(cfg.VaultAddr), vault.ResolveNamespace(cfg.VaultNamespace),
+		vault.ResolveAuth(cfg.VaultToken, cfg.VaultRoleID, cfg.VaultSecretID))
 
 	a := app.New(app.Deps{
-		Projects:  projectRepo,
-		Sessions:  sessionRepo,
-		EnvLoader: envfile.NewLoader(),
-		Shell:     shell.NewRenderer(),
-		Syncer:    github.NewSecretSyncer(),
-		Config:    defaultsRepo,
+		Projects:     projects,
+		Sessions:     sessionRepo,
+		Usage:        usageRepo,
+		EnvLoader:    envfile.NewLoader(),
+		EnvWriter:    envfile.NewWriter(),
+		Shell:        shell.NewRenderer(),
+		Syncer:       github.NewSecretSyncer(cfg.GitHubAPIURL, github.ResolveToken(cfg.GitHubAPIURL, cfg.GitHubToken)),
+		GitLabSyncer: gitlab.NewVariableSyncer(cfg.GitLabURL, gitlab.ResolveToken(cfg.GitLabURL, cfg.GitLabToken)),
+		Hosts:        domain.Hosts{GitHub: github.Host(cfg.GitHubAPIURL), GitLab: gitlab.Host(cfg.GitLabURL)},
+		VaultSyncer:  kv,
+		Sources: map[domain.Provider]port.SecretSource{
+			domain.ProviderVault: kv,
+			domain.ProviderFile:  source.NewFileSource(),
+			domain.ProviderExec:  source.NewExecSource(),
+		},
+		SyncLedger: sqlite.NewSyncLedgerRepo(stateDB),
+		Config:     defaults,
+		Repos:      git.NewInspector(),
+		Scanner:    fsscan.NewScanner(),
+		Hasher:     hasher,
+		DBSyncer:   turso,
+		SyncLog:    sqlite.NewSyncLogRepo(stateDB),
 	})
 
-	return &bootstrapResult{app: a, turso: turso, cc: cc}, nil
+	return &bootstrapResult{
+		app:      a,
+		turso:    turso,
+		outbox:   outbox,
+		projects: projectRepo,
+		defaults: defaultsRepo,
+		cc:       cc,
+	}, nil
+}
+
+// flushOutbox applies registry writes queued while offline.
+func (b *bootstrapResult) flushOutbox() (int, error) {
+	return sqlite.FlushOutbox(b.outbox, b.projects, b.defaults)
 }
 
 func bootstrapLight() (*app.App, closers, error) {
@@ -71,18 +164,132 @@ func bootstrapLight() (*app.App, closers, error) {
 	if err := cfg.EnsureDir(); err != nil {
 		return nil, nil, fmt.Errorf("ensure config dir: %w", err)
 	}
+	key, err := cfg.EncryptionKey()
+	if err != nil {
+		return nil, nil, err
+	}
 
-	sessDB, sessCloser, err := sqlite.OpenSessionsDB(cfg.SessionsDBPath)
+	sessDB, _, err := openLocalDBs(cfg, key, &cc)
 	if err != nil {
-		return nil, nil, fmt.Errorf("open sessions db: %w", err)
+		cc.CloseAll()
+		return nil, nil, err
 	}
-	cc.Add(sessCloser)
 
 	a := app.New(app.Deps{
 		Sessions:  sqlite.NewSessionRepo(sessDB),
 		Shell:     shell.NewRenderer(),
 		EnvLoader: envfile.NewLoader(),
+		EnvWriter: envfile.NewWriter(),
 	})
 
 	return a, cc, nil
 }
+
+// bootstrapExport is bootstrapLight plus a read-only view of the project
+// registry, which the export hook needs to honour autoload.mode. A missing
+// projects database simply means nothing has been configured yet.
+func bootstrapExport() (*app.App, closers, error) {
+	var cc closers
+
+	cfg := config.Load()
+	if err := cfg.EnsureDir(); err != nil {
+		return nil, nil, fmt.Errorf("ensure config dir: %w", err)
+	}
+	key, err := cfg.EncryptionKey()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sessDB, state, err := openLocalDBs(cfg, key, &cc)
+	if err != nil {
+		cc.CloseAll()
+		return nil, nil, err
+	}
+
+	hasher, err := newHasher(cfg)
+	if err != nil {
+		cc.CloseAll()
+		return nil, nil, err
+	}
+
+	deps := app.Deps{
+		Hasher:    hasher,
+		Sessions:  sqlite.NewSessionRepo(sessDB),
+		Usage:     sqlite.NewUsageRepo(state),
+		Shell:     shell.NewRenderer(),
+		EnvLoader: envfile.NewLoader(),
+	}
+
+	if _, err := os.Stat(cfg.ProjectsDBPath); err == nil {
+		projDB, projCloser, err := sqlite.OpenReadOnly(cfg.ProjectsDBPath, key)
+		if err != nil {
+			cc.CloseAll()
+			return nil, nil, fmt.Errorf("open projects db: %w", err)
+		}
+		cc.Add(projCloser)
+		defaultsRepo := sqlite.NewDefaultsRepo(projDB)
+		projectRepo, err := newProjectRepo(cfg, projDB, defaultsRepo)
+		if err != nil {
+			cc.CloseAll()
+			return nil, nil, err
+		}
+		deps.Config = defaultsRepo
+		// The hook cannot migrate a read-only database. Until the next full
+		// command upgrades an older schema, the registry is left out rather
+		// than queried for columns that do not exist yet.
+		if current, err := sqlite.ProjectsSchemaCurrent(projDB); err == nil && current {
+			deps.Projects = projectRepo
+		}
+	}
+
+	return app.New(deps), cc, nil
+}
+
+// openLocalDBs opens the runtime sessions database and, lazily, the
+// persistent state database, moving data over from the single sessions.db
+// older versions kept in the config directory.
+func openLocalDBs(cfg *config.Config, key string, cc *closers) (*sql.DB, *sqlite.LazyDB, error) {
+	state := sqlite.NewLazyDB(func() (*sql.DB, io.Closer, error) {
+		return sqlite.OpenStateDB(cfg.StateDBPath, key)
+	})
+	cc.Add(state)
+
+	sessDB, sessCloser, err := sqlite.OpenSessionsDB(cfg.SessionsDBPath, key, state)
+	if err != nil {
+		return nil, nil, fmt.Errorf("open sessions db: %w", err)
+	}
+	cc.Add(sessCloser)
+
+	if cfg.LegacySessionsDBPath != cfg.SessionsDBPath {
+		if err := sqlite.MigrateLegacySessions(cfg.LegacySessionsDBPath, key, sessDB, state); err != nil {
+			return nil, nil, fmt.Errorf("migrate %s: %w", cfg.LegacySessionsDBPath, err)
+		}
+	}
+	return sessDB, state, nil
+}
+
+func newHasher(cfg *config.Config) (*domain.Hasher, error) {
+	key, err := cfg.HashKey()
+	if err != nil {
+		return nil, err
+	}
+	return domain.NewHasher(key), nil
+}
+
+// newProjectRepo builds the registry for this machine: its device ID and
+// the path roots from paths.roots, resolved against the local environment.
+func newProjectRepo(cfg *config.Config, db *sql.DB, defaults port.ConfigStore) (*sqlite.ProjectRepo, error) {
+	deviceID, err := cfg.DeviceID()
+	if err != nil {
+		return nil, err
+	}
+
+	spec, err := defaults.Get(domain.PathRootsKey)
+	if err != nil {
+		spec = domain.DefaultPathRoots
+	}
+	home, _ := os.UserHomeDir()
+	roots := domain.ParsePathRoots(spec, os.Getenv, home)
+
+	return sqlite.NewProjectRepo(db, deviceID, roots), nil
+}
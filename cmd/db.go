@@ -0,0 +1,195 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/stormingluke/autoenv/internal/adapter/config"
+	"github.com/stormingluke/autoenv/internal/adapter/sqlite"
+)
+
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Manage the local databases",
+	Long: `Encrypt, decrypt or rekey projects.db, state.db and sessions.db in place.
+
+The key is read from AUTOENV_DB_PASSPHRASE if set, otherwise from the key
+file (AUTOENV_DB_KEY_FILE, default ~/.config/autoenv/db.key). Close other
+shells using autoenv before changing keys.
+
+Examples:
+  autoenv db encrypt                              # generate a random key file
+  AUTOENV_DB_PASSPHRASE=... autoenv db encrypt    # encrypt with a passphrase
+  autoenv db rekey
+  autoenv db decrypt`,
+}
+
+var dbEncryptCmd = &cobra.Command{
+	Use:   "encrypt",
+	Short: "Encrypt the local databases",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg := loadDBConfig()
+		if _, err := os.Stat(cfg.KeyFile); err == nil {
+			fmt.Fprintf(os.Stderr, "autoenv: databases are already encrypted with %s; use `autoenv db rekey`\n", cfg.KeyFile)
+			os.Exit(1)
+		}
+
+		if cfg.Passphrase != "" {
+			exitOnErr(rekeyDatabases(cfg, "", cfg.Passphrase))
+			fmt.Println("Databases encrypted with AUTOENV_DB_PASSPHRASE; keep it set for every autoenv invocation.")
+			return
+		}
+
+		key, err := config.NewKey()
+		exitOnErr(err)
+		exitOnErr(rekeyWithKeyFile(cfg, "", key))
+		fmt.Printf("Databases encrypted; key stored in %s.\n", cfg.KeyFile)
+	},
+}
+
+var dbDecryptCmd = &cobra.Command{
+	Use:   "decrypt",
+	Short: "Decrypt the local databases",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg := loadDBConfig()
+		key, err := cfg.EncryptionKey()
+		exitOnErr(err)
+		if key == "" {
+			fmt.Fprintln(os.Stderr, "autoenv: databases are not encrypted")
+			os.Exit(1)
+		}
+
+		exitOnErr(rekeyDatabases(cfg, key, ""))
+		if cfg.Passphrase != "" {
+			fmt.Println("Databases decrypted; unset AUTOENV_DB_PASSPHRASE.")
+			return
+		}
+		exitOnErr(cfg.RemoveKeyFile())
+		fmt.Println("Databases decrypted.")
+	},
+}
+
+var dbRekeyCmd = &cobra.Command{
+	Use:   "rekey",
+	Short: "Re-encrypt the local databases with a new key",
+	Long: `Re-encrypt the local databases with a new key. The new key is
+AUTOENV_DB_NEW_PASSPHRASE if set, otherwise a freshly generated key file.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg := loadDBConfig()
+		oldKey, err := cfg.EncryptionKey()
+		exitOnErr(err)
+		if oldKey == "" {
+			fmt.Fprintln(os.Stderr, "autoenv: databases are not encrypted; use `autoenv db encrypt`")
+			os.Exit(1)
+		}
+
+		if newPassphrase := os.Getenv("AUTOENV_DB_NEW_PASSPHRASE"); newPassphrase != "" {
+			exitOnErr(rekeyDatabases(cfg, oldKey, newPassphrase))
+			exitOnErr(cfg.RemoveKeyFile())
+			fmt.Println("Databases rekeyed; set AUTOENV_DB_PASSPHRASE to the new passphrase.")
+			return
+		}
+
+		key, err := config.NewKey()
+		exitOnErr(err)
+		exitOnErr(rekeyWithKeyFile(cfg, oldKey, key))
+		if cfg.Passphrase != "" {
+			fmt.Printf("Databases rekeyed; key stored in %s. Unset AUTOENV_DB_PASSPHRASE.\n", cfg.KeyFile)
+			return
+		}
+		fmt.Printf("Databases rekeyed; key stored in %s.\n", cfg.KeyFile)
+	},
+}
+
+func loadDBConfig() *config.Config {
+	exitOnErr(sqlite.CheckEncryption())
+	cfg := config.Load()
+	exitOnErr(cfg.EnsureDir())
+	return cfg
+}
+
+// rekeyWithKeyFile stages the new key next to the key file before touching
+// the databases, so it is never lost if rekeying fails halfway. A key
+// staged by such a run is reused, so running again finishes the job.
+func rekeyWithKeyFile(cfg *config.Config, oldKey, newKey string) error {
+	staged := *cfg
+	staged.Passphrase = ""
+	staged.KeyFile = cfg.KeyFile + ".new"
+	if key, err := staged.EncryptionKey(); err == nil && key != "" {
+		newKey = key
+	} else if err := staged.WriteKeyFile(newKey); err != nil {
+		return err
+	}
+	if err := rekeyDatabases(cfg, oldKey, newKey); err != nil {
+		return fmt.Errorf("%w (the new key is in %s)", err, staged.KeyFile)
+	}
+	if err := os.Rename(staged.KeyFile, cfg.KeyFile); err != nil {
+		return fmt.Errorf("install key file: %w (the new key is in %s)", err, staged.KeyFile)
+	}
+	return nil
+}
+
+// rekeyDatabases moves every database from oldKey to newKey. Databases
+// that already open with newKey are skipped, so after a partial failure
+// running it again converges instead of leaving mixed keys.
+func rekeyDatabases(cfg *config.Config, oldKey, newKey string) error {
+	for _, path := range []string{cfg.SessionsDBPath, cfg.StateDBPath, cfg.LegacySessionsDBPath} {
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		if err := sqlite.Rekey(path, oldKey, newKey); err != nil {
+			return err
+		}
+	}
+
+	if _, err := os.Stat(cfg.ProjectsDBPath); err != nil {
+		return nil
+	}
+	if cfg.TursoURL == "" || !sqlite.IsReplica(cfg.ProjectsDBPath) {
+		return sqlite.Rekey(cfg.ProjectsDBPath, oldKey, newKey)
+	}
+
+	// A replica cannot be rekeyed in place; download it again under the
+	// new key, after checking that Turso is reachable and up to date.
+	t, err := sqlite.OpenTurso(cfg.ProjectsDBPath, cfg.TursoURL, cfg.TursoAuthToken, oldKey)
+	if err != nil {
+		if sqlite.Unlocks(cfg.ProjectsDBPath, newKey) {
+			return nil
+		}
+		return err
+	}
+	if t.Offline {
+		_ = t.Close()
+		return fmt.Errorf("turso is unreachable; the replica can only be rekeyed online")
+	}
+	if _, err := t.Sync(); err != nil {
+		_ = t.Close()
+		return fmt.Errorf("sync before rekey: %w", err)
+	}
+	_ = t.Close()
+
+	sqlite.ResetReplica(cfg.ProjectsDBPath)
+	t, err = sqlite.OpenTurso(cfg.ProjectsDBPath, cfg.TursoURL, cfg.TursoAuthToken, newKey)
+	if err != nil {
+		return fmt.Errorf("download replica: %w", err)
+	}
+	return t.Close()
+}
+
+func exitOnErr(err error) {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func init() {
+	dbCmd.AddCommand(dbEncryptCmd)
+	dbCmd.AddCommand(dbDecryptCmd)
+	dbCmd.AddCommand(dbRekeyCmd)
+	rootCmd.AddCommand(dbCmd)
+}
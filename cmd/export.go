@@ -28,8 +28,8 @@ var exportCmd = &cobra.Command{
 			return
 		}
 
-		// Lightweight bootstrap — sessions DB only, no Turso
-		a, cc, err := bootstrapLight()
+		// Lightweight bootstrap — sessions DB plus read-only registry, no Turso
+		a, cc, err := bootstrapExport()
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
 			return
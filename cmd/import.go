@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/stormingluke/autoenv/internal/adapter/format"
+	"github.com/stormingluke/autoenv/internal/domain"
+)
+
+var (
+	importFormat    string
+	importProject   string
+	importService   string
+	importName      string
+	importFromShell bool
+	importPrefix    string
+	importYes       bool
+)
+
+var importCmd = &cobra.Command{
+	Use:   "import [file]",
+	Short: "Create or merge .env from another format",
+	Long: `Create or merge the project .env from JSON, YAML, a docker-compose
+environment block, a Kubernetes Secret/ConfigMap manifest, or the current
+shell environment. Existing comments and formatting in .env are kept.
+
+The format is detected from the file contents unless --format is given.
+Use "-" to read from stdin.
+
+Formats: ` + strings.Join(format.ParserNames(), ", ") + `
+
+Examples:
+  autoenv import config.json
+  autoenv import docker-compose.yml --service api
+  kubectl get secret myapp -o yaml | autoenv import - --format k8s
+  autoenv import --from-shell --prefix AWS_`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path := importProject
+		if path == "" {
+			path, _ = os.Getwd()
+		}
+
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+			os.Exit(1)
+		}
+
+		incoming, err := readImport(args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+			os.Exit(1)
+		}
+
+		a, cc, err := bootstrapLight()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+			os.Exit(1)
+		}
+		defer cc.CloseAll()
+
+		changes, err := a.Import.Plan(absPath, incoming)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+			os.Exit(1)
+		}
+
+		added := domain.CountChanges(changes, domain.ChangeAdded)
+		updated := domain.CountChanges(changes, domain.ChangeUpdated)
+		if added+updated == 0 {
+			fmt.Println("Nothing to import: .env is already up to date.")
+			return
+		}
+
+		fmt.Printf("Changes to %s:\n", filepath.Join(absPath, ".env"))
+		printChanges(changes)
+
+		if updated > 0 && !importYes && len(args) > 0 && args[0] == "-" && !haveTTY() {
+			fmt.Fprintf(os.Stderr, "autoenv: %d existing key(s) would be overwritten and stdin holds the import, so there is no terminal to ask on; pass -y to overwrite them\n", updated)
+			os.Exit(1)
+		}
+		if updated > 0 && !importYes && !confirm(fmt.Sprintf("Overwrite %d existing key(s)?", updated)) {
+			fmt.Fprintln(os.Stderr, "autoenv: import cancelled")
+			os.Exit(1)
+		}
+
+		if err := a.Import.Apply(absPath, incoming, changes); err != nil {
+			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Imported %d new and %d updated variables.\n", added, updated)
+	},
+}
+
+func readImport(args []string) (map[string]string, error) {
+	if importFromShell {
+		if len(args) > 0 {
+			return nil, fmt.Errorf("--from-shell does not take a file argument")
+		}
+		if importPrefix == "" {
+			return nil, fmt.Errorf("--from-shell requires --prefix to avoid importing the whole environment")
+		}
+		values := make(map[string]string)
+		for _, kv := range os.Environ() {
+			key, value, ok := strings.Cut(kv, "=")
+			if ok && strings.HasPrefix(key, importPrefix) {
+				values[key] = value
+			}
+		}
+		return values, nil
+	}
+
+	if len(args) == 0 {
+		return nil, fmt.Errorf("file required (use - for stdin) or --from-shell")
+	}
+
+	var data []byte
+	var err error
+	if args[0] == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(args[0])
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	name := importFormat
+	if name == "" {
+		name = format.Detect(data)
+	}
+	parser, err := format.NewParser(name, format.Options{Name: importName, Service: importService})
+	if err != nil {
+		return nil, err
+	}
+	return parser.Parse(data)
+}
+
+func init() {
+	importCmd.Flags().StringVarP(&importFormat, "format", "f", "", "Input format ("+strings.Join(format.ParserNames(), ", ")+"); detected when omitted")
+	importCmd.Flags().StringVarP(&importProject, "project", "p", "", "Path to directory containing .env (defaults to current directory)")
+	importCmd.Flags().StringVar(&importService, "service", "", "docker-compose service to read the environment block from")
+	importCmd.Flags().StringVar(&importName, "name", "", "Only import the Kubernetes Secret/ConfigMap with this name")
+	importCmd.Flags().BoolVar(&importFromShell, "from-shell", false, "Import from the current process environment")
+	importCmd.Flags().StringVar(&importPrefix, "prefix", "", "Only import shell variables starting with this prefix (with --from-shell)")
+	importCmd.Flags().BoolVarP(&importYes, "yes", "y", false, "Overwrite existing keys without asking")
+	rootCmd.AddCommand(importCmd)
+}
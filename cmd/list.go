@@ -1,16 +1,44 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 	"text/tabwriter"
 
 	"github.com/spf13/cobra"
+	"github.com/stormingluke/autoenv/internal/app"
 )
 
+var (
+	listTag    string
+	listFilter string
+	listSort   string
+	listJSON   bool
+)
+
+type projectJSON struct {
+	Name         string   `json:"name"`
+	Path         string   `json:"path"`
+	PortablePath string   `json:"portable_path"`
+	RemoteURL    string   `json:"remote_url,omitempty"`
+	Description  string   `json:"description,omitempty"`
+	Tags         []string `json:"tags"`
+	CreatedAt    string   `json:"created_at"`
+	LastUsedAt   string   `json:"last_used_at,omitempty"`
+	Status       string   `json:"status"`
+}
+
 var listCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List registered projects",
+	Long: `List registered projects.
+
+Examples:
+  autoenv list --tag client-acme
+  autoenv list --filter 'api-*' --sort last-used
+  autoenv list --json`,
 	Run: func(cmd *cobra.Command, args []string) {
 		b, err := bootstrap()
 		if err != nil {
@@ -19,30 +47,71 @@ var listCmd = &cobra.Command{
 		}
 		defer b.cc.CloseAll()
 
-		projects, err := b.app.List.ListProjects()
+		projects, err := b.app.List.List(app.ListOptions{Tag: listTag, Filter: listFilter, Sort: listSort})
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
 			os.Exit(1)
 		}
 
+		if listJSON {
+			out := make([]projectJSON, 0, len(projects))
+			for _, p := range projects {
+				tags := p.Tags
+				if tags == nil {
+					tags = []string{}
+				}
+				out = append(out, projectJSON{
+					Name:         p.Name,
+					Path:         p.Path,
+					PortablePath: p.PortablePath,
+					RemoteURL:    p.RemoteURL,
+					Description:  p.Description,
+					Tags:         tags,
+					CreatedAt:    p.CreatedAt,
+					LastUsedAt:   p.LastUsedAt,
+					Status:       string(p.Status),
+				})
+			}
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			_ = enc.Encode(out)
+			return
+		}
+
 		if len(projects) == 0 {
 			fmt.Println("No registered projects.")
 			return
 		}
 
 		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-		_, _ = fmt.Fprintln(w, "NAME\tPATH\tCREATED")
+		_, _ = fmt.Fprintln(w, "NAME\tPATH\tTAGS\tCREATED\tLAST USED\tSTATUS")
+		stale := 0
 		for _, p := range projects {
-			name := p.Name
-			if name == "" {
-				name = "-"
+			if p.Stale() {
+				stale++
 			}
-			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", name, p.Path, p.CreatedAt)
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+				displayName(p.Name), localPath(p.Path), displayName(strings.Join(p.Tags, ",")),
+				p.CreatedAt, displayName(p.LastUsedAt), p.Status)
 		}
 		_ = w.Flush()
+		if stale > 0 {
+			fmt.Fprintf(os.Stderr, "\n%d stale project(s); run `autoenv project relocate` or `autoenv project prune`.\n", stale)
+		}
 	},
 }
 
 func init() {
+	listCmd.Flags().StringVar(&listTag, "tag", "", "Only list projects with this tag")
+	listCmd.Flags().StringVar(&listFilter, "filter", "", "Only list projects whose name or path matches this glob")
+	listCmd.Flags().StringVar(&listSort, "sort", "name", "Sort by name, created or last-used")
+	listCmd.Flags().BoolVar(&listJSON, "json", false, "Output as JSON")
 	rootCmd.AddCommand(listCmd)
 }
+
+func localPath(path string) string {
+	if path == "" {
+		return "(not checked out)"
+	}
+	return path
+}
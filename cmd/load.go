@@ -7,7 +7,6 @@ import (
 
 	"github.com/joho/godotenv"
 	"github.com/spf13/cobra"
-	"github.com/stormingluke/autoenv/internal/adapter/envfile"
 	"github.com/stormingluke/autoenv/internal/adapter/shell"
 )
 
@@ -15,8 +14,8 @@ var loadProject string
 
 var loadCmd = &cobra.Command{
 	Use:   "load",
-	Short: "Load .env from a directory and output export commands",
-	Long:  `Load environment variables from a .env file. Use with eval: eval "$(autoenv load -p /path/to/dir)"`,
+	Short: "Register a directory and output export commands for its .env",
+	Long:  `Register a project directory and load its .env file. Use with eval: eval "$(autoenv load -p /path/to/dir)"`,
 	Run: func(cmd *cobra.Command, args []string) {
 		path := loadProject
 		if path == "" {
@@ -29,14 +28,16 @@ var loadCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
-		loader := envfile.NewLoader()
-		envFile, err := loader.Load(absPath)
+		b, err := bootstrap()
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
 			os.Exit(1)
 		}
-		if envFile == nil {
-			fmt.Fprintf(os.Stderr, "autoenv: no .env file in %s\n", absPath)
+		defer b.cc.CloseAll()
+
+		envFile, project, err := b.app.Load.Load(absPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
 			os.Exit(1)
 		}
 
@@ -44,7 +45,7 @@ var loadCmd = &cobra.Command{
 
 		renderer := shell.NewRenderer()
 		fmt.Print(renderer.FormatExports("zsh", envFile.Values))
-		fmt.Fprintf(os.Stderr, "autoenv: loaded %d variables from %s\n", len(envFile.Values), absPath)
+		fmt.Fprintf(os.Stderr, "autoenv: loaded %d variables from %s (project %s)\n", len(envFile.Values), absPath, project.Name)
 	},
 }
 
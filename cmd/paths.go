@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/stormingluke/autoenv/internal/adapter/config"
+)
+
+var pathsJSON bool
+
+type pathsOutput struct {
+	ConfigDir   string `json:"config_dir"`
+	StateDir    string `json:"state_dir"`
+	RuntimeDir  string `json:"runtime_dir"`
+	ProjectsDB  string `json:"projects_db"`
+	StateDB     string `json:"state_db"`
+	SessionsDB  string `json:"sessions_db"`
+	KeyFile     string `json:"key_file"`
+	HashKeyFile string `json:"hash_key_file"`
+}
+
+var pathsCmd = &cobra.Command{
+	Use:   "paths",
+	Short: "Show where autoenv keeps its files",
+	Long: `Show the directories and files autoenv uses.
+
+  config   settings and the project registry (synced with Turso)
+  state    local data that survives reboots: usage, sync history, queued changes
+  runtime  per-shell sessions; $XDG_RUNTIME_DIR when set, else the state directory
+
+Override them with AUTOENV_CONFIG_DIR, AUTOENV_STATE_DIR and AUTOENV_RUNTIME_DIR.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg := config.Load()
+		out := pathsOutput{
+			ConfigDir:   cfg.Dir,
+			StateDir:    cfg.StateDir,
+			RuntimeDir:  cfg.RuntimeDir,
+			ProjectsDB:  cfg.ProjectsDBPath,
+			StateDB:     cfg.StateDBPath,
+			SessionsDB:  cfg.SessionsDBPath,
+			KeyFile:     cfg.KeyFile,
+			HashKeyFile: filepath.Join(cfg.Dir, "hash.key"),
+		}
+
+		if pathsJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			_ = enc.Encode(out)
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, row := range [][2]string{
+			{"config", out.ConfigDir},
+			{"state", out.StateDir},
+			{"runtime", out.RuntimeDir},
+			{"projects.db", out.ProjectsDB},
+			{"state.db", out.StateDB},
+			{"sessions.db", out.SessionsDB},
+			{"db key", out.KeyFile},
+			{"hash key", out.HashKeyFile},
+		} {
+			_, _ = fmt.Fprintf(w, "%s\t%s\n", row[0], row[1])
+		}
+		_ = w.Flush()
+	},
+}
+
+func init() {
+	pathsCmd.Flags().BoolVar(&pathsJSON, "json", false, "Output as JSON")
+	rootCmd.AddCommand(pathsCmd)
+}
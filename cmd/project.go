@@ -0,0 +1,350 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	projectAddName        string
+	projectAddDescription string
+	projectTagProject     string
+	projectPruneYes       bool
+	projectRelocateRoots  []string
+)
+
+var projectCmd = &cobra.Command{
+	Use:   "project",
+	Short: "Manage the project registry",
+	Long: `Add, remove, rename and inspect registered projects.
+
+Projects can be referred to by path or by name.
+
+Examples:
+  autoenv project add                      # register the current directory
+  autoenv project add ~/code/api --name api
+  autoenv project rename api billing-api
+  autoenv project show billing-api
+  autoenv project tag add client-acme backend
+  autoenv project rm billing-api
+  autoenv project relocate --root ~/src
+  autoenv project prune`,
+}
+
+var projectAddCmd = &cobra.Command{
+	Use:   "add [path]",
+	Short: "Register a project directory",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		b, err := bootstrap()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+			os.Exit(1)
+		}
+		defer b.cc.CloseAll()
+
+		p, err := b.app.Project.Register(projectRef(args), projectAddName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+			os.Exit(1)
+		}
+		if projectAddDescription != "" {
+			if _, err := b.app.Project.Describe(p.Path, projectAddDescription); err != nil {
+				fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		fmt.Printf("Registered %s (%s)\n", p.Name, p.Path)
+	},
+}
+
+var projectRmCmd = &cobra.Command{
+	Use:   "rm [path|name]",
+	Short: "Remove a project from the registry",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		b, err := bootstrap()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+			os.Exit(1)
+		}
+		defer b.cc.CloseAll()
+
+		p, err := b.app.Project.Remove(projectRef(args))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Removed %s (%s)\n", displayName(p.Name), p.PortablePath)
+	},
+}
+
+var projectRenameCmd = &cobra.Command{
+	Use:   "rename [path|name] <new-name>",
+	Short: "Rename a registered project",
+	Args:  cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		b, err := bootstrap()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+			os.Exit(1)
+		}
+		defer b.cc.CloseAll()
+
+		newName := args[len(args)-1]
+		p, err := b.app.Project.Rename(projectRef(args[:len(args)-1]), newName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Renamed %s to %s\n", p.PortablePath, p.Name)
+	},
+}
+
+var projectDescribeCmd = &cobra.Command{
+	Use:   "describe [path|name] <description>",
+	Short: "Set the description of a registered project",
+	Args:  cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		b, err := bootstrap()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+			os.Exit(1)
+		}
+		defer b.cc.CloseAll()
+
+		p, err := b.app.Project.Describe(projectRef(args[:len(args)-1]), args[len(args)-1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Updated description of %s\n", displayName(p.Name))
+	},
+}
+
+var projectTagCmd = &cobra.Command{
+	Use:   "tag",
+	Short: "Add or remove project tags",
+}
+
+var projectTagAddCmd = &cobra.Command{
+	Use:   "add <tag>...",
+	Short: "Tag a project",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		b, err := bootstrap()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+			os.Exit(1)
+		}
+		defer b.cc.CloseAll()
+
+		p, err := b.app.Project.AddTags(projectRef(optionalArg(projectTagProject)), args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s tags: %s\n", displayName(p.Name), displayName(strings.Join(p.Tags, ",")))
+	},
+}
+
+var projectTagRmCmd = &cobra.Command{
+	Use:   "rm <tag>...",
+	Short: "Remove tags from a project",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		b, err := bootstrap()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+			os.Exit(1)
+		}
+		defer b.cc.CloseAll()
+
+		p, err := b.app.Project.RemoveTags(projectRef(optionalArg(projectTagProject)), args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s tags: %s\n", displayName(p.Name), displayName(strings.Join(p.Tags, ",")))
+	},
+}
+
+var projectShowCmd = &cobra.Command{
+	Use:   "show [path|name]",
+	Short: "Show details of a registered project",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		b, err := bootstrap()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+			os.Exit(1)
+		}
+		defer b.cc.CloseAll()
+
+		d, err := b.app.Project.Show(projectRef(args))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Name:        %s\n", displayName(d.Name))
+		fmt.Printf("Path:        %s\n", localPath(d.Path))
+		fmt.Printf("Registry:    %s\n", d.PortablePath)
+		fmt.Printf("Description: %s\n", displayName(d.Description))
+		fmt.Printf("Tags:        %s\n", displayName(strings.Join(d.Tags, ",")))
+		fmt.Printf("Remote:      %s\n", displayName(d.RemoteURL))
+		fmt.Printf("Created:     %s\n", d.CreatedAt)
+		if d.EnvFile != nil {
+			fmt.Printf("Env file:    %s (%d variables)\n", d.EnvFile.Path, len(d.EnvFile.Values))
+		} else {
+			fmt.Println("Env file:    -")
+		}
+	},
+}
+
+var projectPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove projects whose directory or .env no longer exists",
+	Long: `Remove registry entries whose directory on this machine no longer
+exists or no longer contains a .env file. Projects still checked out on
+another machine only lose this machine's location.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		b, err := bootstrap()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+			os.Exit(1)
+		}
+		defer b.cc.CloseAll()
+
+		stale, err := b.app.Project.Stale()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+			os.Exit(1)
+		}
+		if len(stale) == 0 {
+			fmt.Println("No stale projects.")
+			return
+		}
+
+		fmt.Println("Stale projects:")
+		for _, p := range stale {
+			fmt.Printf("  %s\t%s (%s)\n", displayName(p.Name), p.Path, p.Status)
+		}
+		if !projectPruneYes && !confirm(fmt.Sprintf("Remove %d project(s)?", len(stale))) {
+			fmt.Fprintln(os.Stderr, "autoenv: prune cancelled")
+			os.Exit(1)
+		}
+
+		if err := b.app.Project.Prune(stale); err != nil {
+			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Pruned %d project(s).\n", len(stale))
+	},
+}
+
+var projectRelocateCmd = &cobra.Command{
+	Use:   "relocate [path|name]...",
+	Short: "Find moved projects and update their paths",
+	Long: `Search the given roots for the new location of moved projects and
+update the registry in place. A directory matches when it is a checkout of
+the same git remote or contains a .env with the same keys and values.
+
+Without arguments every stale project is searched for.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		roots := projectRelocateRoots
+		if len(roots) == 0 {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+				os.Exit(1)
+			}
+			roots = []string{home}
+		}
+
+		b, err := bootstrap()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+			os.Exit(1)
+		}
+		defer b.cc.CloseAll()
+
+		results, err := b.app.Project.Relocate(args, roots)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+			os.Exit(1)
+		}
+		if len(results) == 0 {
+			fmt.Println("No stale projects.")
+			return
+		}
+
+		unresolved := 0
+		for _, r := range results {
+			name := displayName(r.Project.Name)
+			switch {
+			case r.NewPath != "":
+				fmt.Printf("Relocated %s: %s -> %s\n", name, localPath(r.Project.Path), r.NewPath)
+			case len(r.Candidates) == 0:
+				unresolved++
+				fmt.Printf("Not found: %s\n", name)
+			case r.Taken:
+				unresolved++
+				fmt.Printf("Ambiguous: %s matches %s, which another project now holds\n", name, r.Candidates[0])
+			default:
+				unresolved++
+				fmt.Printf("Ambiguous: %s matches %s\n", name, strings.Join(r.Candidates, ", "))
+			}
+		}
+		if unresolved > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+// projectRef returns the path or name given on the command line, or the
+// current directory when none was given.
+func projectRef(args []string) string {
+	if len(args) > 0 {
+		return args[0]
+	}
+	cwd, _ := os.Getwd()
+	return cwd
+}
+
+func optionalArg(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return []string{s}
+}
+
+func displayName(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func init() {
+	projectAddCmd.Flags().StringVar(&projectAddName, "name", "", "Project name (defaults to the git repository or directory name)")
+	projectAddCmd.Flags().StringVar(&projectAddDescription, "description", "", "Project description")
+	projectTagCmd.PersistentFlags().StringVarP(&projectTagProject, "project", "p", "", "Project path or name (defaults to current directory)")
+	projectTagCmd.AddCommand(projectTagAddCmd)
+	projectTagCmd.AddCommand(projectTagRmCmd)
+	projectCmd.AddCommand(projectAddCmd)
+	projectCmd.AddCommand(projectRmCmd)
+	projectCmd.AddCommand(projectRenameCmd)
+	projectCmd.AddCommand(projectDescribeCmd)
+	projectCmd.AddCommand(projectTagCmd)
+	projectCmd.AddCommand(projectShowCmd)
+	projectPruneCmd.Flags().BoolVarP(&projectPruneYes, "yes", "y", false, "Remove without asking")
+	projectRelocateCmd.Flags().StringSliceVar(&projectRelocateRoots, "root", nil, "Directory to search (repeatable; defaults to the home directory)")
+	projectCmd.AddCommand(projectPruneCmd)
+	projectCmd.AddCommand(projectRelocateCmd)
+	rootCmd.AddCommand(projectCmd)
+}
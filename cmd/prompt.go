@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/stormingluke/autoenv/internal/domain"
+)
+
+// confirm asks a yes/no question on stderr and reads the answer from the
+// terminal, so it still works when stdout is captured by eval or stdin
+// carries the data being imported. Without a terminal it falls back to
+// stdin.
+func confirm(question string) bool {
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	in := os.Stdin
+	if tty, err := os.Open("/dev/tty"); err == nil {
+		defer func() { _ = tty.Close() }()
+		in = tty
+	}
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// haveTTY reports whether confirm can ask on a terminal.
+func haveTTY() bool {
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return false
+	}
+	_ = tty.Close()
+	return true
+}
+
+// printChanges lists added and updated keys with their values masked.
+func printChanges(changes []domain.EnvChange) {
+	for _, c := range changes {
+		switch c.Kind {
+		case domain.ChangeAdded:
+			fmt.Printf("  + %s = %s\n", c.Key, domain.MaskValue(c.New))
+		case domain.ChangeUpdated:
+			fmt.Printf("  ~ %s: %s -> %s\n", c.Key, domain.MaskValue(c.Old), domain.MaskValue(c.New))
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"github.com/stormingluke/autoenv/internal/adapter/shell"
+	"github.com/stormingluke/autoenv/internal/domain"
+)
+
+var (
+	pullSession bool
+	pullForce   bool
+	pullDryRun  bool
+	pullYes     bool
+)
+
+var pullCmd = &cobra.Command{
+	Use:   "pull <target|name>",
+	Short: "Pull secrets from a remote into .env or the current shell",
+	Long: `Read the values stored at a target and merge them into the current
+directory's .env, keeping its comments and formatting, or with --session
+print export commands for eval instead of writing anything. The target is
+one of the project's named targets or a target string.
+
+The changes are listed before anything is written. A key whose local value
+did not come from the source (it was set or edited locally) is local-only
+and kept unless --force is given; keys the source does not have are never
+removed. What was pulled is recorded in the sync ledger.
+
+Sources:
+  vault://secret/data/myapp     Vault KV v2 secret (set VAULT_ADDR)
+  file://secrets/dev.env        dotenv, JSON or YAML file, relative to the project
+  exec://<plugin>[/<ref>]       output of autoenv-source-<plugin> <ref> from PATH
+
+Examples:
+  autoenv pull vault://secret/data/api --dry-run
+  autoenv pull vault                                  # a named target
+  autoenv pull file:///mnt/shared/api.env --force
+  autoenv pull exec://op/vaults/dev/items/api -y
+  eval "$(autoenv pull vault://secret/data/api --session)"`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		b, err := bootstrap()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+			os.Exit(1)
+		}
+		defer b.cc.CloseAll()
+
+		cwd, err := os.Getwd()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+			os.Exit(1)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		r, err := b.app.Sync.Pull(ctx, cwd, args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "autoenv: pull failed: %v\n", err)
+			os.Exit(1)
+		}
+
+		if pullSession {
+			if err := b.app.Export.Record(getShellPID(), cwd, r.Values); err != nil {
+				fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Print(shell.NewRenderer().FormatExports("zsh", r.Values))
+			fmt.Print("export _AUTOENV_ACTIVE=1\n")
+			fmt.Fprintf(os.Stderr, "autoenv: loaded %d variables from %s\n", len(r.Values), r.Target)
+			return
+		}
+
+		added := domain.CountChanges(r.Changes, domain.ChangeAdded)
+		updated := domain.CountChanges(r.Changes, domain.ChangeUpdated)
+		localOnly := domain.CountChanges(r.Changes, domain.ChangeLocalOnly)
+		overwrite := updated
+		if pullForce {
+			overwrite += localOnly
+		}
+		if added+overwrite == 0 {
+			fmt.Printf("Nothing to pull: .env is up to date with %s.\n", r.Target)
+		} else {
+			fmt.Printf("Changes to %s from %s:\n", filepath.Join(r.Dir, ".env"), r.Target)
+			printPullChanges(r.Changes)
+		}
+
+		switch {
+		case pullDryRun:
+			fmt.Println("\nDry run: nothing written.")
+		case added+overwrite == 0:
+		case overwrite > 0 && !pullYes && !confirm(fmt.Sprintf("Overwrite %d existing key(s)?", overwrite)):
+			fmt.Fprintln(os.Stderr, "autoenv: pull cancelled")
+			os.Exit(1)
+		default:
+			if err := b.app.Sync.ApplyPull(r, pullForce); err != nil {
+				fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Pulled %d new and %d updated key(s).\n", added, overwrite)
+		}
+		if localOnly > 0 && !pullForce {
+			fmt.Printf("%d local-only key(s) kept; use --force to overwrite them.\n", localOnly)
+		}
+	},
+}
+
+// printPullChanges lists the keys a pull adds or overwrites and the
+// local-only ones it keeps.
+func printPullChanges(changes []domain.EnvChange) {
+	printChanges(changes)
+	for _, c := range changes {
+		if c.Kind != domain.ChangeLocalOnly {
+			continue
+		}
+		if pullForce {
+			fmt.Printf("  ~ %s: %s -> %s (local value overwritten)\n", c.Key, domain.MaskValue(c.Old), domain.MaskValue(c.New))
+		} else {
+			fmt.Printf("  ! %s: %s kept, source has %s\n", c.Key, domain.MaskValue(c.Old), domain.MaskValue(c.New))
+		}
+	}
+}
+
+func init() {
+	pullCmd.Flags().BoolVar(&pullSession, "session", false, "Print export commands for eval instead of writing .env")
+	pullCmd.Flags().BoolVar(&pullForce, "force", false, "Overwrite local-only values too")
+	pullCmd.Flags().BoolVar(&pullDryRun, "dry-run", false, "Show the changes without writing .env")
+	pullCmd.Flags().BoolVarP(&pullYes, "yes", "y", false, "Overwrite existing keys without asking")
+	rootCmd.AddCommand(pullCmd)
+}
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/stormingluke/autoenv/internal/adapter/format"
+)
+
+var (
+	renderFormat    string
+	renderProject   string
+	renderName      string
+	renderNamespace string
+)
+
+var renderCmd = &cobra.Command{
+	Use:   "render",
+	Short: "Render the project .env in another format",
+	Long: `Render the project's .env as JSON, YAML, a docker env-file, a systemd
+EnvironmentFile, a Kubernetes Secret/ConfigMap manifest or $GITHUB_ENV lines.
+
+Formats: ` + strings.Join(format.Names(), ", ") + `
+
+Examples:
+  autoenv render --format json
+  autoenv render --format docker > app.env
+  autoenv render --format k8s-secret --name myapp --namespace prod | kubectl apply -f -
+  autoenv render --format github-env >> "$GITHUB_ENV"`,
+	Run: func(cmd *cobra.Command, args []string) {
+		path := renderProject
+		if path == "" {
+			path, _ = os.Getwd()
+		}
+
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+			os.Exit(1)
+		}
+
+		name := renderName
+		if name == "" {
+			name = filepath.Base(absPath)
+		}
+
+		formatter, err := format.New(renderFormat, format.Options{Name: name, Namespace: renderNamespace})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+			os.Exit(1)
+		}
+
+		a, cc, err := bootstrapLight()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+			os.Exit(1)
+		}
+		defer cc.CloseAll()
+
+		output, err := a.Render.Render(absPath, formatter)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Print(output)
+	},
+}
+
+func init() {
+	renderCmd.Flags().StringVarP(&renderFormat, "format", "f", "", "Output format ("+strings.Join(format.Names(), ", ")+")")
+	renderCmd.Flags().StringVarP(&renderProject, "project", "p", "", "Path to directory containing .env (defaults to current directory)")
+	renderCmd.Flags().StringVar(&renderName, "name", "", "Object name for Kubernetes manifests (defaults to directory name)")
+	renderCmd.Flags().StringVar(&renderNamespace, "namespace", "", "Namespace for Kubernetes manifests")
+	_ = renderCmd.MarkFlagRequired("format")
+	rootCmd.AddCommand(renderCmd)
+}
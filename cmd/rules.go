@@ -0,0 +1,190 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/stormingluke/autoenv/internal/domain"
+)
+
+var (
+	rulesProject     string
+	rulesInclude     []string
+	rulesExclude     []string
+	rulesStripPrefix string
+	rulesAddPrefix   string
+	rulesRename      []string
+)
+
+var projectRulesCmd = &cobra.Command{
+	Use:   "rules",
+	Short: "Choose which .env keys `autoenv sync` pushes, and under what names",
+	Long: `Sync rules filter and rename keys before they are pushed to any target.
+They are stored in the project registry and synced with it.
+
+A key is pushed if it matches an --include glob (or none are set) and no
+--exclude glob. It is then renamed by an explicit --rename, or else has
+--strip-prefix removed and --add-prefix prepended.
+
+Examples:
+  autoenv project rules set --exclude 'LOCAL_*' --exclude DEBUG
+  autoenv project rules set --rename DB_URL=PROD_DB_URL
+  autoenv project rules set --strip-prefix DEV_ --add-prefix CI_
+  autoenv project rules show
+  autoenv project rules clear`,
+}
+
+var projectRulesShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show a project's sync rules",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		b, err := bootstrap()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+			os.Exit(1)
+		}
+		defer b.cc.CloseAll()
+
+		p, rules, err := b.app.Project.SyncRules(projectRef(optionalArg(rulesProject)))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+			os.Exit(1)
+		}
+		printSyncRules(p.Name, rules)
+	},
+}
+
+var projectRulesSetCmd = &cobra.Command{
+	Use:   "set",
+	Short: "Change a project's sync rules",
+	Long: `Change the given parts of a project's sync rules, keeping the rest.
+--include and --exclude replace their lists (pass '' to clear one);
+--rename FROM=TO adds a rename and --rename FROM= removes it.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		renames := make(map[string]string, len(rulesRename))
+		for _, r := range rulesRename {
+			from, to, ok := strings.Cut(r, "=")
+			if !ok || from == "" {
+				fmt.Fprintf(os.Stderr, "autoenv: invalid --rename %q (expected FROM=TO)\n", r)
+				os.Exit(1)
+			}
+			renames[from] = to
+		}
+
+		b, err := bootstrap()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+			os.Exit(1)
+		}
+		defer b.cc.CloseAll()
+
+		flags := cmd.Flags()
+		p, rules, err := b.app.Project.UpdateSyncRules(projectRef(optionalArg(rulesProject)), func(r *domain.SyncRules) {
+			if flags.Changed("include") {
+				r.Include = nonEmpty(rulesInclude)
+			}
+			if flags.Changed("exclude") {
+				r.Exclude = nonEmpty(rulesExclude)
+			}
+			if flags.Changed("strip-prefix") {
+				r.StripPrefix = rulesStripPrefix
+			}
+			if flags.Changed("add-prefix") {
+				r.AddPrefix = rulesAddPrefix
+			}
+			for from, to := range renames {
+				if r.Rename == nil {
+					r.Rename = make(map[string]string)
+				}
+				if to == "" {
+					delete(r.Rename, from)
+				} else {
+					r.Rename[from] = to
+				}
+			}
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+			os.Exit(1)
+		}
+		printSyncRules(p.Name, rules)
+	},
+}
+
+var projectRulesClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Remove a project's sync rules",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		b, err := bootstrap()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+			os.Exit(1)
+		}
+		defer b.cc.CloseAll()
+
+		p, _, err := b.app.Project.UpdateSyncRules(projectRef(optionalArg(rulesProject)), func(r *domain.SyncRules) {
+			*r = domain.SyncRules{}
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Cleared sync rules of %s\n", displayName(p.Name))
+	},
+}
+
+func printSyncRules(name string, r domain.SyncRules) {
+	if r.IsZero() {
+		fmt.Printf("%s has no sync rules; every key is pushed as is.\n", displayName(name))
+		return
+	}
+	fmt.Printf("Include:      %s\n", displayName(strings.Join(r.Include, ", ")))
+	fmt.Printf("Exclude:      %s\n", displayName(strings.Join(r.Exclude, ", ")))
+	fmt.Printf("Strip prefix: %s\n", displayName(r.StripPrefix))
+	fmt.Printf("Add prefix:   %s\n", displayName(r.AddPrefix))
+	if len(r.Rename) == 0 {
+		fmt.Println("Rename:       -")
+		return
+	}
+	froms := make([]string, 0, len(r.Rename))
+	for from := range r.Rename {
+		froms = append(froms, from)
+	}
+	sort.Strings(froms)
+	for i, from := range froms {
+		label := "Rename:      "
+		if i > 0 {
+			label = "             "
+		}
+		fmt.Printf("%s %s -> %s\n", label, from, r.Rename[from])
+	}
+}
+
+func nonEmpty(values []string) []string {
+	var out []string
+	for _, v := range values {
+		if v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func init() {
+	projectRulesCmd.PersistentFlags().StringVarP(&rulesProject, "project", "p", "", "Project path or name (defaults to current directory)")
+	projectRulesSetCmd.Flags().StringArrayVar(&rulesInclude, "include", nil, "Only push keys matching this glob (repeatable)")
+	projectRulesSetCmd.Flags().StringArrayVar(&rulesExclude, "exclude", nil, "Never push keys matching this glob (repeatable)")
+	projectRulesSetCmd.Flags().StringVar(&rulesStripPrefix, "strip-prefix", "", "Remove this prefix from key names")
+	projectRulesSetCmd.Flags().StringVar(&rulesAddPrefix, "add-prefix", "", "Prepend this prefix to key names")
+	projectRulesSetCmd.Flags().StringArrayVar(&rulesRename, "rename", nil, "Push FROM as TO (repeatable; FROM= removes)")
+	projectRulesCmd.AddCommand(projectRulesShowCmd)
+	projectRulesCmd.AddCommand(projectRulesSetCmd)
+	projectRulesCmd.AddCommand(projectRulesClearCmd)
+	projectCmd.AddCommand(projectRulesCmd)
+}
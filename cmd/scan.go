@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	scanDepth  int
+	scanDryRun bool
+	scanYes    bool
+)
+
+var scanCmd = &cobra.Command{
+	Use:   "scan [dir]",
+	Short: "Find and register projects with a .env file",
+	Long: `Walk a directory tree and register every directory containing a .env
+file that is not registered yet. Names are derived from the git remote or
+the directory name. node_modules, vendor and .git directories are skipped.
+
+Examples:
+  autoenv scan ~/code --dry-run
+  autoenv scan ~/code --depth 3 --yes`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		b, err := bootstrap()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+			os.Exit(1)
+		}
+		defer b.cc.CloseAll()
+
+		found, known, err := b.app.Project.Discover(projectRef(args), scanDepth)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+			os.Exit(1)
+		}
+		if len(found) == 0 {
+			fmt.Printf("No new projects found (%d already registered).\n", known)
+			return
+		}
+
+		fmt.Printf("Found %d new project(s) (%d already registered):\n", len(found), known)
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, d := range found {
+			_, _ = fmt.Fprintf(w, "  %s\t%s\n", d.Name, d.Dir)
+		}
+		_ = w.Flush()
+
+		if scanDryRun {
+			return
+		}
+		if !scanYes && !confirm(fmt.Sprintf("Register %d project(s)?", len(found))) {
+			fmt.Fprintln(os.Stderr, "autoenv: scan cancelled")
+			os.Exit(1)
+		}
+
+		for _, d := range found {
+			p, err := b.app.Project.Register(d.Dir, "")
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "autoenv: %s: %v\n", d.Dir, err)
+				os.Exit(1)
+			}
+			fmt.Printf("Registered %s (%s)\n", p.Name, p.Path)
+		}
+	},
+}
+
+func init() {
+	scanCmd.Flags().IntVar(&scanDepth, "depth", 0, "Maximum directory depth to descend (0 for no limit)")
+	scanCmd.Flags().BoolVar(&scanDryRun, "dry-run", false, "Only list the projects that would be registered")
+	scanCmd.Flags().BoolVarP(&scanYes, "yes", "y", false, "Register without asking")
+	rootCmd.AddCommand(scanCmd)
+}
@@ -1,61 +1,403 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
 
 	"github.com/spf13/cobra"
+	"github.com/stormingluke/autoenv/internal/app"
+	"github.com/stormingluke/autoenv/internal/domain"
 )
 
-var syncDB bool
+var (
+	syncDB          bool
+	syncStatus      bool
+	syncKind        string
+	syncEnvironment string
+	syncVisibility  string
+	syncDryRun      bool
+	syncPrune       bool
+	syncForce       bool
+	syncAllProjects bool
+	syncProtected   bool
+	syncMasked      bool
+)
 
 var syncCmd = &cobra.Command{
-	Use:   "sync [target]",
+	Use:   "sync [target|name...]",
 	Short: "Sync secrets to external targets or force Turso DB sync",
-	Long: `Sync .env secrets to external targets like GitHub Actions.
+	Long: `Sync .env secrets to external targets like GitHub Actions, GitLab or Vault.
+
+With no arguments, syncs the current project to each of its named targets
+(see autoenv target). A name syncs to that saved target only; anything else
+is taken as a target. --all-projects syncs every registered project checked
+out on this machine, limited to the given target names if any.
+
+Targets:
+  github.com/owner/repo              repository Actions secrets
+  github.com/owner/repo@env:<name>   environment secrets
+  github.com/owner/repo@dependabot   Dependabot secrets (also @codespaces)
+  github.com/org                     organization secrets (see --visibility)
+  ghe.example.com/owner/repo         GitHub Enterprise (set AUTOENV_GITHUB_API_URL)
+  repo                               repository of github.default_owner
+  gitlab.com/group/project           GitLab project CI/CD variables
+  gitlab.com/group/sub@group         GitLab group CI/CD variables
+  gitlab.example.com/group/project   self-managed GitLab (set AUTOENV_GITLAB_URL)
+  vault://secret/data/myapp          Vault KV v2 secret (set VAULT_ADDR)
 
 Examples:
+  autoenv sync                                             # every named target
+  autoenv sync ci                                          # one named target
+  autoenv sync --all-projects                              # every project's targets
   autoenv sync github.com/stormingluke/stormingplatform   # full target
   autoenv sync stormingplatform                            # uses default owner
-  autoenv sync --db                                        # Turso cloud sync`,
+  autoenv sync stormingplatform@env:production
+  autoenv sync stormingplatform --kind variable            # Actions variables
+  autoenv sync github.com/acme --visibility all            # org-wide secrets
+  autoenv sync gitlab.com/acme/api@env:production --masked --protected
+  autoenv sync vault://secret/data/api                     # fields of one KV secret
+  autoenv sync stormingplatform --dry-run --prune          # preview, incl. deletions
+  autoenv sync --status                                    # which targets are out of date
+  autoenv sync --db                                        # Turso cloud sync
+  autoenv sync --db --status                               # last syncs and queued changes`,
 	Run: func(cmd *cobra.Command, args []string) {
-		b, err := bootstrap()
+		if syncStatus && len(args) > 0 {
+			fmt.Fprintln(os.Stderr, "autoenv: --status takes no targets; it lists every target this directory was synced with")
+			os.Exit(1)
+		}
+
+		open := bootstrap
+		if syncDB {
+			// Syncing anyway, so skip the automatic sync.
+			open = bootstrapNoAutoSync
+		}
+		b, err := open()
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
 			os.Exit(1)
 		}
 		defer b.cc.CloseAll()
 
+		if syncDB && syncStatus {
+			printDBSyncStatus(b)
+			return
+		}
 		if syncDB {
-			if err := b.turso.Sync(); err != nil {
-				fmt.Fprintf(os.Stderr, "autoenv: sync failed: %v\n", err)
-				os.Exit(1)
-			}
-			fmt.Println("Turso sync complete.")
+			runDBSync(b)
 			return
 		}
 
-		if len(args) == 0 {
-			fmt.Fprintln(os.Stderr, "autoenv: target required (e.g., autoenv sync github.com/owner/repo) or use --db for Turso sync")
+		cwd, err := os.Getwd()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
 			os.Exit(1)
 		}
+		if syncStatus {
+			printTargetStatus(b, cwd)
+			return
+		}
 
-		cwd, err := os.Getwd()
+		opts, err := syncOptions()
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
 			os.Exit(1)
 		}
 
-		if err := b.app.Sync.SyncSecrets(cwd, args[0]); err != nil {
+		// Ctrl-C stops starting new pushes; keys already pushed are kept
+		// in the ledger so the next run picks up where this one stopped.
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		if len(args) == 1 && !syncAllProjects {
+			result, err := b.app.Sync.SyncSecrets(ctx, cwd, args[0], opts)
+			if result != nil {
+				printSyncResult(result, err == nil)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "autoenv: sync failed: %v\n", interrupted(err))
+				os.Exit(1)
+			}
+			return
+		}
+
+		var results []app.TargetSyncResult
+		if syncAllProjects {
+			results, err = b.app.Sync.SyncAllProjects(ctx, args, opts)
+		} else {
+			results, err = b.app.Sync.SyncProject(ctx, cwd, args, opts)
+		}
+		if err == nil && len(results) == 0 {
+			err = fmt.Errorf("no registered project has a sync target; add one with: autoenv target add <name> <target>")
+		}
+		failed := 0
+		for i, r := range results {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("==> %s: %s\n", r.Project.Name, r.Name)
+			if r.Result != nil {
+				printSyncResult(r.Result, r.Err == nil)
+			}
+			if r.Err != nil {
+				failed++
+				fmt.Fprintf(os.Stderr, "autoenv: sync %s of %s failed: %v\n", r.Name, r.Project.Name, interrupted(r.Err))
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "autoenv: %v\n", interrupted(err))
+			os.Exit(1)
+		}
+		if failed > 0 {
+			fmt.Fprintf(os.Stderr, "autoenv: %d of %d target(s) failed\n", failed, len(results))
+			os.Exit(1)
+		}
+	},
+}
+
+// interrupted explains the error of a sync cut short by Ctrl-C.
+func interrupted(err error) error {
+	if errors.Is(err, context.Canceled) {
+		return errors.New("interrupted; run it again to push the remaining keys")
+	}
+	return err
+}
+
+// syncOptions returns the command-line overrides; unset ones keep a named
+// target's saved settings.
+func syncOptions() (app.SyncOptions, error) {
+	var err error
+	opts := app.SyncOptions{
+		Environment: syncEnvironment,
+		Protected:   syncProtected,
+		Masked:      syncMasked,
+		DryRun:      syncDryRun,
+		Prune:       syncPrune,
+		Force:       syncForce,
+	}
+	if syncKind != "" {
+		if opts.Kind, err = domain.ParseSecretKind(syncKind); err != nil {
+			return app.SyncOptions{}, err
+		}
+	}
+	if syncVisibility != "" {
+		if opts.Visibility, err = domain.ParseVisibility(syncVisibility); err != nil {
+			return app.SyncOptions{}, err
+		}
+	}
+	return opts, nil
+}
+
+// printTargetStatus compares the .env in dir with the values last pushed
+// to or pulled from each target, as recorded in the ledger. Targets are
+// not contacted.
+func printTargetStatus(b *bootstrapResult, dir string) {
+	statuses, err := b.app.Sync.Status(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+		os.Exit(1)
+	}
+	if len(statuses) == 0 {
+		fmt.Println("This directory has not been synced to any target.")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "TARGET\tSTATUS\tNEW\tCHANGED\tREMOVED\tLAST SYNC")
+	for _, st := range statuses {
+		state := "up to date"
+		if st.OutOfDate() {
+			state = "out of date"
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%s\n", st.Target, state,
+			domain.CountChanges(st.Changes, domain.ChangeAdded),
+			domain.CountChanges(st.Changes, domain.ChangeUpdated),
+			domain.CountChanges(st.Changes, domain.ChangeRemoteOnly),
+			st.LastPush)
+	}
+	_ = w.Flush()
+}
+
+// printSyncResult shows the planned or applied change for each key and,
+// once pushed, whether it made it. done is false for a dry run or a sync
+// that failed partway.
+func printSyncResult(r *app.SyncResult, done bool) {
+	what := "secrets"
+	if r.Target.Kind == domain.KindVariable {
+		what = "variables"
+	}
+
+	// Show where each key comes from when the sync rules renamed any.
+	local := make(map[string]string, len(r.Mappings))
+	renamed := false
+	for _, m := range r.Mappings {
+		local[m.Remote] = m.Local
+		renamed = renamed || m.Local != m.Remote
+	}
+	outcomes := make(map[string]domain.KeyResult, len(r.Outcomes))
+	for _, o := range r.Outcomes {
+		outcomes[o.Key] = o
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	header := []string{"KEY"}
+	if renamed {
+		header = append(header, "FROM")
+	}
+	header = append(header, "CHANGE")
+	if len(r.Outcomes) > 0 {
+		header = append(header, "RESULT")
+	}
+	_, _ = fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, c := range r.Changes {
+		row := []string{c.Key}
+		if renamed {
+			row = append(row, displayName(local[c.Key]))
+		}
+		row = append(row, string(c.Kind))
+		if len(r.Outcomes) > 0 {
+			row = append(row, outcomeText(outcomes, c.Key))
+		}
+		_, _ = fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	_ = w.Flush()
+	if len(r.Excluded) > 0 {
+		fmt.Printf("Excluded by sync rules: %s\n", strings.Join(r.Excluded, ", "))
+	}
+
+	// Count only the changes that were applied.
+	count := func(kind domain.ChangeKind) int {
+		n := 0
+		for _, c := range r.Changes {
+			if o, ok := outcomes[c.Key]; c.Kind == kind && (syncDryRun || !ok || o.Outcome == domain.KeyOK) {
+				n++
+			}
+		}
+		return n
+	}
+	added := count(domain.ChangeAdded)
+	updated := count(domain.ChangeUpdated)
+	unchanged := count(domain.ChangeUnchanged)
+	deleted := count(domain.ChangeDeleted)
+	failed := domain.CountOutcomes(r.Outcomes, domain.KeyFailed)
+	skipped := domain.CountOutcomes(r.Outcomes, domain.KeySkipped)
+	switch {
+	case syncDryRun:
+		fmt.Printf("\nDry run for %s %s: %d to create, %d to update, %d unchanged, %d to delete.\n", r.Target, what, added, updated, unchanged, deleted)
+	case done || failed+skipped > 0:
+		fmt.Printf("\nSynced %s to %s: %d created, %d updated, %d unchanged, %d deleted.\n", what, r.Target, added, updated, unchanged, deleted)
+	}
+	if failed+skipped > 0 {
+		fmt.Printf("%d key(s) failed and %d skipped; they are retried on the next sync.\n", failed, skipped)
+	}
+	if remoteOnly := domain.CountChanges(r.Changes, domain.ChangeRemoteOnly); remoteOnly > 0 {
+		fmt.Printf("%d remote-only key(s) left in place; use --prune to delete them.\n", remoteOnly)
+	}
+}
+
+func outcomeText(outcomes map[string]domain.KeyResult, key string) string {
+	o, ok := outcomes[key]
+	switch {
+	case !ok:
+		return "-"
+	case errors.Is(o.Err, context.Canceled):
+		return "interrupted"
+	case o.Outcome == domain.KeyFailed:
+		return "failed: " + o.Err.Error()
+	default:
+		return string(o.Outcome)
+	}
+}
+
+func runDBSync(b *bootstrapResult) {
+	r, err := b.app.DBSync.Sync()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "autoenv: sync failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	applied, err := b.flushOutbox()
+	if applied > 0 {
+		fmt.Printf("Applied %d change(s) queued while offline.\n", applied)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+		os.Exit(1)
+	}
+	if applied > 0 {
+		if r, err = b.app.DBSync.Sync(); err != nil {
 			fmt.Fprintf(os.Stderr, "autoenv: sync failed: %v\n", err)
 			os.Exit(1)
 		}
+	}
+	fmt.Printf("Turso sync complete (frame %d, %d frame(s) applied).\n", r.FrameNo, r.FramesSynced)
+}
 
-		fmt.Printf("Secrets synced to %s\n", args[0])
-	},
+func printDBSyncStatus(b *bootstrapResult) {
+	st, err := b.app.DBSync.Status(10)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+		os.Exit(1)
+	}
+	queued, err := b.outbox.Pending()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+		os.Exit(1)
+	}
+
+	switch {
+	case b.turso.Offline:
+		fmt.Printf("Turso:       offline (%v)\n", b.turso.OfflineErr)
+	case b.turso.Replicated():
+		fmt.Println("Turso:       connected")
+	default:
+		fmt.Println("Turso:       not configured")
+	}
+	if st.LastSuccess != nil {
+		fmt.Printf("Last sync:   %s (frame %d)\n", st.LastSuccess.At, st.LastSuccess.FrameNo)
+	} else {
+		fmt.Println("Last sync:   never")
+	}
+	if st.Interval > 0 {
+		fmt.Printf("Auto-sync:   every %s\n", st.Interval)
+	} else {
+		fmt.Printf("Auto-sync:   off (set %s)\n", domain.SyncIntervalKey)
+	}
+	fmt.Printf("Queued:      %d change(s)\n", queued)
+
+	if len(st.Recent) == 0 {
+		return
+	}
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "TIME\tRESULT\tFRAME\tAPPLIED")
+	for _, rec := range st.Recent {
+		result := "ok"
+		if !rec.OK() {
+			result = "error: " + rec.Error
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%d\t%d\n", rec.At, result, rec.FrameNo, rec.FramesSynced)
+	}
+	_ = w.Flush()
 }
 
 func init() {
 	syncCmd.Flags().BoolVar(&syncDB, "db", false, "Force Turso cloud database sync")
+	syncCmd.Flags().BoolVar(&syncStatus, "status", false, "Show which targets are out of date, or with --db the Turso sync history and queued changes")
+	syncCmd.Flags().StringVar(&syncKind, "kind", "", "Write values as secret (default) or variable (Actions only)")
+	syncCmd.Flags().StringVar(&syncEnvironment, "environment", "", "Repository environment or GitLab environment scope to write to (same as @env:<name>)")
+	syncCmd.Flags().BoolVar(&syncDryRun, "dry-run", false, "Show what would be created, updated or deleted without changing the target")
+	syncCmd.Flags().BoolVar(&syncForce, "force", false, "Push every key, even those unchanged since the last push")
+	syncCmd.Flags().BoolVar(&syncPrune, "prune", false, "Delete keys on the target that are not in the local .env")
+	syncCmd.Flags().StringVar(&syncVisibility, "visibility", "", "Organization secret visibility: all or private (default)")
+	syncCmd.Flags().BoolVar(&syncProtected, "protected", false, "Make GitLab variables available to protected branches and tags only")
+	syncCmd.Flags().BoolVar(&syncMasked, "masked", false, "Mask GitLab variable values in job logs")
+	syncCmd.Flags().BoolVar(&syncAllProjects, "all-projects", false, "Sync every registered project to its named targets")
+	syncCmd.Flags().SetNormalizeFunc(envFlagAlias)
 	rootCmd.AddCommand(syncCmd)
 }
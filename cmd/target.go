@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/stormingluke/autoenv/internal/domain"
+)
+
+var (
+	targetProject     string
+	targetEnvironment string
+	targetKind        string
+	targetVisibility  string
+	targetProtected   bool
+	targetMasked      bool
+)
+
+var targetCmd = &cobra.Command{
+	Use:   "target",
+	Short: "Manage a project's named sync targets",
+	Long: `Save sync targets on a project under short names, so that a bare
+autoenv sync pushes to all of them. Targets are stored in the project
+registry and synced with it.
+
+Examples:
+  autoenv target add ci github.com/acme/api --env staging
+  autoenv target add vars acme/api --kind variable
+  autoenv target add gl gitlab.com/acme/api --env production --masked
+  autoenv target add vault vault://secret/data/api
+  autoenv target add shared file://../shared/dev.env   # for autoenv pull
+  autoenv target list
+  autoenv target rm ci
+  autoenv sync              # every named target
+  autoenv sync ci           # one of them`,
+}
+
+var targetAddCmd = &cobra.Command{
+	Use:   "add <name> <target>",
+	Short: "Save a named sync target, replacing one of the same name",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		t := domain.NamedSyncTarget{
+			Name:        args[0],
+			Target:      args[1],
+			Environment: targetEnvironment,
+			Protected:   targetProtected,
+			Masked:      targetMasked,
+		}
+		var err error
+		if targetKind != "" {
+			if t.Kind, err = domain.ParseSecretKind(targetKind); err != nil {
+				fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		if targetVisibility != "" {
+			if t.Visibility, err = domain.ParseVisibility(targetVisibility); err != nil {
+				fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		b, err := bootstrap()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+			os.Exit(1)
+		}
+		defer b.cc.CloseAll()
+
+		p, err := b.app.Project.AddSyncTarget(projectRef(optionalArg(targetProject)), t)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Added target %s to %s\n", t.Name, p.Name)
+	},
+}
+
+var targetRmCmd = &cobra.Command{
+	Use:     "rm <name>",
+	Aliases: []string{"remove"},
+	Short:   "Remove a named sync target",
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		b, err := bootstrap()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+			os.Exit(1)
+		}
+		defer b.cc.CloseAll()
+
+		p, err := b.app.Project.RemoveSyncTarget(projectRef(optionalArg(targetProject)), args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Removed target %s from %s\n", args[0], p.Name)
+	},
+}
+
+var targetListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "List a project's named sync targets",
+	Args:    cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		b, err := bootstrap()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+			os.Exit(1)
+		}
+		defer b.cc.CloseAll()
+
+		p, targets, err := b.app.Project.SyncTargets(projectRef(optionalArg(targetProject)))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "autoenv: %v\n", err)
+			os.Exit(1)
+		}
+		if len(targets) == 0 {
+			fmt.Printf("%s has no sync targets.\n", p.Name)
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "NAME\tTARGET\tENVIRONMENT\tKIND\tVISIBILITY\tATTRIBUTES")
+		for _, t := range targets {
+			var attrs []string
+			if t.Protected {
+				attrs = append(attrs, "protected")
+			}
+			if t.Masked {
+				attrs = append(attrs, "masked")
+			}
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", t.Name, t.Target,
+				displayName(t.Environment), displayName(string(t.Kind)), displayName(string(t.Visibility)),
+				displayName(strings.Join(attrs, ",")))
+		}
+		_ = w.Flush()
+	},
+}
+
+// envFlagAlias accepts --env for --environment.
+func envFlagAlias(f *pflag.FlagSet, name string) pflag.NormalizedName {
+	if name == "env" {
+		name = "environment"
+	}
+	return pflag.NormalizedName(name)
+}
+
+func init() {
+	targetCmd.PersistentFlags().StringVarP(&targetProject, "project", "p", "", "Project path or name (defaults to current directory)")
+	targetAddCmd.Flags().StringVar(&targetEnvironment, "environment", "", "Repository environment or GitLab environment scope to write to (same as @env:<name>)")
+	targetAddCmd.Flags().StringVar(&targetKind, "kind", "", "Write values as secret (default) or variable (Actions only)")
+	targetAddCmd.Flags().StringVar(&targetVisibility, "visibility", "", "Organization secret visibility: all or private (default)")
+	targetAddCmd.Flags().BoolVar(&targetProtected, "protected", false, "Make GitLab variables available to protected branches and tags only")
+	targetAddCmd.Flags().BoolVar(&targetMasked, "masked", false, "Mask GitLab variable values in job logs")
+	targetAddCmd.Flags().SetNormalizeFunc(envFlagAlias)
+	targetCmd.AddCommand(targetAddCmd)
+	targetCmd.AddCommand(targetRmCmd)
+	targetCmd.AddCommand(targetListCmd)
+	rootCmd.AddCommand(targetCmd)
+}
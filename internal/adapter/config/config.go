@@ -1,32 +1,242 @@
 package config
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
+// Config locates autoenv's files. Dir holds configuration and the synced
+// project registry; StateDir holds local data that must survive a reboot;
+// RuntimeDir holds per-shell session state, ideally on tmpfs.
 type Config struct {
 	Dir            string
+	StateDir       string
+	RuntimeDir     string
 	ProjectsDBPath string
 	SessionsDBPath string
-	TursoURL       string
-	TursoAuthToken string
+	StateDBPath    string
+	// LegacySessionsDBPath is where versions before the state/runtime
+	// split kept sessions.db.
+	LegacySessionsDBPath string
+	TursoURL             string
+	TursoAuthToken       string
+	// KeyFile holds the database encryption key; a passphrase in
+	// AUTOENV_DB_PASSPHRASE takes precedence over it.
+	KeyFile    string
+	Passphrase string
+	// GitHubAPIURL and GitHubToken configure secret sync; both may be
+	// empty, in which case github.com and the gh CLI's login are used.
+	GitHubAPIURL string
+	GitHubToken  string
+	// GitLabURL and GitLabToken do the same for GitLab; GitLabURL is the
+	// instance's web URL and defaults to gitlab.com.
+	GitLabURL   string
+	GitLabToken string
+	// VaultAddr, VaultNamespace and VaultToken fall back to the vault
+	// CLI's settings; a VaultRoleID logs in with AppRole instead.
+	VaultAddr      string
+	VaultNamespace string
+	VaultToken     string
+	VaultRoleID    string
+	VaultSecretID  string
 }
 
 func Load() *Config {
 	dir := configDir()
+	state := stateDir()
+	runtime := runtimeDir(state)
 
 	return &Config{
-		Dir:            dir,
-		ProjectsDBPath: filepath.Join(dir, "projects.db"),
-		SessionsDBPath: filepath.Join(dir, "sessions.db"),
-		TursoURL:       os.Getenv("AUTOENV_TURSO_DATABASE_URL"),
-		TursoAuthToken: os.Getenv("AUTOENV_TURSO_AUTH_TOKEN"),
+		Dir:                  dir,
+		StateDir:             state,
+		RuntimeDir:           runtime,
+		ProjectsDBPath:       filepath.Join(dir, "projects.db"),
+		SessionsDBPath:       filepath.Join(runtime, "sessions.db"),
+		StateDBPath:          filepath.Join(state, "state.db"),
+		LegacySessionsDBPath: filepath.Join(dir, "sessions.db"),
+		TursoURL:             os.Getenv("AUTOENV_TURSO_DATABASE_URL"),
+		TursoAuthToken:       os.Getenv("AUTOENV_TURSO_AUTH_TOKEN"),
+		KeyFile:              keyFile(dir),
+		Passphrase:           os.Getenv("AUTOENV_DB_PASSPHRASE"),
+		GitHubAPIURL:         os.Getenv("AUTOENV_GITHUB_API_URL"),
+		GitHubToken:          os.Getenv("AUTOENV_GITHUB_TOKEN"),
+		GitLabURL:            os.Getenv("AUTOENV_GITLAB_URL"),
+		GitLabToken:          os.Getenv("AUTOENV_GITLAB_TOKEN"),
+		VaultAddr:            os.Getenv("AUTOENV_VAULT_ADDR"),
+		VaultNamespace:       os.Getenv("AUTOENV_VAULT_NAMESPACE"),
+		VaultToken:           os.Getenv("AUTOENV_VAULT_TOKEN"),
+		VaultRoleID:          os.Getenv("AUTOENV_VAULT_ROLE_ID"),
+		VaultSecretID:        os.Getenv("AUTOENV_VAULT_SECRET_ID"),
 	}
 }
 
+// EnsureDir creates the config, state and runtime directories private to
+// the user, tightening directories created by older versions.
 func (c *Config) EnsureDir() error {
-	return os.MkdirAll(c.Dir, 0o750)
+	for _, dir := range []string{c.Dir, c.StateDir, c.RuntimeDir} {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return err
+		}
+		if err := os.Chmod(dir, 0o700); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EncryptionKey returns the key the local databases are encrypted with,
+// or "" when encryption is off.
+func (c *Config) EncryptionKey() (string, error) {
+	if c.Passphrase != "" {
+		return c.Passphrase, nil
+	}
+	info, err := os.Stat(c.KeyFile)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("read key file: %w", err)
+	}
+	if info.Mode().Perm()&0o077 != 0 {
+		return "", fmt.Errorf("key file %s is accessible by other users (run chmod 600 %s)", c.KeyFile, c.KeyFile)
+	}
+	data, err := os.ReadFile(c.KeyFile)
+	if err != nil {
+		return "", fmt.Errorf("read key file: %w", err)
+	}
+	key := strings.TrimSpace(string(data))
+	if key == "" {
+		return "", fmt.Errorf("key file %s is empty", c.KeyFile)
+	}
+	return key, nil
+}
+
+// NewKey generates a random key suitable for the key file.
+func NewKey() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate key: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// WriteKeyFile replaces the key file atomically with mode 0600.
+func (c *Config) WriteKeyFile(key string) error {
+	tmp := c.KeyFile + ".tmp"
+	if err := os.WriteFile(tmp, []byte(key+"\n"), 0o600); err != nil {
+		return fmt.Errorf("write key file: %w", err)
+	}
+	if err := os.Rename(tmp, c.KeyFile); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("write key file: %w", err)
+	}
+	return nil
+}
+
+func (c *Config) RemoveKeyFile() error {
+	if err := os.Remove(c.KeyFile); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove key file: %w", err)
+	}
+	return nil
+}
+
+// DeviceID returns the random identifier of this installation, creating
+// it on first use. It keys per-machine rows in the synced registry.
+func (c *Config) DeviceID() (string, error) {
+	path := filepath.Join(c.Dir, "device-id")
+	data, err := os.ReadFile(path)
+	if err == nil {
+		if id := strings.TrimSpace(string(data)); id != "" {
+			return id, nil
+		}
+	} else if !os.IsNotExist(err) {
+		return "", fmt.Errorf("read device id: %w", err)
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate device id: %w", err)
+	}
+	id := hex.EncodeToString(buf)
+	if err := os.WriteFile(path, []byte(id+"\n"), 0o600); err != nil {
+		return "", fmt.Errorf("write device id: %w", err)
+	}
+	return id, nil
+}
+
+// HashKey returns the per-install key used to hash secret values,
+// creating it on first use.
+func (c *Config) HashKey() ([]byte, error) {
+	path := filepath.Join(c.Dir, "hash.key")
+	data, err := os.ReadFile(path)
+	if err == nil {
+		if key, err := hex.DecodeString(strings.TrimSpace(string(data))); err == nil && len(key) >= 32 {
+			return key, nil
+		}
+		return nil, fmt.Errorf("hash key %s is malformed; delete it to generate a new one", path)
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("read hash key: %w", err)
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("generate hash key: %w", err)
+	}
+	// Publish with a link so concurrent shells agree on a single key.
+	tmp, err := os.CreateTemp(c.Dir, ".hash.key-*")
+	if err != nil {
+		return nil, fmt.Errorf("write hash key: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	_, err = tmp.WriteString(hex.EncodeToString(key) + "\n")
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("write hash key: %w", err)
+	}
+	if err := os.Link(tmp.Name(), path); err != nil {
+		if os.IsExist(err) {
+			return c.HashKey()
+		}
+		return nil, fmt.Errorf("write hash key: %w", err)
+	}
+	return key, nil
+}
+
+func keyFile(dir string) string {
+	if f := os.Getenv("AUTOENV_DB_KEY_FILE"); f != "" {
+		return f
+	}
+	return filepath.Join(dir, "db.key")
+}
+
+func stateDir() string {
+	if d := os.Getenv("AUTOENV_STATE_DIR"); d != "" {
+		return d
+	}
+	if d := os.Getenv("XDG_STATE_HOME"); d != "" {
+		return filepath.Join(d, "autoenv")
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".local", "state", "autoenv")
+}
+
+// runtimeDir prefers $XDG_RUNTIME_DIR, which is per-user and cleared on
+// reboot. Systems without one (such as macOS) use the state directory.
+func runtimeDir(state string) string {
+	if d := os.Getenv("AUTOENV_RUNTIME_DIR"); d != "" {
+		return d
+	}
+	if d := os.Getenv("XDG_RUNTIME_DIR"); d != "" {
+		return filepath.Join(d, "autoenv")
+	}
+	return state
 }
 
 func configDir() string {
@@ -0,0 +1,243 @@
+package envfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"github.com/stormingluke/autoenv/internal/port"
+)
+
+var _ port.EnvWriter = (*Writer)(nil)
+
+// Writer updates .env files in place. Keys that already exist are
+// rewritten on their original lines, every occurrence of a duplicated key
+// included, keeping any `export` prefix, the `=` or `:` separator and a
+// trailing comment, and lines that already hold the new value are left as
+// they are; new keys are appended. Every other line, including
+// comments and blank lines, is preserved byte for byte, and each line
+// keeps its own ending, so a CRLF file stays CRLF.
+type Writer struct{}
+
+func NewWriter() *Writer {
+	return &Writer{}
+}
+
+var assignmentRe = regexp.MustCompile(`^(\s*(?:export\s+)?)([A-Za-z_][A-Za-z0-9_.\-]*)(\s*[=:]\s*)`)
+
+var bareValueRe = regexp.MustCompile(`^[A-Za-z0-9_./:@%+,=\-]*$`)
+
+type envLine struct {
+	text   string
+	key    string
+	prefix string
+	sep    string
+	suffix string
+	eol    string
+}
+
+func (w *Writer) Merge(projectPath string, values map[string]string) error {
+	envPath := filepath.Join(projectPath, ".env")
+
+	mode := os.FileMode(0o600)
+	data, err := os.ReadFile(envPath)
+	switch {
+	case err == nil:
+		if info, statErr := os.Stat(envPath); statErr == nil {
+			mode = info.Mode().Perm()
+		}
+	case os.IsNotExist(err):
+	default:
+		return fmt.Errorf("read %s: %w", envPath, err)
+	}
+
+	lines, eol := parseLines(string(data))
+
+	remaining := make(map[string]string, len(values))
+	for k, v := range values {
+		remaining[k] = v
+	}
+
+	// godotenv keeps the last of duplicated keys, so all are rewritten.
+	for i := range lines {
+		l := &lines[i]
+		v, ok := values[l.key]
+		if l.key == "" || !ok {
+			continue
+		}
+		delete(remaining, l.key)
+		// A line that already holds the value keeps its own quoting.
+		if current, err := godotenv.Unmarshal(l.text); err == nil && current[l.key] == v {
+			continue
+		}
+		quoted, err := quoteValue(l.key, v)
+		if err != nil {
+			return err
+		}
+		l.text = l.prefix + l.key + l.sep + quoted + l.suffix
+	}
+
+	keys := make([]string, 0, len(remaining))
+	for k := range remaining {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, l := range lines {
+		b.WriteString(l.text)
+		b.WriteString(l.eol)
+	}
+	if len(keys) > 0 && len(lines) > 0 && lines[len(lines)-1].eol == "" {
+		b.WriteString(eol)
+	}
+	for _, k := range keys {
+		quoted, err := quoteValue(k, remaining[k])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&b, "%s=%s%s", k, quoted, eol)
+	}
+
+	return writeAtomic(envPath, []byte(b.String()), mode)
+}
+
+// parseLines splits an env file into logical lines. A quoted value that
+// spans several physical lines is kept together as one entry. Each entry
+// carries the ending of its last physical line; the ending of the first
+// line is returned as the one for appended keys.
+func parseLines(content string) ([]envLine, string) {
+	if content == "" {
+		return nil, "\n"
+	}
+	var physical, endings []string
+	for _, raw := range strings.SplitAfter(content, "\n") {
+		if raw == "" {
+			continue
+		}
+		text := strings.TrimSuffix(raw, "\n")
+		if len(text) < len(raw) {
+			text = strings.TrimSuffix(text, "\r")
+		}
+		physical = append(physical, text)
+		endings = append(endings, raw[len(text):])
+	}
+	eol := "\n"
+	if endings[0] != "" {
+		eol = endings[0]
+	}
+
+	var lines []envLine
+	for i := 0; i < len(physical); i++ {
+		line := physical[i]
+		m := assignmentRe.FindStringSubmatch(line)
+		if m == nil || strings.HasPrefix(strings.TrimSpace(line), "#") {
+			lines = append(lines, envLine{text: line, eol: endings[i]})
+			continue
+		}
+
+		rest := line[len(m[0]):]
+		entry := envLine{text: line, key: m[2], prefix: m[1], sep: m[3], eol: endings[i]}
+
+		if rest != "" && (rest[0] == '"' || rest[0] == '\'') {
+			quote := rest[0]
+			joined := rest
+			end := closingQuote(joined, quote)
+			j := i
+			for end < 0 && j+1 < len(physical) {
+				j++
+				joined += "\n" + physical[j]
+				end = closingQuote(joined, quote)
+			}
+			if end < 0 {
+				// Unterminated quote: leave the remainder untouched.
+				lines = append(lines, envLine{text: line, eol: endings[i]})
+				continue
+			}
+			var text strings.Builder
+			for k := i; k < j; k++ {
+				text.WriteString(physical[k] + endings[k])
+			}
+			text.WriteString(physical[j])
+			entry.text = text.String()
+			entry.suffix = joined[end+1:]
+			entry.eol = endings[j]
+			i = j
+		} else if idx := strings.Index(rest, " #"); idx >= 0 {
+			entry.suffix = rest[idx:]
+		}
+
+		lines = append(lines, entry)
+	}
+	return lines, eol
+}
+
+// closingQuote finds the quote ending a value that starts with one. A
+// quote is escaped by an odd number of backslashes before it; with an even
+// number, the backslashes escape each other.
+func closingQuote(s string, quote byte) int {
+	for i := 1; i < len(s); i++ {
+		if s[i] != quote {
+			continue
+		}
+		n := 0
+		for j := i - 1; j > 0 && s[j] == '\\'; j-- {
+			n++
+		}
+		if n%2 == 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+var doubleQuoteEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, `$`, `\$`)
+
+// quoteValue picks the simplest quoting godotenv reads back verbatim and
+// verifies the round trip, since some values (for example ones ending in
+// a double quote) cannot be expressed in godotenv's dialect.
+func quoteValue(key, value string) (string, error) {
+	var quoted string
+	switch {
+	case bareValueRe.MatchString(value):
+		quoted = value
+	case !strings.ContainsAny(value, "'\n\r"):
+		quoted = "'" + value + "'"
+	default:
+		quoted = `"` + doubleQuoteEscaper.Replace(value) + `"`
+	}
+
+	parsed, err := godotenv.Unmarshal(key + "=" + quoted)
+	if err != nil || parsed[key] != value {
+		return "", fmt.Errorf("value of %s cannot be represented in a .env file", key)
+	}
+	return quoted, nil
+}
+
+func writeAtomic(path string, data []byte, mode os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".env.tmp-*")
+	if err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	return nil
+}
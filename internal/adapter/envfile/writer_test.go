@@ -0,0 +1,170 @@
+package envfile
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name   string
+		before string
+		values map[string]string
+		after  string
+	}{
+		{
+			name:   "new file",
+			values: map[string]string{"B": "2", "A": "1"},
+			after:  "A=1\nB=2\n",
+		},
+		{
+			name:   "comments and blank lines",
+			before: "# api settings\n\nA=1 # the first\n#B=commented\n",
+			values: map[string]string{"A": "one", "B": "2"},
+			after:  "# api settings\n\nA=one # the first\n#B=commented\nB=2\n",
+		},
+		{
+			name:   "export prefix and colon separator",
+			before: "export A=1\n  export B : 2\n",
+			values: map[string]string{"A": "x y", "B": "3"},
+			after:  "export A='x y'\n  export B : 3\n",
+		},
+		{
+			name:   "duplicate keys",
+			before: "A=1\nB=2\nA=3\n",
+			values: map[string]string{"A": "4"},
+			after:  "A=4\nB=2\nA=4\n",
+		},
+		{
+			name:   "quoted multi-line value",
+			before: "A=\"line one\nline two\" # note\nB=2\n",
+			values: map[string]string{"A": "single"},
+			after:  "A=single # note\nB=2\n",
+		},
+		{
+			name:   "escaped quote in a multi-line value",
+			before: "A=\"say \\\"hi\nthere\\\"\"\nB=2\n",
+			values: map[string]string{"B": "3"},
+			after:  "A=\"say \\\"hi\nthere\\\"\"\nB=3\n",
+		},
+		{
+			name:   "value needing double quotes",
+			before: "A=1\n",
+			values: map[string]string{"A": "it's\n$HOME"},
+			after:  "A=\"it's\\n\\$HOME\"\n",
+		},
+		{
+			name:   "CRLF",
+			before: "# api\r\nA=1\r\nB=\"x\r\ny\"\r\n",
+			values: map[string]string{"A": "2", "C": "3"},
+			after:  "# api\r\nA=2\r\nB=\"x\r\ny\"\r\nC=3\r\n",
+		},
+		{
+			name:   "CRLF multi-line value rewritten",
+			before: "B=\"x\r\ny\" # note\r\nA=1\r\n",
+			values: map[string]string{"B": "z"},
+			after:  "B=z # note\r\nA=1\r\n",
+		},
+		{
+			name:   "no final newline",
+			before: "A=1",
+			values: map[string]string{"B": "2"},
+			after:  "A=1\nB=2\n",
+		},
+		{
+			name:   "unterminated quote",
+			before: "A=\"open\nB=2\n",
+			values: map[string]string{"B": "3"},
+			after:  "A=\"open\nB=3\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if tt.before != "" {
+				writeEnv(t, dir, tt.before)
+			}
+			if err := NewWriter().Merge(dir, tt.values); err != nil {
+				t.Fatal(err)
+			}
+			if got := readEnv(t, dir); got != tt.after {
+				t.Errorf("got\n%q\nwant\n%q", got, tt.after)
+			}
+		})
+	}
+}
+
+// Merging values a file already holds, or none at all, leaves it
+// byte-identical.
+func TestMergeRoundTrip(t *testing.T) {
+	files := []string{
+		"",
+		"A=1",
+		"# comment\n\nexport A=1 # trailing\nB : two\nA=1\n",
+		"A=\"multi\nline\"\r\nB='single quoted'\r\n\r\n",
+		"A=1\r\nB=2\n",
+	}
+	for _, before := range files {
+		dir := t.TempDir()
+		writeEnv(t, dir, before)
+		values, err := NewLoader().Load(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range []map[string]string{nil, maps.Clone(values.Values)} {
+			if err := NewWriter().Merge(dir, v); err != nil {
+				t.Fatal(err)
+			}
+			if got := readEnv(t, dir); got != before {
+				t.Errorf("merging %v:\ngot  %q\nwant %q", v, got, before)
+			}
+		}
+	}
+}
+
+func TestMergeKeepsTheFileMode(t *testing.T) {
+	dir := t.TempDir()
+	writeEnv(t, dir, "A=1\n")
+	if err := os.Chmod(filepath.Join(dir, ".env"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewWriter().Merge(dir, map[string]string{"A": "2"}); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filepath.Join(dir, ".env"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o640 {
+		t.Errorf("mode = %v, want 0640", info.Mode().Perm())
+	}
+}
+
+func TestMergeRejectsUnrepresentableValues(t *testing.T) {
+	dir := t.TempDir()
+	writeEnv(t, dir, "A=1\n")
+	if err := NewWriter().Merge(dir, map[string]string{"A": `ends in a quote'"`}); err == nil {
+		t.Fatal("Merge accepted a value godotenv cannot read back")
+	}
+	if got := readEnv(t, dir); got != "A=1\n" {
+		t.Errorf("file changed to %q", got)
+	}
+}
+
+func writeEnv(t *testing.T, dir, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, ".env"), []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readEnv(t *testing.T, dir string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, ".env"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
@@ -0,0 +1,90 @@
+package format
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/stormingluke/autoenv/internal/port"
+	"gopkg.in/yaml.v3"
+)
+
+var _ port.EnvParser = (*Compose)(nil)
+
+// Compose reads the environment: block of a docker-compose service. Both
+// the mapping and the KEY=value list forms are supported. Entries without
+// a value are passed through from the host shell by compose and are
+// skipped here.
+type Compose struct {
+	service string
+}
+
+func NewCompose(service string) *Compose {
+	return &Compose{service: service}
+}
+
+func (f *Compose) Parse(data []byte) (map[string]string, error) {
+	var file struct {
+		Services map[string]struct {
+			Environment yaml.Node `yaml:"environment"`
+		} `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse compose file: %w", err)
+	}
+
+	name := f.service
+	if name == "" {
+		var withEnv []string
+		for n, svc := range file.Services {
+			if svc.Environment.Kind != 0 {
+				withEnv = append(withEnv, n)
+			}
+		}
+		sort.Strings(withEnv)
+		switch len(withEnv) {
+		case 0:
+			return nil, fmt.Errorf("compose file has no service with an environment block")
+		case 1:
+			name = withEnv[0]
+		default:
+			return nil, fmt.Errorf("compose file has several services with an environment block (%s); choose one with --service", strings.Join(withEnv, ", "))
+		}
+	}
+
+	svc, ok := file.Services[name]
+	if !ok {
+		return nil, fmt.Errorf("compose service %q not found", name)
+	}
+
+	env := &svc.Environment
+	switch env.Kind {
+	case 0:
+		return map[string]string{}, nil
+	case yaml.MappingNode:
+		values := make(map[string]string, len(env.Content)/2)
+		for i := 0; i+1 < len(env.Content); i += 2 {
+			key, value := env.Content[i], env.Content[i+1]
+			if value.Kind != yaml.ScalarNode {
+				return nil, fmt.Errorf("line %d: value of %s is not a scalar", value.Line, key.Value)
+			}
+			if value.Tag == "!!null" {
+				continue
+			}
+			values[key.Value] = value.Value
+		}
+		return values, nil
+	case yaml.SequenceNode:
+		values := make(map[string]string, len(env.Content))
+		for _, item := range env.Content {
+			key, value, ok := strings.Cut(item.Value, "=")
+			if !ok {
+				continue
+			}
+			values[key] = value
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("line %d: environment must be a mapping or a list", env.Line)
+	}
+}
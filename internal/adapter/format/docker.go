@@ -0,0 +1,31 @@
+package format
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/stormingluke/autoenv/internal/port"
+)
+
+var _ port.EnvFormatter = (*Docker)(nil)
+
+// Docker renders a file for `docker run --env-file`. Docker reads each
+// line verbatim with no quoting or escaping, so values spanning multiple
+// lines cannot be represented and are rejected rather than truncated.
+type Docker struct{}
+
+func NewDocker() *Docker {
+	return &Docker{}
+}
+
+func (f *Docker) Format(vars map[string]string) (string, error) {
+	var b strings.Builder
+	for _, k := range sortedKeys(vars) {
+		v := vars[k]
+		if strings.ContainsAny(v, "\n\r\x00") {
+			return "", fmt.Errorf("docker env-file cannot represent value of %s: contains a newline or NUL byte", k)
+		}
+		fmt.Fprintf(&b, "%s=%s\n", k, v)
+	}
+	return b.String(), nil
+}
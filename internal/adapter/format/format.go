@@ -0,0 +1,104 @@
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/stormingluke/autoenv/internal/port"
+	"gopkg.in/yaml.v3"
+)
+
+// Options carries the metadata some formats need beyond the variables
+// themselves, such as the object name of a Kubernetes manifest or the
+// docker-compose service to read from.
+type Options struct {
+	Name      string
+	Namespace string
+	Service   string
+}
+
+var formats = map[string]func(Options) port.EnvFormatter{
+	"json":          func(Options) port.EnvFormatter { return NewJSON() },
+	"yaml":          func(Options) port.EnvFormatter { return NewYAML() },
+	"docker":        func(Options) port.EnvFormatter { return NewDocker() },
+	"systemd":       func(Options) port.EnvFormatter { return NewSystemd() },
+	"k8s-secret":    func(o Options) port.EnvFormatter { return NewKubernetes(KindSecret, o.Name, o.Namespace) },
+	"k8s-configmap": func(o Options) port.EnvFormatter { return NewKubernetes(KindConfigMap, o.Name, o.Namespace) },
+	"github-env":    func(Options) port.EnvFormatter { return NewGitHubEnv() },
+}
+
+func New(name string, opts Options) (port.EnvFormatter, error) {
+	f, ok := formats[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported format: %s (supported: %s)", name, strings.Join(Names(), ", "))
+	}
+	return f(opts), nil
+}
+
+func Names() []string {
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var parsers = map[string]func(Options) port.EnvParser{
+	"json":    func(Options) port.EnvParser { return NewJSON() },
+	"yaml":    func(Options) port.EnvParser { return NewYAML() },
+	"compose": func(o Options) port.EnvParser { return NewCompose(o.Service) },
+	"k8s":     func(o Options) port.EnvParser { return NewKubernetes(KindSecret, o.Name, o.Namespace) },
+}
+
+func NewParser(name string, opts Options) (port.EnvParser, error) {
+	f, ok := parsers[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported import format: %s (supported: %s)", name, strings.Join(ParserNames(), ", "))
+	}
+	return f(opts), nil
+}
+
+func ParserNames() []string {
+	names := make([]string, 0, len(parsers))
+	for name := range parsers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Detect guesses the parser for data by its shape: JSON objects, compose
+// files with a services block, Kubernetes manifests with a kind, and
+// otherwise a flat YAML mapping.
+func Detect(data []byte) string {
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		return "json"
+	}
+
+	var probe struct {
+		Kind     string         `yaml:"kind"`
+		Services map[string]any `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(data, &probe); err == nil {
+		switch {
+		case probe.Services != nil:
+			return "compose"
+		case probe.Kind == KindSecret || probe.Kind == KindConfigMap:
+			return "k8s"
+		}
+	}
+	return "yaml"
+}
+
+func sortedKeys(vars map[string]string) []string {
+	keys := make([]string, 0, len(vars))
+	for k := range vars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
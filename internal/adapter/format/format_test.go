@@ -0,0 +1,216 @@
+package format
+
+import (
+	"maps"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	vars := map[string]string{
+		"B_PLAIN": "value",
+		"A_EMPTY": "",
+		"C_QUOTE": `say "hi" $HOME \ ` + "`id`",
+		"D_YAML":  "yes",
+	}
+	tests := []struct {
+		format string
+		opts   Options
+		vars   map[string]string
+		want   string
+	}{
+		{"json", Options{}, vars, `{
+  "A_EMPTY": "",
+  "B_PLAIN": "value",
+  "C_QUOTE": "say \"hi\" $HOME \\ ` + "`id`" + `",
+  "D_YAML": "yes"
+}
+`},
+		{"json", Options{}, nil, "{}\n"},
+		{"yaml", Options{}, vars, `"A_EMPTY": ""
+"B_PLAIN": "value"
+"C_QUOTE": "say \"hi\" $HOME \\ ` + "`id`" + `"
+"D_YAML": "yes"
+`},
+		{"yaml", Options{}, map[string]string{"MODE": "0755", "NIL": "null", "LINES": "a\nb"}, `"LINES": "a\nb"
+"MODE": "0755"
+"NIL": "null"
+`},
+		{"yaml", Options{}, nil, "{}\n"},
+		{"docker", Options{}, vars, "A_EMPTY=\nB_PLAIN=value\nC_QUOTE=say \"hi\" $HOME \\ `id`\nD_YAML=yes\n"},
+		{"systemd", Options{}, vars, "A_EMPTY=\"\"\nB_PLAIN=\"value\"\nC_QUOTE=\"say \\\"hi\\\" \\$HOME \\\\ \\`id\\`\"\nD_YAML=\"yes\"\n"},
+		{"systemd", Options{}, map[string]string{"LINES": "a\nb"}, "LINES=\"a\nb\"\n"},
+		{"k8s-secret", Options{Name: "api", Namespace: "prod"}, map[string]string{"TOKEN": "s3cr3t", "EMPTY": ""}, `apiVersion: v1
+kind: Secret
+metadata:
+  name: "api"
+  namespace: "prod"
+type: Opaque
+data:
+  "EMPTY": ""
+  "TOKEN": "czNjcjN0"
+`},
+		{"k8s-secret", Options{Name: "api"}, nil, `apiVersion: v1
+kind: Secret
+metadata:
+  name: "api"
+type: Opaque
+data: {}
+`},
+		{"k8s-configmap", Options{Name: "api"}, map[string]string{"PORT": "8080"}, `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: "api"
+data:
+  "PORT": "8080"
+`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			f, err := New(tt.format, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := f.Format(tt.vars)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatRejects(t *testing.T) {
+	tests := []struct {
+		format string
+		opts   Options
+		vars   map[string]string
+		want   string
+	}{
+		{"docker", Options{}, map[string]string{"A": "a\nb"}, "value of A"},
+		{"docker", Options{}, map[string]string{"A": "a\rb"}, "value of A"},
+		{"docker", Options{}, map[string]string{"A": "a\x00b"}, "value of A"},
+		{"k8s-secret", Options{}, map[string]string{"A": "1"}, "requires a name"},
+		{"k8s-configmap", Options{}, map[string]string{"A": "1"}, "requires a name"},
+	}
+	for _, tt := range tests {
+		f, err := New(tt.format, tt.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := f.Format(tt.vars); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: Format(%q) = %q, %v; want an error about %s", tt.format, tt.vars, got, err, tt.want)
+		}
+	}
+	if _, err := New("toml", Options{}); err == nil {
+		t.Error("New accepted an unknown format")
+	}
+}
+
+var heredocStart = regexp.MustCompile(`^([A-Z_]+)<<(ghadelimiter_[0-9a-f]{32})\n`)
+
+// Every value is a heredoc closed by a random delimiter of its own, so
+// even a value spanning lines cannot end its block early.
+func TestGitHubEnv(t *testing.T) {
+	vars := map[string]string{
+		"A": "one",
+		"B": "multi\nline\nEOF",
+		"C": "",
+	}
+	out, err := NewGitHubEnv().Format(vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	delims := map[string]bool{}
+	for rest := out; rest != ""; {
+		m := heredocStart.FindStringSubmatch(rest)
+		if m == nil {
+			t.Fatalf("not a heredoc: %q", rest)
+		}
+		key, delim := m[1], m[2]
+		value, after, ok := strings.Cut(rest[len(m[0]):], "\n"+delim+"\n")
+		if !ok {
+			t.Fatalf("%s: block never closed by %s", key, delim)
+		}
+		got[key] = value
+		delims[delim] = true
+		rest = after
+	}
+	if !maps.Equal(got, vars) {
+		t.Errorf("values = %q, want %q", got, vars)
+	}
+	if len(delims) != len(vars) {
+		t.Errorf("%d delimiters for %d values, want one each", len(delims), len(vars))
+	}
+}
+
+// Parsers read back what the formatters write.
+func TestParseRoundTrip(t *testing.T) {
+	vars := map[string]string{"MODE": "0755", "FLAG": "yes", "EMPTY": "", "LINES": "a\nb", "QUOTE": `"x"`}
+	for _, name := range []string{"json", "yaml", "k8s-secret", "k8s-configmap"} {
+		f, err := New(name, Options{Name: "api"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := f.Format(vars)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parser := strings.TrimSuffix(strings.TrimSuffix(name, "-secret"), "-configmap")
+		if detected := Detect([]byte(out)); detected != parser {
+			t.Errorf("%s: Detect = %s", name, detected)
+		}
+		p, err := NewParser(parser, Options{Name: "api"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := p.Parse([]byte(out))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !maps.Equal(got, vars) {
+			t.Errorf("%s: parsed %q, want %q", name, got, vars)
+		}
+	}
+}
+
+func TestParseCompose(t *testing.T) {
+	data := []byte(`services:
+  web:
+    image: nginx
+  api:
+    environment:
+      PORT: 8080
+      MODE: 0755
+      FROM_HOST:
+  worker:
+    environment:
+      - QUEUE=jobs
+      - URL=a=b
+      - FROM_HOST
+`)
+	tests := []struct {
+		service string
+		want    map[string]string
+	}{
+		{"api", map[string]string{"PORT": "8080", "MODE": "0755"}},
+		{"worker", map[string]string{"QUEUE": "jobs", "URL": "a=b"}},
+		{"web", map[string]string{}},
+	}
+	for _, tt := range tests {
+		got, err := NewCompose(tt.service).Parse(data)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.service, err)
+		}
+		if !maps.Equal(got, tt.want) {
+			t.Errorf("%s: %q, want %q", tt.service, got, tt.want)
+		}
+	}
+	if _, err := NewCompose("").Parse(data); err == nil || !strings.Contains(err.Error(), "--service") {
+		t.Errorf("Parse without a service = %v, want a request to choose one", err)
+	}
+}
@@ -0,0 +1,46 @@
+package format
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/stormingluke/autoenv/internal/port"
+)
+
+var _ port.EnvFormatter = (*GitHubEnv)(nil)
+
+// GitHubEnv renders lines for appending to $GITHUB_ENV in a workflow step.
+// Every value uses the multiline heredoc syntax with a random delimiter so
+// a value can never terminate its own block.
+type GitHubEnv struct{}
+
+func NewGitHubEnv() *GitHubEnv {
+	return &GitHubEnv{}
+}
+
+func (f *GitHubEnv) Format(vars map[string]string) (string, error) {
+	var b strings.Builder
+	for _, k := range sortedKeys(vars) {
+		v := vars[k]
+		delim, err := heredocDelimiter(v)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "%s<<%s\n%s\n%s\n", k, delim, v, delim)
+	}
+	return b.String(), nil
+}
+
+func heredocDelimiter(value string) (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate delimiter: %w", err)
+	}
+	delim := "ghadelimiter_" + hex.EncodeToString(buf)
+	if strings.Contains(value, delim) {
+		return "", fmt.Errorf("value contains heredoc delimiter %s", delim)
+	}
+	return delim, nil
+}
@@ -0,0 +1,58 @@
+package format
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/stormingluke/autoenv/internal/port"
+)
+
+var (
+	_ port.EnvFormatter = (*JSON)(nil)
+	_ port.EnvParser    = (*JSON)(nil)
+)
+
+type JSON struct{}
+
+func NewJSON() *JSON {
+	return &JSON{}
+}
+
+func (f *JSON) Format(vars map[string]string) (string, error) {
+	if vars == nil {
+		vars = map[string]string{}
+	}
+	// encoding/json sorts map keys, so output is deterministic
+	out, err := json.MarshalIndent(vars, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(out) + "\n", nil
+}
+
+func (f *JSON) Parse(data []byte) (map[string]string, error) {
+	var raw map[string]any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("parse json: %w", err)
+	}
+
+	values := make(map[string]string, len(raw))
+	for k, v := range raw {
+		switch v := v.(type) {
+		case string:
+			values[k] = v
+		case json.Number:
+			values[k] = v.String()
+		case bool:
+			values[k] = fmt.Sprint(v)
+		case nil:
+			values[k] = ""
+		default:
+			return nil, fmt.Errorf("parse json: value of %s is not a scalar", k)
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,126 @@
+package format
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/stormingluke/autoenv/internal/port"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	_ port.EnvFormatter = (*Kubernetes)(nil)
+	_ port.EnvParser    = (*Kubernetes)(nil)
+)
+
+const (
+	KindSecret    = "Secret"
+	KindConfigMap = "ConfigMap"
+)
+
+// Kubernetes renders a v1 Secret or ConfigMap manifest. Secret data is
+// base64-encoded as the API requires; ConfigMap data is stored as-is.
+// Parsing accepts either kind regardless of the kind it was built with.
+type Kubernetes struct {
+	kind      string
+	name      string
+	namespace string
+}
+
+func NewKubernetes(kind, name, namespace string) *Kubernetes {
+	return &Kubernetes{kind: kind, name: name, namespace: namespace}
+}
+
+func (f *Kubernetes) Format(vars map[string]string) (string, error) {
+	if f.name == "" {
+		return "", fmt.Errorf("kubernetes %s requires a name", f.kind)
+	}
+
+	var b strings.Builder
+	b.WriteString("apiVersion: v1\n")
+	fmt.Fprintf(&b, "kind: %s\n", f.kind)
+	b.WriteString("metadata:\n")
+	fmt.Fprintf(&b, "  name: %s\n", yamlString(f.name))
+	if f.namespace != "" {
+		fmt.Fprintf(&b, "  namespace: %s\n", yamlString(f.namespace))
+	}
+	if f.kind == KindSecret {
+		b.WriteString("type: Opaque\n")
+	}
+	if len(vars) == 0 {
+		b.WriteString("data: {}\n")
+		return b.String(), nil
+	}
+
+	b.WriteString("data:\n")
+	for _, k := range sortedKeys(vars) {
+		v := vars[k]
+		if f.kind == KindSecret {
+			v = base64.StdEncoding.EncodeToString([]byte(v))
+		}
+		fmt.Fprintf(&b, "  %s: %s\n", yamlString(k), yamlString(v))
+	}
+	return b.String(), nil
+}
+
+type kubernetesObject struct {
+	Kind     string `yaml:"kind"`
+	Metadata struct {
+		Name string `yaml:"name"`
+	} `yaml:"metadata"`
+	Data       map[string]string `yaml:"data"`
+	StringData map[string]string `yaml:"stringData"`
+}
+
+// Parse reads every Secret and ConfigMap in a (possibly multi-document)
+// manifest, optionally restricted to objects with the configured name.
+func (f *Kubernetes) Parse(data []byte) (map[string]string, error) {
+	values := make(map[string]string)
+	found := false
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var obj kubernetesObject
+		err := dec.Decode(&obj)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse kubernetes manifest: %w", err)
+		}
+		if obj.Kind != KindSecret && obj.Kind != KindConfigMap {
+			continue
+		}
+		if f.name != "" && obj.Metadata.Name != f.name {
+			continue
+		}
+		found = true
+
+		for k, v := range obj.Data {
+			if obj.Kind == KindSecret {
+				decoded, err := base64.StdEncoding.DecodeString(v)
+				if err != nil {
+					return nil, fmt.Errorf("decode %s in %s %s: %w", k, obj.Kind, obj.Metadata.Name, err)
+				}
+				v = string(decoded)
+			}
+			values[k] = v
+		}
+		// stringData takes precedence over data, as it does in the API server
+		for k, v := range obj.StringData {
+			values[k] = v
+		}
+	}
+
+	if !found {
+		if f.name != "" {
+			return nil, fmt.Errorf("no Secret or ConfigMap named %q in manifest", f.name)
+		}
+		return nil, fmt.Errorf("no Secret or ConfigMap in manifest")
+	}
+	return values, nil
+}
@@ -0,0 +1,28 @@
+package format
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/stormingluke/autoenv/internal/port"
+)
+
+var _ port.EnvFormatter = (*Systemd)(nil)
+
+// Systemd renders a file for the EnvironmentFile= directive. Values are
+// double-quoted, which systemd unescapes and allows to span lines.
+type Systemd struct{}
+
+func NewSystemd() *Systemd {
+	return &Systemd{}
+}
+
+var systemdEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "`", "\\`", `$`, `\$`)
+
+func (f *Systemd) Format(vars map[string]string) (string, error) {
+	var b strings.Builder
+	for _, k := range sortedKeys(vars) {
+		fmt.Fprintf(&b, "%s=\"%s\"\n", k, systemdEscaper.Replace(vars[k]))
+	}
+	return b.String(), nil
+}
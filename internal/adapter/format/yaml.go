@@ -0,0 +1,76 @@
+package format
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/stormingluke/autoenv/internal/port"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	_ port.EnvFormatter = (*YAML)(nil)
+	_ port.EnvParser    = (*YAML)(nil)
+)
+
+type YAML struct{}
+
+func NewYAML() *YAML {
+	return &YAML{}
+}
+
+func (f *YAML) Format(vars map[string]string) (string, error) {
+	if len(vars) == 0 {
+		return "{}\n", nil
+	}
+
+	var b strings.Builder
+	for _, k := range sortedKeys(vars) {
+		fmt.Fprintf(&b, "%s: %s\n", yamlString(k), yamlString(vars[k]))
+	}
+	return b.String(), nil
+}
+
+func (f *YAML) Parse(data []byte) (map[string]string, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse yaml: %w", err)
+	}
+	if len(doc.Content) == 0 {
+		return map[string]string{}, nil
+	}
+	values, err := scalarMap(doc.Content[0])
+	if err != nil {
+		return nil, fmt.Errorf("parse yaml: %w", err)
+	}
+	return values, nil
+}
+
+// yamlString double-quotes s so that values such as "yes", "0755" or
+// "null" stay strings instead of being reinterpreted by YAML parsers.
+func yamlString(s string) string {
+	return strconv.Quote(s)
+}
+
+// scalarMap reads a mapping of scalars using their literal text, so that
+// values like 0755 or 1e3 are imported exactly as written.
+func scalarMap(node *yaml.Node) (map[string]string, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("line %d: expected a mapping", node.Line)
+	}
+
+	values := make(map[string]string, len(node.Content)/2)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if value.Kind != yaml.ScalarNode {
+			return nil, fmt.Errorf("line %d: value of %s is not a scalar", value.Line, key.Value)
+		}
+		if value.Tag == "!!null" {
+			values[key.Value] = ""
+			continue
+		}
+		values[key.Value] = value.Value
+	}
+	return values, nil
+}
@@ -0,0 +1,122 @@
+package fsscan
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/stormingluke/autoenv/internal/port"
+)
+
+var _ port.ProjectScanner = (*Scanner)(nil)
+
+// skipDirs are never descended into: they are large and never hold a
+// project of their own.
+var skipDirs = map[string]bool{
+	".git":         true,
+	"node_modules": true,
+	"vendor":       true,
+}
+
+// Scanner walks directory trees with a fixed pool of workers, so large
+// home directories are read in parallel without unbounded goroutines.
+type Scanner struct {
+	workers int
+}
+
+func NewScanner() *Scanner {
+	return &Scanner{workers: min(4*runtime.NumCPU(), 32)}
+}
+
+type scanJob struct {
+	dir   string
+	depth int
+}
+
+func (s *Scanner) FindEnvDirs(root string, maxDepth int) ([]string, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", root)
+	}
+
+	// Directories wait in an in-memory list that the workers drain; a
+	// worker finding the list empty sleeps until another worker adds to it
+	// or the last busy worker finishes and the scan is done.
+	var (
+		mu    sync.Mutex
+		more  = sync.NewCond(&mu)
+		queue = []scanJob{{dir: root}}
+		busy  int
+		found []string
+		wg    sync.WaitGroup
+	)
+	for range s.workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			mu.Lock()
+			defer mu.Unlock()
+			for {
+				for len(queue) == 0 && busy > 0 {
+					more.Wait()
+				}
+				if len(queue) == 0 {
+					return
+				}
+				j := queue[len(queue)-1]
+				queue = queue[:len(queue)-1]
+				busy++
+				mu.Unlock()
+
+				hasEnv, subdirs := readDir(j.dir)
+
+				mu.Lock()
+				busy--
+				if hasEnv {
+					found = append(found, j.dir)
+				}
+				if maxDepth == 0 || j.depth < maxDepth {
+					for _, sub := range subdirs {
+						queue = append(queue, scanJob{dir: sub, depth: j.depth + 1})
+					}
+				}
+				more.Broadcast()
+			}
+		}()
+	}
+	wg.Wait()
+
+	sort.Strings(found)
+	return found, nil
+}
+
+// readDir reports whether dir holds a .env file and lists the
+// subdirectories worth descending into. Unreadable directories are
+// treated as empty rather than failing the scan.
+func readDir(dir string) (bool, []string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false, nil
+	}
+	hasEnv := false
+	var subdirs []string
+	for _, e := range entries {
+		switch {
+		case e.Name() == ".env" && e.Type().IsRegular():
+			hasEnv = true
+		case e.IsDir() && !skipDirs[e.Name()]:
+			subdirs = append(subdirs, filepath.Join(dir, e.Name()))
+		}
+	}
+	return hasEnv, subdirs
+}
@@ -0,0 +1,97 @@
+package fsscan
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// tree creates a .env in each of dirs below root, and an empty directory
+// for each name ending in a slash.
+func tree(t *testing.T, root string, dirs ...string) {
+	t.Helper()
+	for _, d := range dirs {
+		path := filepath.Join(root, d)
+		if err := os.MkdirAll(path, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasSuffix(d, "/") {
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(path, ".env"), []byte("A=1\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFindEnvDirs(t *testing.T) {
+	root := t.TempDir()
+	tree(t, root,
+		".",
+		"api",
+		"api/services/billing",
+		"web/app/deep/deeper",
+		"web/node_modules/pkg",
+		"api/vendor/lib",
+		"api/.git/hooks",
+		"empty/",
+	)
+	// A directory named .env is not an env file.
+	if err := os.Mkdir(filepath.Join(root, "empty", ".env"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		depth int
+		want  []string
+	}{
+		{0, []string{".", "api", "api/services/billing", "web/app/deep/deeper"}},
+		{1, []string{".", "api"}},
+		{3, []string{".", "api", "api/services/billing"}},
+		{4, []string{".", "api", "api/services/billing", "web/app/deep/deeper"}},
+	}
+	for _, tt := range tests {
+		got, err := NewScanner().FindEnvDirs(root, tt.depth)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := make([]string, len(tt.want))
+		for i, d := range tt.want {
+			want[i] = filepath.Join(root, d)
+		}
+		slices.Sort(want)
+		if !slices.Equal(got, want) {
+			t.Errorf("depth %d: got %q, want %q", tt.depth, got, want)
+		}
+	}
+}
+
+// A single worker drains a tree wider than any queue would hold.
+func TestFindEnvDirsWithOneWorker(t *testing.T) {
+	root := t.TempDir()
+	var want []string
+	for i := range 50 {
+		dir := filepath.Join("wide", strings.Repeat("d", i+1))
+		tree(t, root, dir)
+		want = append(want, filepath.Join(root, dir))
+	}
+	slices.Sort(want)
+	got, err := (&Scanner{workers: 1}).FindEnvDirs(root, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("found %d directories, want %d", len(got), len(want))
+	}
+}
+
+func TestFindEnvDirsRejectsAFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewScanner().FindEnvDirs(file, 0); err == nil {
+		t.Error("FindEnvDirs accepted a file as root")
+	}
+}
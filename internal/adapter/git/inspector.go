@@ -0,0 +1,147 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/stormingluke/autoenv/internal/port"
+)
+
+var _ port.RepoInspector = (*Inspector)(nil)
+
+// Inspector reads repository metadata straight from .git so it works
+// without the git binary and stays cheap enough to call per directory.
+type Inspector struct{}
+
+func NewInspector() *Inspector {
+	return &Inspector{}
+}
+
+func (i *Inspector) Root(dir string) (string, error) {
+	root, _, err := findGitDir(dir)
+	return root, err
+}
+
+func (i *Inspector) RemoteURL(dir string) (string, error) {
+	_, gitDir, err := findGitDir(dir)
+	if err != nil || gitDir == "" {
+		return "", err
+	}
+
+	configPath := filepath.Join(commonDir(gitDir), "config")
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("read %s: %w", configPath, err)
+	}
+
+	remotes, order := parseRemotes(data)
+	if url, ok := remotes["origin"]; ok {
+		return url, nil
+	}
+	if len(order) > 0 {
+		return remotes[order[0]], nil
+	}
+	return "", nil
+}
+
+// findGitDir walks up from dir to the first directory containing .git
+// and returns that working tree root and its git directory. A .git file
+// (worktrees, submodules) is followed to the directory it points to.
+func findGitDir(dir string) (root, gitDir string, err error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", "", fmt.Errorf("resolve path: %w", err)
+	}
+
+	for {
+		candidate := filepath.Join(abs, ".git")
+		info, err := os.Stat(candidate)
+		if err == nil {
+			if info.IsDir() {
+				return abs, candidate, nil
+			}
+			target, err := readGitFile(candidate)
+			if err != nil {
+				return "", "", err
+			}
+			return abs, target, nil
+		}
+
+		parent := filepath.Dir(abs)
+		if parent == abs {
+			return "", "", nil
+		}
+		abs = parent
+	}
+}
+
+func readGitFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("read %s: %w", path, err)
+	}
+	target, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir:")
+	if !ok {
+		return "", fmt.Errorf("%s: not a gitdir reference", path)
+	}
+	target = strings.TrimSpace(target)
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(path), target)
+	}
+	return target, nil
+}
+
+// commonDir resolves the directory holding the shared config of a linked
+// worktree; for a regular repository it is the git directory itself.
+func commonDir(gitDir string) string {
+	data, err := os.ReadFile(filepath.Join(gitDir, "commondir"))
+	if err != nil {
+		return gitDir
+	}
+	common := strings.TrimSpace(string(data))
+	if !filepath.IsAbs(common) {
+		common = filepath.Join(gitDir, common)
+	}
+	return common
+}
+
+func parseRemotes(data []byte) (map[string]string, []string) {
+	remotes := make(map[string]string)
+	var order []string
+	current := ""
+
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' {
+			current = ""
+			header := strings.TrimSuffix(strings.TrimPrefix(line, "["), "]")
+			if name, ok := strings.CutPrefix(header, "remote "); ok {
+				current = strings.Trim(strings.TrimSpace(name), `"`)
+			}
+			continue
+		}
+		if current == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || strings.TrimSpace(key) != "url" {
+			continue
+		}
+		if _, seen := remotes[current]; !seen {
+			order = append(order, current)
+			remotes[current] = strings.Trim(strings.TrimSpace(value), `"`)
+		}
+	}
+	return remotes, order
+}
@@ -0,0 +1,146 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stormingluke/autoenv/internal/adapter/httpretry"
+)
+
+// DefaultAPIURL is the REST endpoint for github.com; GitHub Enterprise
+// Server uses https://<host>/api/v3.
+const DefaultAPIURL = "https://api.github.com"
+
+type client struct {
+	http    *http.Client
+	baseURL string
+	token   string
+}
+
+// APIError is a non-2xx response from the GitHub API. RetryAfter is how
+// long GitHub asked to wait before retrying, if it said.
+type APIError struct {
+	StatusCode int
+	Message    string
+	RetryAfter time.Duration
+	rateLimit  bool
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("github api: %s", http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("github api: %s (%d)", e.Message, e.StatusCode)
+}
+
+func newClient(baseURL, token string) *client {
+	if baseURL == "" {
+		baseURL = DefaultAPIURL
+	}
+	return &client{
+		http:    &http.Client{Timeout: 30 * time.Second},
+		baseURL: strings.TrimRight(baseURL, "/"),
+		token:   token,
+	}
+}
+
+// do sends a JSON request and decodes a JSON response into out, if set,
+// retrying idempotent requests hit by rate limits, server errors and
+// network failures with exponential backoff until ctx is done.
+func (c *client) do(ctx context.Context, method, path string, body, out any) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	send := func() error { return c.send(ctx, method, path, data, out) }
+	if !httpretry.Idempotent(method) {
+		return send()
+	}
+	return httpretry.Do(ctx, send, temporary)
+}
+
+func (c *client) send(ctx context.Context, method, path string, data []byte, out any) error {
+	var r io.Reader
+	if data != nil {
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if data != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		apiErr.RetryAfter, apiErr.rateLimit = rateLimitWait(resp.Header)
+		var msg struct {
+			Message string `json:"message"`
+		}
+		if json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&msg) == nil {
+			apiErr.Message = msg.Message
+		}
+		return apiErr
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// rateLimitWait reads how long GitHub asks clients to back off from
+// Retry-After, or from X-RateLimit-Reset once the rate limit is used up,
+// and whether the response signals a rate limit at all.
+func rateLimitWait(h http.Header) (time.Duration, bool) {
+	if wait, ok := httpretry.RetryAfter(h); ok {
+		return wait, true
+	}
+	if h.Get("X-RateLimit-Remaining") != "0" {
+		return 0, false
+	}
+	reset, err := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return 0, true
+	}
+	return max(time.Until(time.Unix(reset, 0)), time.Second), true
+}
+
+// temporary reports whether a failed request may succeed if sent again,
+// and how long GitHub asked to wait first. GitHub answers rate-limited
+// requests with 429 or 403.
+func temporary(err error) (time.Duration, bool) {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return 0, false
+	}
+	switch {
+	case apiErr.StatusCode == http.StatusTooManyRequests, apiErr.StatusCode >= 500:
+		return apiErr.RetryAfter, true
+	case apiErr.StatusCode == http.StatusForbidden:
+		return apiErr.RetryAfter, apiErr.rateLimit
+	default:
+		return 0, false
+	}
+}
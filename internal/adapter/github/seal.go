@@ -0,0 +1,32 @@
+package github
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+
+	"golang.org/x/crypto/nacl/box"
+)
+
+// publicKey is a repository's or organization's secrets encryption key.
+type publicKey struct {
+	KeyID string `json:"key_id"`
+	Key   string `json:"key"`
+}
+
+// seal encrypts value as a libsodium sealed box for the given key, the
+// format GitHub expects in encrypted_value.
+func (k publicKey) seal(value string) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(k.Key)
+	if err != nil || len(raw) != 32 {
+		return "", fmt.Errorf("invalid public key %s", k.KeyID)
+	}
+	var recipient [32]byte
+	copy(recipient[:], raw)
+
+	sealed, err := box.SealAnonymous(nil, []byte(value), &recipient, rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
@@ -1,35 +1,171 @@
 package github
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"os/exec"
-	"strings"
+	"net/http"
+	"net/url"
+	"sort"
 
+	"github.com/stormingluke/autoenv/internal/adapter/syncpool"
+	"github.com/stormingluke/autoenv/internal/domain"
 	"github.com/stormingluke/autoenv/internal/port"
 )
 
 var _ port.SecretSyncer = (*SecretSyncer)(nil)
 
-type SecretSyncer struct{}
+// workers bounds how many keys are pushed at once; GitHub penalises
+// clients that send many concurrent requests.
+const workers = 4
 
-func NewSecretSyncer() *SecretSyncer {
-	return &SecretSyncer{}
+// SecretSyncer writes GitHub secrets and variables through the REST API.
+// Secret values are sealed with the target's public key before they
+// leave the process.
+type SecretSyncer struct {
+	client *client
 }
 
-func (s *SecretSyncer) Sync(repo string, secrets map[string]string) error {
-	if _, err := exec.LookPath("gh"); err != nil {
-		return fmt.Errorf("gh CLI not found: install from https://cli.github.com")
+// NewSecretSyncer returns a syncer for the API at apiURL (DefaultAPIURL
+// when empty) authenticating with token.
+func NewSecretSyncer(apiURL, token string) *SecretSyncer {
+	return &SecretSyncer{client: newClient(apiURL, token)}
+}
+
+func (s *SecretSyncer) List(ctx context.Context, t domain.SyncTarget) ([]string, error) {
+	if err := s.checkToken(); err != nil {
+		return nil, err
 	}
+	base, collection := collectionPath(t)
 
-	for key, value := range secrets {
-		cmd := exec.Command("gh", "secret", "set", key, //nolint:gosec // args are passed as separate elements, not shell-interpreted
-			"--repo", repo,
-			"--body", value,
-		)
-		if out, err := cmd.CombinedOutput(); err != nil {
-			return fmt.Errorf("set secret %s: %s: %w", key, strings.TrimSpace(string(out)), err)
+	// Variables are listed at most 30 per page, secrets 100.
+	perPage := 100
+	if t.Kind == domain.KindVariable {
+		perPage = 30
+	}
+	var names []string
+	for page := 1; ; page++ {
+		var resp struct {
+			TotalCount int `json:"total_count"`
+			Secrets    []struct {
+				Name string `json:"name"`
+			} `json:"secrets"`
+			Variables []struct {
+				Name string `json:"name"`
+			} `json:"variables"`
+		}
+		path := fmt.Sprintf("%s?per_page=%d&page=%d", base, perPage, page)
+		if err := s.client.do(ctx, http.MethodGet, path, nil, &resp); err != nil {
+			return nil, fmt.Errorf("list %s in %s: %w", collection, t, err)
+		}
+		items := resp.Secrets
+		if t.Kind == domain.KindVariable {
+			items = resp.Variables
 		}
+		for _, item := range items {
+			names = append(names, item.Name)
+		}
+		if len(items) < perPage || len(names) >= resp.TotalCount {
+			return names, nil
+		}
+	}
+}
+
+func (s *SecretSyncer) Delete(ctx context.Context, t domain.SyncTarget, names []string) ([]domain.KeyResult, error) {
+	if err := s.checkToken(); err != nil {
+		return nil, err
 	}
+	base, _ := collectionPath(t)
+	sorted := append([]string(nil), names...)
+	sort.Strings(sorted)
+	return syncpool.Run(ctx, workers, sorted, func(ctx context.Context, name string) error {
+		return s.client.do(ctx, http.MethodDelete, base+"/"+url.PathEscape(name), nil, nil)
+	})
+}
 
+func (s *SecretSyncer) Sync(ctx context.Context, t domain.SyncTarget, values map[string]string) ([]domain.KeyResult, error) {
+	if err := s.checkToken(); err != nil {
+		return nil, err
+	}
+	if t.Kind == domain.KindVariable {
+		return s.syncVariables(ctx, t, values)
+	}
+	return s.syncSecrets(ctx, t, values)
+}
+
+func (s *SecretSyncer) syncSecrets(ctx context.Context, t domain.SyncTarget, secrets map[string]string) ([]domain.KeyResult, error) {
+	base, _ := collectionPath(t)
+	var key publicKey
+	if err := s.client.do(ctx, http.MethodGet, base+"/public-key", nil, &key); err != nil {
+		return nil, fmt.Errorf("get public key for %s: %w", t, err)
+	}
+
+	return syncpool.Run(ctx, workers, sortedKeys(secrets), func(ctx context.Context, name string) error {
+		sealed, err := key.seal(secrets[name])
+		if err != nil {
+			return fmt.Errorf("encrypt: %w", err)
+		}
+		body := map[string]string{"encrypted_value": sealed, "key_id": key.KeyID}
+		if t.IsOrg() {
+			body["visibility"] = string(t.Visibility)
+		}
+		return s.client.do(ctx, http.MethodPut, base+"/"+url.PathEscape(name), body, nil)
+	})
+}
+
+// syncVariables updates each Actions variable, creating the ones that do
+// not exist yet; the API has no single upsert call for variables.
+func (s *SecretSyncer) syncVariables(ctx context.Context, t domain.SyncTarget, vars map[string]string) ([]domain.KeyResult, error) {
+	base, _ := collectionPath(t)
+	return syncpool.Run(ctx, workers, sortedKeys(vars), func(ctx context.Context, name string) error {
+		body := map[string]string{"name": name, "value": vars[name]}
+		if t.IsOrg() {
+			body["visibility"] = string(t.Visibility)
+		}
+		err := s.client.do(ctx, http.MethodPatch, base+"/"+url.PathEscape(name), body, nil)
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+			err = s.client.do(ctx, http.MethodPost, base, body, nil)
+		}
+		return err
+	})
+}
+
+func (s *SecretSyncer) checkToken() error {
+	if s.client.token == "" {
+		return fmt.Errorf("no GitHub token: set GH_TOKEN or AUTOENV_GITHUB_TOKEN, or run `gh auth login`")
+	}
 	return nil
 }
+
+// collectionPath is the API path of a target's secrets or variables and
+// the collection's name.
+func collectionPath(t domain.SyncTarget) (path, collection string) {
+	if t.Kind == domain.KindVariable {
+		return scopePath(t, string(domain.AppActions)) + "/variables", "variables"
+	}
+	return scopePath(t, string(t.App)) + "/secrets", "secrets"
+}
+
+// scopePath is the API path a target's secrets or variables hang off:
+// the organization, the repository environment, or the repository's app.
+func scopePath(t domain.SyncTarget, app string) string {
+	owner := url.PathEscape(t.Owner)
+	switch {
+	case t.IsOrg():
+		return "/orgs/" + owner + "/" + app
+	case t.Environment != "":
+		return "/repos/" + owner + "/" + url.PathEscape(t.Repo) + "/environments/" + url.PathEscape(t.Environment)
+	default:
+		return "/repos/" + owner + "/" + url.PathEscape(t.Repo) + "/" + app
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,285 @@
+package github
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/nacl/box"
+
+	"github.com/stormingluke/autoenv/internal/adapter/httpretry"
+	"github.com/stormingluke/autoenv/internal/domain"
+)
+
+// fakeAPI is a GitHub REST stand-in. Handlers are keyed by "METHOD path"
+// and every request is recorded, so tests can check what was sent and
+// that failures were not retried.
+type fakeAPI struct {
+	t        *testing.T
+	mu       sync.Mutex
+	requests []string
+	bodies   map[string]map[string]string
+	handlers map[string]http.HandlerFunc
+}
+
+func newFakeAPI(t *testing.T) (*fakeAPI, *SecretSyncer) {
+	t.Helper()
+	f := &fakeAPI{t: t, bodies: make(map[string]map[string]string), handlers: make(map[string]http.HandlerFunc)}
+	srv := httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(srv.Close)
+	return f, NewSecretSyncer(srv.URL, "test-token")
+}
+
+func (f *fakeAPI) handle(route string, h http.HandlerFunc) { f.handlers[route] = h }
+
+func (f *fakeAPI) serve(w http.ResponseWriter, r *http.Request) {
+	route := r.Method + " " + r.URL.Path
+	if got := r.Header.Get("Authorization"); got != "Bearer test-token" {
+		f.t.Errorf("%s: Authorization = %q", route, got)
+	}
+	body := make(map[string]string)
+	_ = json.NewDecoder(r.Body).Decode(&body)
+
+	f.mu.Lock()
+	f.requests = append(f.requests, route)
+	f.bodies[route] = body
+	h := f.handlers[route]
+	f.mu.Unlock()
+
+	if h == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	h(w, r)
+}
+
+func (f *fakeAPI) count(route string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, r := range f.requests {
+		if r == route {
+			n++
+		}
+	}
+	return n
+}
+
+func (f *fakeAPI) body(route string) map[string]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.bodies[route]
+}
+
+func reply(status int, v any) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(v)
+	}
+}
+
+// keyPair is the target's secrets key; GitHub holds the private half.
+type keyPair struct{ public, private *[32]byte }
+
+// servePublicKey answers the target's public-key request with a fresh key
+// pair.
+func (f *fakeAPI) servePublicKey(t *testing.T, path string) keyPair {
+	t.Helper()
+	pub, priv, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.handle("GET "+path, reply(http.StatusOK, publicKey{
+		KeyID: "key-1",
+		Key:   base64.StdEncoding.EncodeToString(pub[:]),
+	}))
+	return keyPair{pub, priv}
+}
+
+// open decrypts an encrypted_value the way GitHub does.
+func open(t *testing.T, sealed string, key keyPair) string {
+	t.Helper()
+	raw, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		t.Fatalf("encrypted_value is not base64: %v", err)
+	}
+	plain, ok := box.OpenAnonymous(nil, raw, key.public, key.private)
+	if !ok {
+		t.Fatal("encrypted_value does not open with the target's private key")
+	}
+	return string(plain)
+}
+
+func repoTarget(kind domain.SecretKind) domain.SyncTarget {
+	return domain.SyncTarget{Provider: domain.ProviderGitHub, Owner: "me", Repo: "api", App: domain.AppActions, Kind: kind}
+}
+
+func TestSyncSealsSecretsWithTheTargetKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		target domain.SyncTarget
+		base   string
+	}{
+		{"repository", repoTarget(domain.KindSecret), "/repos/me/api/actions/secrets"},
+		{"environment", domain.SyncTarget{Owner: "me", Repo: "api", Environment: "prod", App: domain.AppActions}, "/repos/me/api/environments/prod/secrets"},
+		{"dependabot", domain.SyncTarget{Owner: "me", Repo: "api", App: domain.AppDependabot}, "/repos/me/api/dependabot/secrets"},
+		{"organization", domain.SyncTarget{Owner: "acme", App: domain.AppActions, Visibility: domain.VisibilityPrivate}, "/orgs/acme/actions/secrets"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, s := newFakeAPI(t)
+			key := f.servePublicKey(t, tt.base+"/public-key")
+
+			values := map[string]string{"API_KEY": "s3cret value", "EMPTY": ""}
+			results, err := s.Sync(context.Background(), tt.target, values)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, r := range results {
+				if r.Outcome != domain.KeyOK {
+					t.Errorf("%s: %v %v", r.Key, r.Outcome, r.Err)
+				}
+			}
+			for name, want := range values {
+				body := f.body("PUT " + tt.base + "/" + name)
+				if body["key_id"] != "key-1" {
+					t.Errorf("%s: key_id = %q", name, body["key_id"])
+				}
+				if got := open(t, body["encrypted_value"], key); got != want {
+					t.Errorf("%s decrypts to %q, want %q", name, got, want)
+				}
+				if got := body["visibility"]; got != string(tt.target.Visibility) {
+					t.Errorf("%s: visibility = %q, want %q", name, got, tt.target.Visibility)
+				}
+			}
+			if n := f.count("GET " + tt.base + "/public-key"); n != 1 {
+				t.Errorf("public key fetched %d times, want once per sync", n)
+			}
+		})
+	}
+}
+
+func TestSyncVariablesCreatesMissingOnes(t *testing.T) {
+	f, s := newFakeAPI(t)
+	base := "/repos/me/api/actions/variables"
+	f.handle("PATCH "+base+"/NEW", reply(http.StatusNotFound, map[string]string{"message": "Not Found"}))
+	f.handle("POST "+base, reply(http.StatusCreated, nil))
+
+	results, err := s.Sync(context.Background(), repoTarget(domain.KindVariable), map[string]string{"NEW": "1", "OLD": "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range results {
+		if r.Outcome != domain.KeyOK {
+			t.Errorf("%s: %v %v", r.Key, r.Outcome, r.Err)
+		}
+	}
+	if f.count("POST "+base) != 1 || f.body("POST " + base)["name"] != "NEW" {
+		t.Errorf("POST %s = %d requests, body %v; want one creating NEW", base, f.count("POST "+base), f.body("POST "+base))
+	}
+	if got := f.body("PATCH " + base + "/OLD"); got["value"] != "2" {
+		t.Errorf("PATCH OLD body = %v", got)
+	}
+}
+
+func TestSyncReportsClientErrorsWithoutRetrying(t *testing.T) {
+	t.Run("missing repository", func(t *testing.T) {
+		f, s := newFakeAPI(t)
+		route := "GET /repos/me/api/actions/secrets/public-key"
+		f.handle(route, reply(http.StatusNotFound, map[string]string{"message": "Not Found"}))
+
+		_, err := s.Sync(context.Background(), repoTarget(domain.KindSecret), map[string]string{"A": "1"})
+		if err == nil || !strings.Contains(err.Error(), "Not Found (404)") {
+			t.Fatalf("err = %v, want the 404", err)
+		}
+		if n := f.count(route); n != 1 {
+			t.Errorf("%d requests, want 1", n)
+		}
+	})
+	t.Run("rejected value", func(t *testing.T) {
+		f, s := newFakeAPI(t)
+		f.servePublicKey(t, "/repos/me/api/actions/secrets/public-key")
+		bad := "PUT /repos/me/api/actions/secrets/GITHUB_TOKEN"
+		f.handle(bad, reply(http.StatusUnprocessableEntity, map[string]string{"message": "Secret names must not start with GITHUB_"}))
+
+		results, err := s.Sync(context.Background(), repoTarget(domain.KindSecret), map[string]string{"GITHUB_TOKEN": "x", "OK": "y"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := map[string]domain.KeyResult{}
+		for _, r := range results {
+			got[r.Key] = r
+		}
+		if r := got["GITHUB_TOKEN"]; r.Outcome != domain.KeyFailed || !strings.Contains(r.Err.Error(), "must not start with GITHUB_ (422)") {
+			t.Errorf("GITHUB_TOKEN = %v %v, want the 422", r.Outcome, r.Err)
+		}
+		if got["OK"].Outcome != domain.KeyOK {
+			t.Errorf("OK = %v %v", got["OK"].Outcome, got["OK"].Err)
+		}
+		if n := f.count(bad); n != 1 {
+			t.Errorf("%d requests for the rejected key, want 1", n)
+		}
+	})
+}
+
+func TestSyncRequiresAToken(t *testing.T) {
+	s := NewSecretSyncer("http://127.0.0.1:1", "")
+	if _, err := s.Sync(context.Background(), repoTarget(domain.KindSecret), map[string]string{"A": "1"}); err == nil {
+		t.Error("Sync without a token succeeded")
+	}
+}
+
+// failing answers the first n requests with status and then passes to h.
+func failing(n, status int, h http.HandlerFunc) http.HandlerFunc {
+	var mu sync.Mutex
+	return func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fail := n > 0
+		n--
+		mu.Unlock()
+		if fail {
+			reply(status, map[string]string{"message": http.StatusText(status)})(w, r)
+			return
+		}
+		if h == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		h(w, r)
+	}
+}
+
+func TestOnlyIdempotentRequestsAreRetried(t *testing.T) {
+	defer func(d time.Duration) { httpretry.Base = d }(httpretry.Base)
+	httpretry.Base = time.Millisecond
+
+	f, s := newFakeAPI(t)
+	base := "/repos/me/api/actions/variables"
+	f.handle("PATCH "+base+"/OLD", failing(2, http.StatusBadGateway, nil))
+	f.handle("PATCH "+base+"/NEW", reply(http.StatusNotFound, map[string]string{"message": "Not Found"}))
+	f.handle("POST "+base, failing(1, http.StatusBadGateway, nil))
+
+	results, err := s.Sync(context.Background(), repoTarget(domain.KindVariable), map[string]string{"NEW": "1", "OLD": "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]domain.KeyResult{}
+	for _, r := range results {
+		got[r.Key] = r
+	}
+	if got["OLD"].Outcome != domain.KeyOK || f.count("PATCH "+base+"/OLD") != 3 {
+		t.Errorf("OLD: %v after %d PATCHes, want ok after 3", got["OLD"].Outcome, f.count("PATCH "+base+"/OLD"))
+	}
+	// The failed POST may have created NEW, so it is reported, not resent.
+	if got["NEW"].Outcome != domain.KeyFailed || f.count("POST "+base) != 1 {
+		t.Errorf("NEW: %v after %d POSTs, want failed after 1", got["NEW"].Outcome, f.count("POST "+base))
+	}
+}
@@ -0,0 +1,71 @@
+package github
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ResolveToken finds a GitHub token for the API at apiURL: the configured
+// token if set, then GH_TOKEN / GITHUB_TOKEN (GH_ENTERPRISE_TOKEN for
+// other hosts), then the gh CLI's hosts.yml. It returns "" when none is
+// found; gh logins kept in the system keyring are not readable here.
+func ResolveToken(apiURL, configured string) string {
+	if configured != "" {
+		return configured
+	}
+	host := Host(apiURL)
+	envs := []string{"GH_TOKEN", "GITHUB_TOKEN"}
+	if host != "github.com" {
+		envs = []string{"GH_ENTERPRISE_TOKEN", "GITHUB_ENTERPRISE_TOKEN"}
+	}
+	for _, env := range envs {
+		if token := os.Getenv(env); token != "" {
+			return token
+		}
+	}
+	return ghHostsToken(host)
+}
+
+// Host returns the web host an API URL belongs to, as gh names it.
+func Host(apiURL string) string {
+	if apiURL == "" {
+		return "github.com"
+	}
+	u, err := url.Parse(apiURL)
+	if err != nil || u.Host == "" {
+		return "github.com"
+	}
+	if u.Host == "api.github.com" {
+		return "github.com"
+	}
+	return u.Host
+}
+
+func ghHostsToken(host string) string {
+	data, err := os.ReadFile(filepath.Join(ghConfigDir(), "hosts.yml"))
+	if err != nil {
+		return ""
+	}
+	var hosts map[string]struct {
+		OAuthToken string `yaml:"oauth_token"`
+	}
+	if err := yaml.Unmarshal(data, &hosts); err != nil {
+		return ""
+	}
+	return strings.TrimSpace(hosts[host].OAuthToken)
+}
+
+func ghConfigDir() string {
+	if dir := os.Getenv("GH_CONFIG_DIR"); dir != "" {
+		return dir
+	}
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "gh")
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".config", "gh")
+}
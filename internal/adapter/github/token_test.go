@@ -0,0 +1,65 @@
+package github
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveTokenPrecedence(t *testing.T) {
+	const hostsYML = `github.com:
+    user: me
+    oauth_token: gh-hosts-token
+ghe.example.com:
+    user: me
+    oauth_token: ghe-hosts-token
+`
+	tests := []struct {
+		name       string
+		apiURL     string
+		configured string
+		env        map[string]string
+		hosts      bool
+		want       string
+	}{
+		{"configured token wins", "", "configured", map[string]string{"GH_TOKEN": "env"}, true, "configured"},
+		{"GH_TOKEN before GITHUB_TOKEN", "", "", map[string]string{"GH_TOKEN": "gh", "GITHUB_TOKEN": "github"}, true, "gh"},
+		{"GITHUB_TOKEN before gh hosts", "", "", map[string]string{"GITHUB_TOKEN": "github"}, true, "github"},
+		{"gh hosts.yml for github.com", DefaultAPIURL, "", nil, true, "gh-hosts-token"},
+		{"enterprise ignores GH_TOKEN", "https://ghe.example.com/api/v3", "", map[string]string{"GH_TOKEN": "gh"}, true, "ghe-hosts-token"},
+		{"GH_ENTERPRISE_TOKEN for enterprise", "https://ghe.example.com/api/v3", "", map[string]string{"GH_ENTERPRISE_TOKEN": "ghe", "GITHUB_ENTERPRISE_TOKEN": "github-ghe"}, true, "ghe"},
+		{"GITHUB_ENTERPRISE_TOKEN for enterprise", "https://ghe.example.com/api/v3", "", map[string]string{"GITHUB_ENTERPRISE_TOKEN": "github-ghe"}, true, "github-ghe"},
+		{"nothing found", "", "", nil, false, ""},
+		{"host missing from hosts.yml", "https://other.example.com/api/v3", "", nil, true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Setenv("GH_CONFIG_DIR", dir)
+			for _, env := range []string{"GH_TOKEN", "GITHUB_TOKEN", "GH_ENTERPRISE_TOKEN", "GITHUB_ENTERPRISE_TOKEN"} {
+				t.Setenv(env, tt.env[env])
+			}
+			if tt.hosts {
+				if err := os.WriteFile(filepath.Join(dir, "hosts.yml"), []byte(hostsYML), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := ResolveToken(tt.apiURL, tt.configured); got != tt.want {
+				t.Errorf("ResolveToken = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHost(t *testing.T) {
+	for apiURL, want := range map[string]string{
+		"":                               "github.com",
+		DefaultAPIURL:                    "github.com",
+		"https://ghe.example.com/api/v3": "ghe.example.com",
+		"not a url\x7f":                  "github.com",
+	} {
+		if got := Host(apiURL); got != want {
+			t.Errorf("Host(%q) = %q, want %q", apiURL, got, want)
+		}
+	}
+}
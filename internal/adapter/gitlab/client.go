@@ -0,0 +1,169 @@
+package gitlab
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stormingluke/autoenv/internal/adapter/httpretry"
+)
+
+// DefaultURL is gitlab.com; self-managed instances are reached at their
+// own web URL, under which the API lives at /api/v4.
+const DefaultURL = "https://gitlab.com"
+
+type client struct {
+	http    *http.Client
+	baseURL string
+	token   string
+}
+
+// APIError is a non-2xx response from the GitLab API. RetryAfter is how
+// long GitLab asked to wait before retrying, if it said.
+type APIError struct {
+	StatusCode int
+	Message    string
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("gitlab api: %s", http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("gitlab api: %s (%d)", e.Message, e.StatusCode)
+}
+
+func newClient(baseURL, token string) *client {
+	if baseURL == "" {
+		baseURL = DefaultURL
+	}
+	return &client{
+		http:    &http.Client{Timeout: 30 * time.Second},
+		baseURL: strings.TrimRight(baseURL, "/") + "/api/v4",
+		token:   token,
+	}
+}
+
+// do sends a JSON request and decodes a JSON response into out, if set,
+// retrying idempotent requests hit by rate limits, server errors and
+// network failures with exponential backoff until ctx is done. It returns
+// the response headers for pagination.
+func (c *client) do(ctx context.Context, method, path string, body, out any) (http.Header, error) {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return nil, err
+		}
+	}
+
+	var header http.Header
+	send := func() error {
+		var err error
+		header, err = c.send(ctx, method, path, data, out)
+		return err
+	}
+	if !httpretry.Idempotent(method) {
+		err := send()
+		return header, err
+	}
+	err := httpretry.Do(ctx, send, temporary)
+	return header, err
+}
+
+func (c *client) send(ctx context.Context, method, path string, data []byte, out any) (http.Header, error) {
+	var r io.Reader
+	if data != nil {
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, r)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("PRIVATE-TOKEN", c.token)
+	if data != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := &APIError{StatusCode: resp.StatusCode, RetryAfter: retryAfter(resp.Header)}
+		// GitLab puts validation errors in "message", as a string or an
+		// object of field errors, and OAuth errors in "error".
+		var msg struct {
+			Message json.RawMessage `json:"message"`
+			Error   string          `json:"error"`
+		}
+		if json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&msg) == nil {
+			apiErr.Message = errorMessage(msg.Message)
+			if apiErr.Message == "" {
+				apiErr.Message = msg.Error
+			}
+		}
+		return resp.Header, apiErr
+	}
+	if out == nil {
+		return resp.Header, nil
+	}
+	return resp.Header, json.NewDecoder(resp.Body).Decode(out)
+}
+
+// errorMessage flattens {"value": ["is invalid"]} to "value is invalid".
+func errorMessage(raw json.RawMessage) string {
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		return text
+	}
+	var fields map[string][]string
+	if json.Unmarshal(raw, &fields) != nil {
+		return string(raw)
+	}
+	var msgs []string
+	for field, errs := range fields {
+		for _, e := range errs {
+			msgs = append(msgs, field+" "+e)
+		}
+	}
+	sort.Strings(msgs)
+	return strings.Join(msgs, "; ")
+}
+
+// retryAfter reads how long GitLab asks clients to back off, from
+// Retry-After or else RateLimit-Reset.
+func retryAfter(h http.Header) time.Duration {
+	if wait, ok := httpretry.RetryAfter(h); ok {
+		return wait
+	}
+	if h.Get("RateLimit-Remaining") != "0" {
+		return 0
+	}
+	reset, err := strconv.ParseInt(h.Get("RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return max(time.Until(time.Unix(reset, 0)), time.Second)
+}
+
+// temporary reports whether a failed request may succeed if sent again,
+// and how long GitLab asked to wait first.
+func temporary(err error) (time.Duration, bool) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= 500) {
+		return apiErr.RetryAfter, true
+	}
+	return 0, false
+}
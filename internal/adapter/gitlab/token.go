@@ -0,0 +1,82 @@
+package gitlab
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ResolveToken finds a GitLab token for the instance at baseURL: the
+// configured token if set, then GITLAB_TOKEN / GITLAB_ACCESS_TOKEN, then
+// the glab CLI's config.yml. The environment tokens are only sent to
+// gitlab.com, or to the host GITLAB_HOST names, as glab does. It returns
+// "" when none is found.
+func ResolveToken(baseURL, configured string) string {
+	if configured != "" {
+		return configured
+	}
+	host := Host(baseURL)
+	if host == envTokenHost() {
+		for _, env := range []string{"GITLAB_TOKEN", "GITLAB_ACCESS_TOKEN"} {
+			if token := os.Getenv(env); token != "" {
+				return token
+			}
+		}
+	}
+	return glabToken(host)
+}
+
+// envTokenHost is the host GITLAB_TOKEN belongs to. GITLAB_HOST may be a
+// bare host or a URL.
+func envTokenHost() string {
+	host := os.Getenv("GITLAB_HOST")
+	if strings.Contains(host, "://") {
+		return Host(host)
+	}
+	if host == "" {
+		return "gitlab.com"
+	}
+	return host
+}
+
+// Host returns the host of a GitLab instance's web URL.
+func Host(baseURL string) string {
+	if baseURL == "" {
+		return "gitlab.com"
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Host == "" {
+		return "gitlab.com"
+	}
+	return u.Host
+}
+
+func glabToken(host string) string {
+	data, err := os.ReadFile(filepath.Join(glabConfigDir(), "config.yml"))
+	if err != nil {
+		return ""
+	}
+	var config struct {
+		Hosts map[string]struct {
+			Token string `yaml:"token"`
+		} `yaml:"hosts"`
+	}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return ""
+	}
+	return strings.TrimSpace(config.Hosts[host].Token)
+}
+
+func glabConfigDir() string {
+	if dir := os.Getenv("GLAB_CONFIG_DIR"); dir != "" {
+		return dir
+	}
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "glab-cli")
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".config", "glab-cli")
+}
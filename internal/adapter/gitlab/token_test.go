@@ -0,0 +1,49 @@
+package gitlab
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveTokenPrecedence(t *testing.T) {
+	const configYML = `hosts:
+  gitlab.com:
+    token: glab-token
+  gitlab.example.com:
+    token: self-managed-glab-token
+`
+	const selfManaged = "https://gitlab.example.com"
+	tests := []struct {
+		name       string
+		baseURL    string
+		configured string
+		env        map[string]string
+		want       string
+	}{
+		{"configured token wins", "", "configured", map[string]string{"GITLAB_TOKEN": "env"}, "configured"},
+		{"GITLAB_TOKEN before GITLAB_ACCESS_TOKEN", "", "", map[string]string{"GITLAB_TOKEN": "token", "GITLAB_ACCESS_TOKEN": "access"}, "token"},
+		{"GITLAB_ACCESS_TOKEN before glab", "", "", map[string]string{"GITLAB_ACCESS_TOKEN": "access"}, "access"},
+		{"glab config for gitlab.com", "", "", nil, "glab-token"},
+		{"self-managed ignores GITLAB_TOKEN", selfManaged, "", map[string]string{"GITLAB_TOKEN": "token"}, "self-managed-glab-token"},
+		{"GITLAB_HOST hands GITLAB_TOKEN to its host", selfManaged, "", map[string]string{"GITLAB_TOKEN": "token", "GITLAB_HOST": "gitlab.example.com"}, "token"},
+		{"GITLAB_HOST as a URL", selfManaged, "", map[string]string{"GITLAB_TOKEN": "token", "GITLAB_HOST": selfManaged}, "token"},
+		{"GITLAB_HOST elsewhere keeps GITLAB_TOKEN from gitlab.com", "", "", map[string]string{"GITLAB_TOKEN": "token", "GITLAB_HOST": "gitlab.example.com"}, "glab-token"},
+		{"host missing from glab config", "https://other.example.com", "", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Setenv("GLAB_CONFIG_DIR", dir)
+			for _, env := range []string{"GITLAB_TOKEN", "GITLAB_ACCESS_TOKEN", "GITLAB_HOST"} {
+				t.Setenv(env, tt.env[env])
+			}
+			if err := os.WriteFile(filepath.Join(dir, "config.yml"), []byte(configYML), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if got := ResolveToken(tt.baseURL, tt.configured); got != tt.want {
+				t.Errorf("ResolveToken = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
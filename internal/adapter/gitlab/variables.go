@@ -0,0 +1,141 @@
+package gitlab
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+
+	"github.com/stormingluke/autoenv/internal/adapter/syncpool"
+	"github.com/stormingluke/autoenv/internal/domain"
+	"github.com/stormingluke/autoenv/internal/port"
+)
+
+var _ port.SecretSyncer = (*VariableSyncer)(nil)
+
+// workers bounds how many variables are written at once.
+const workers = 4
+
+// perPage is the largest page GitLab returns.
+const perPage = 100
+
+// VariableSyncer writes GitLab project and group CI/CD variables through
+// the REST API.
+type VariableSyncer struct {
+	client *client
+}
+
+// NewVariableSyncer returns a syncer for the instance at baseURL
+// (DefaultURL when empty) authenticating with token.
+func NewVariableSyncer(baseURL, token string) *VariableSyncer {
+	return &VariableSyncer{client: newClient(baseURL, token)}
+}
+
+type variable struct {
+	Key              string `json:"key"`
+	EnvironmentScope string `json:"environment_scope"`
+}
+
+// List returns the variables in the target's environment scope; the same
+// key may also exist in other scopes.
+func (s *VariableSyncer) List(ctx context.Context, t domain.SyncTarget) ([]string, error) {
+	if err := s.checkToken(); err != nil {
+		return nil, err
+	}
+	var names []string
+	for page := 1; ; page++ {
+		var vars []variable
+		path := fmt.Sprintf("%s?per_page=%d&page=%d", collectionPath(t), perPage, page)
+		if _, err := s.client.do(ctx, http.MethodGet, path, nil, &vars); err != nil {
+			return nil, fmt.Errorf("list variables in %s: %w", t, err)
+		}
+		for _, v := range vars {
+			if v.EnvironmentScope == scope(t) {
+				names = append(names, v.Key)
+			}
+		}
+		if len(vars) < perPage {
+			return names, nil
+		}
+	}
+}
+
+// Sync updates each variable, creating the ones that do not exist yet.
+func (s *VariableSyncer) Sync(ctx context.Context, t domain.SyncTarget, values map[string]string) ([]domain.KeyResult, error) {
+	if err := s.checkToken(); err != nil {
+		return nil, err
+	}
+	return syncpool.Run(ctx, workers, sortedKeys(values), func(ctx context.Context, key string) error {
+		body := map[string]any{
+			"key":               key,
+			"value":             values[key],
+			"variable_type":     "env_var",
+			"environment_scope": scope(t),
+			"protected":         t.Protected,
+			"masked":            t.Masked,
+			// Values are pushed as written in .env, without GitLab
+			// expanding $REFERENCES in them.
+			"raw": true,
+		}
+		_, err := s.client.do(ctx, http.MethodPut, variablePath(t, key), body, nil)
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+			_, err = s.client.do(ctx, http.MethodPost, collectionPath(t), body, nil)
+		}
+		return err
+	})
+}
+
+func (s *VariableSyncer) Delete(ctx context.Context, t domain.SyncTarget, names []string) ([]domain.KeyResult, error) {
+	if err := s.checkToken(); err != nil {
+		return nil, err
+	}
+	sorted := append([]string(nil), names...)
+	sort.Strings(sorted)
+	return syncpool.Run(ctx, workers, sorted, func(ctx context.Context, key string) error {
+		_, err := s.client.do(ctx, http.MethodDelete, variablePath(t, key), nil, nil)
+		return err
+	})
+}
+
+func (s *VariableSyncer) checkToken() error {
+	if s.client.token == "" {
+		return fmt.Errorf("no GitLab token: set GITLAB_TOKEN or AUTOENV_GITLAB_TOKEN, or run `glab auth login`")
+	}
+	return nil
+}
+
+// collectionPath is the API path of a project's or group's variables.
+// Namespaced paths stand in for numeric IDs once URL-encoded.
+func collectionPath(t domain.SyncTarget) string {
+	if t.IsOrg() {
+		return "/groups/" + url.PathEscape(t.Owner) + "/variables"
+	}
+	return "/projects/" + url.PathEscape(t.Owner+"/"+t.Repo) + "/variables"
+}
+
+// variablePath addresses one variable within the target's environment
+// scope.
+func variablePath(t domain.SyncTarget, key string) string {
+	filter := url.Values{"filter[environment_scope]": {scope(t)}}
+	return collectionPath(t) + "/" + url.PathEscape(key) + "?" + filter.Encode()
+}
+
+// scope is the target's environment scope, "*" for every environment.
+func scope(t domain.SyncTarget) string {
+	if t.Environment == "" {
+		return "*"
+	}
+	return t.Environment
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,241 @@
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stormingluke/autoenv/internal/adapter/httpretry"
+	"github.com/stormingluke/autoenv/internal/domain"
+)
+
+// request is one call the fake GitLab received.
+type request struct {
+	route string
+	query string
+	body  map[string]any
+}
+
+// fakeAPI is a GitLab REST stand-in. Handlers are keyed by "METHOD path",
+// with the path as sent, still URL-encoded, and below /api/v4.
+type fakeAPI struct {
+	t        *testing.T
+	mu       sync.Mutex
+	requests []request
+	handlers map[string]http.HandlerFunc
+}
+
+func newFakeAPI(t *testing.T) (*fakeAPI, *VariableSyncer) {
+	t.Helper()
+	f := &fakeAPI{t: t, handlers: make(map[string]http.HandlerFunc)}
+	srv := httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(srv.Close)
+	return f, NewVariableSyncer(srv.URL, "glpat-test")
+}
+
+func (f *fakeAPI) handle(route string, h http.HandlerFunc) { f.handlers[route] = h }
+
+func (f *fakeAPI) serve(w http.ResponseWriter, r *http.Request) {
+	if got := r.Header.Get("PRIVATE-TOKEN"); got != "glpat-test" {
+		f.t.Errorf("PRIVATE-TOKEN = %q", got)
+	}
+	req := request{route: r.Method + " " + r.URL.EscapedPath()[len("/api/v4"):], query: r.URL.RawQuery}
+	_ = json.NewDecoder(r.Body).Decode(&req.body)
+
+	f.mu.Lock()
+	f.requests = append(f.requests, req)
+	h := f.handlers[req.route]
+	f.mu.Unlock()
+
+	if h == nil {
+		reply(http.StatusOK, map[string]any{})(w, r)
+		return
+	}
+	h(w, r)
+}
+
+// sent returns the requests made to route, in order.
+func (f *fakeAPI) sent(route string) []request {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []request
+	for _, r := range f.requests {
+		if r.route == route {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+func reply(status int, v any) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(v)
+	}
+}
+
+// failing answers the first n requests with status and then passes to h.
+func failing(n, status int, h http.HandlerFunc) http.HandlerFunc {
+	var mu sync.Mutex
+	return func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fail := n > 0
+		n--
+		mu.Unlock()
+		if fail {
+			reply(status, map[string]string{"message": http.StatusText(status)})(w, r)
+			return
+		}
+		if h == nil {
+			h = reply(http.StatusOK, map[string]any{})
+		}
+		h(w, r)
+	}
+}
+
+func results(rs []domain.KeyResult) map[string]domain.KeyResult {
+	m := make(map[string]domain.KeyResult, len(rs))
+	for _, r := range rs {
+		m[r.Key] = r
+	}
+	return m
+}
+
+var project = domain.SyncTarget{Provider: domain.ProviderGitLab, Owner: "acme/backend", Repo: "api"}
+
+func TestOnlyIdempotentRequestsAreRetried(t *testing.T) {
+	defer func(d time.Duration) { httpretry.Base = d }(httpretry.Base)
+	httpretry.Base = time.Millisecond
+
+	f, s := newFakeAPI(t)
+	base := "/projects/acme%2Fbackend%2Fapi/variables"
+	f.handle("PUT "+base+"/OLD", failing(2, http.StatusServiceUnavailable, nil))
+	f.handle("PUT "+base+"/NEW", reply(http.StatusNotFound, map[string]string{"message": "404 Variable Not Found"}))
+	f.handle("POST "+base, failing(1, http.StatusBadGateway, nil))
+
+	rs, err := s.Sync(context.Background(), project, map[string]string{"NEW": "1", "OLD": "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := results(rs)
+	if n := len(f.sent("PUT " + base + "/OLD")); got["OLD"].Outcome != domain.KeyOK || n != 3 {
+		t.Errorf("OLD: %v after %d PUTs, want ok after 3", got["OLD"].Outcome, n)
+	}
+	// The failed POST may have created NEW, so it is reported, not resent.
+	if n := len(f.sent("POST " + base)); got["NEW"].Outcome != domain.KeyFailed || n != 1 {
+		t.Errorf("NEW: %v after %d POSTs, want failed after 1", got["NEW"].Outcome, n)
+	}
+}
+
+func TestSyncCreatesMissingVariablesInTheTargetScope(t *testing.T) {
+	tests := []struct {
+		name   string
+		target domain.SyncTarget
+		base   string
+		scope  string
+	}{
+		{"project", project, "/projects/acme%2Fbackend%2Fapi/variables", "*"},
+		{"environment", domain.SyncTarget{Owner: "acme/backend", Repo: "api", Environment: "production", Protected: true, Masked: true},
+			"/projects/acme%2Fbackend%2Fapi/variables", "production"},
+		{"group", domain.SyncTarget{Owner: "acme/platform"}, "/groups/acme%2Fplatform/variables", "*"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, s := newFakeAPI(t)
+			f.handle("PUT "+tt.base+"/NEW", reply(http.StatusNotFound, map[string]string{"message": "404 Variable Not Found"}))
+			f.handle("POST "+tt.base, reply(http.StatusCreated, map[string]any{}))
+
+			rs, err := s.Sync(context.Background(), tt.target, map[string]string{"NEW": "$HOME", "OLD": "2"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, r := range rs {
+				if r.Outcome != domain.KeyOK {
+					t.Errorf("%s: %v %v", r.Key, r.Outcome, r.Err)
+				}
+			}
+
+			for _, key := range []string{"NEW", "OLD"} {
+				puts := f.sent("PUT " + tt.base + "/" + key)
+				if len(puts) != 1 {
+					t.Fatalf("%s: %d PUTs, want 1", key, len(puts))
+				}
+				// Without the filter GitLab updates whichever scope it
+				// finds first.
+				q, _ := url.ParseQuery(puts[0].query)
+				if got := q.Get("filter[environment_scope]"); got != tt.scope {
+					t.Errorf("%s: PUT filter[environment_scope] = %q, want %q", key, got, tt.scope)
+				}
+			}
+			posts := f.sent("POST " + tt.base)
+			if len(posts) != 1 || posts[0].body["key"] != "NEW" {
+				t.Fatalf("POSTs = %v, want one creating NEW", posts)
+			}
+			want := map[string]any{
+				"key":               "NEW",
+				"value":             "$HOME",
+				"variable_type":     "env_var",
+				"environment_scope": tt.scope,
+				"protected":         tt.target.Protected,
+				"masked":            tt.target.Masked,
+				"raw":               true,
+			}
+			for field, v := range want {
+				if got := posts[0].body[field]; got != v {
+					t.Errorf("POST %s = %v, want %v", field, got, v)
+				}
+			}
+		})
+	}
+}
+
+func TestListPagesAndKeepsTheTargetScope(t *testing.T) {
+	f, s := newFakeAPI(t)
+	base := "/projects/acme%2Fbackend%2Fapi/variables"
+	// A full first page, then a short one: three requests would mean the
+	// short page was not taken as the last.
+	f.handle("GET "+base, func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		var vars []variable
+		switch page {
+		case 1:
+			for i := range perPage {
+				scope := "*"
+				if i%2 == 1 {
+					scope = "production"
+				}
+				vars = append(vars, variable{Key: "KEY_" + strconv.Itoa(i), EnvironmentScope: scope})
+			}
+		case 2:
+			vars = []variable{{Key: "LAST", EnvironmentScope: "production"}, {Key: "OTHER", EnvironmentScope: "staging"}}
+		}
+		reply(http.StatusOK, vars)(w, r)
+	})
+
+	target := project
+	target.Environment = "production"
+	names, err := s.List(context.Background(), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != perPage/2+1 || names[0] != "KEY_1" || names[len(names)-1] != "LAST" {
+		t.Errorf("List = %d names from %q to %q, want %d from KEY_1 to LAST", len(names), names[0], names[len(names)-1], perPage/2+1)
+	}
+	gets := f.sent("GET " + base)
+	if len(gets) != 2 {
+		t.Fatalf("%d pages requested, want 2", len(gets))
+	}
+	for i, g := range gets {
+		q, _ := url.ParseQuery(g.query)
+		if q.Get("per_page") != strconv.Itoa(perPage) || q.Get("page") != strconv.Itoa(i+1) {
+			t.Errorf("request %d query = %q", i+1, g.query)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// Package httpretry retries API requests hit by rate limits, server errors
+// and network failures, for the GitHub, GitLab and Vault clients.
+package httpretry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Requests are sent up to MaxAttempts times, waiting Base, then twice as
+// long each time, but never longer than MaxWait.
+const (
+	MaxAttempts = 5
+	MaxWait     = time.Minute
+)
+
+// Base is a variable so tests can shorten the backoff.
+var Base = time.Second
+
+// Do calls send until it succeeds or fails for good. A network error is
+// always worth another attempt; any other error is retried when
+// temporary reports so, after the wait it returns if the server named
+// one. A wait longer than MaxWait gives up at once, and so does a
+// cancelled ctx.
+func Do(ctx context.Context, send func() error, temporary func(error) (wait time.Duration, ok bool)) error {
+	wait := Base
+	for attempt := 1; ; attempt++ {
+		err := send()
+		if err == nil || attempt == MaxAttempts || ctx.Err() != nil {
+			return err
+		}
+		asked, ok := temporary(err)
+		var urlErr *url.Error
+		if !ok && !errors.As(err, &urlErr) {
+			return err
+		}
+		if asked > 0 {
+			if asked > MaxWait {
+				return err
+			}
+			wait = asked
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		wait = min(2*wait, MaxWait)
+	}
+}
+
+// Idempotent reports whether a request can be sent again without risk.
+// A POST that failed with a server error or a dropped connection may
+// still have created what it was creating, and a second one would fail
+// or duplicate it; PUT, PATCH and DELETE only set or remove values.
+func Idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// RetryAfter reads the delay in seconds a server asked for in a
+// Retry-After header.
+func RetryAfter(h http.Header) (time.Duration, bool) {
+	secs, err := strconv.Atoi(h.Get("Retry-After"))
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(secs) * time.Second, true
+}
@@ -0,0 +1,97 @@
+package httpretry
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+)
+
+var (
+	errBusy  = errors.New("busy")
+	errFinal = errors.New("final")
+	errSlow  = errors.New("slow down")
+)
+
+func temporary(err error) (time.Duration, bool) {
+	switch err {
+	case errBusy:
+		return 0, true
+	case errSlow:
+		return time.Hour, true
+	default:
+		return 0, false
+	}
+}
+
+// sender fails with errs in order, then succeeds.
+func sender(calls *int, errs ...error) func() error {
+	return func() error {
+		*calls++
+		if *calls <= len(errs) {
+			return errs[*calls-1]
+		}
+		return nil
+	}
+}
+
+func TestDo(t *testing.T) {
+	defer func(d time.Duration) { Base = d }(Base)
+	Base = time.Millisecond
+	netErr := &url.Error{Op: "Get", URL: "http://x", Err: errors.New("connection refused")}
+
+	tests := []struct {
+		name  string
+		errs  []error
+		want  error
+		calls int
+	}{
+		{"success", nil, nil, 1},
+		{"temporary failures", []error{errBusy, errBusy}, nil, 3},
+		{"network failure", []error{netErr}, nil, 2},
+		{"permanent failure", []error{errBusy, errFinal}, errFinal, 2},
+		{"out of attempts", []error{errBusy, errBusy, errBusy, errBusy, errBusy, errBusy}, errBusy, MaxAttempts},
+		{"asked to wait too long", []error{errSlow}, errSlow, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := Do(context.Background(), sender(&calls, tt.errs...), temporary)
+			if !errors.Is(err, tt.want) || calls != tt.calls {
+				t.Errorf("Do = %v after %d calls, want %v after %d", err, calls, tt.want, tt.calls)
+			}
+		})
+	}
+}
+
+func TestDoWaitsAsAsked(t *testing.T) {
+	defer func(d time.Duration) { Base = d }(Base)
+	Base = time.Hour
+
+	// Waiting Base instead would outlast the deadline.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	calls := 0
+	err := Do(ctx, sender(&calls, errBusy), func(error) (time.Duration, bool) {
+		return 10 * time.Millisecond, true
+	})
+	if err != nil || calls != 2 {
+		t.Errorf("Do = %v after %d calls, want success after 2", err, calls)
+	}
+}
+
+func TestDoStopsWhenCancelled(t *testing.T) {
+	defer func(d time.Duration) { Base = d }(Base)
+	Base = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	if err := Do(ctx, sender(&calls, errBusy, errBusy), temporary); !errors.Is(err, context.Canceled) || calls != 1 {
+		t.Errorf("Do = %v after %d calls, want context.Canceled after 1", err, calls)
+	}
+}
@@ -0,0 +1,62 @@
+package source
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/stormingluke/autoenv/internal/domain"
+	"github.com/stormingluke/autoenv/internal/port"
+)
+
+var _ port.SecretSource = (*ExecSource)(nil)
+
+// PluginPrefix names plugin executables: exec://op/... runs
+// autoenv-source-op from PATH.
+const PluginPrefix = "autoenv-source-"
+
+// ExecSource runs a plugin and reads values from its standard output, as
+// dotenv or a JSON object. The plugin gets the target's reference as its
+// only argument and an empty stdin; its stderr is autoenv's, and a plugin
+// that must prompt to sign in opens /dev/tty itself.
+type ExecSource struct{}
+
+func NewExecSource() *ExecSource {
+	return &ExecSource{}
+}
+
+func (s *ExecSource) Fetch(ctx context.Context, t domain.SyncTarget) (map[string]string, error) {
+	name := PluginPrefix + t.Owner
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s not found in PATH", name)
+	}
+
+	var args []string
+	if t.Repo != "" {
+		args = append(args, t.Repo)
+	}
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Stdout = &out
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("plugin %s failed: %v", name, exitErr)
+		}
+		return nil, fmt.Errorf("run plugin %s: %w", name, err)
+	}
+
+	values, err := parse("", out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("parse output of plugin %s: %w", name, err)
+	}
+	return values, nil
+}
@@ -0,0 +1,33 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/stormingluke/autoenv/internal/domain"
+	"github.com/stormingluke/autoenv/internal/port"
+)
+
+var _ port.SecretSource = (*FileSource)(nil)
+
+// FileSource reads values from a local dotenv, JSON or YAML file, such as
+// a shared file on a mounted drive or a decrypted copy checked out by
+// another tool.
+type FileSource struct{}
+
+func NewFileSource() *FileSource {
+	return &FileSource{}
+}
+
+func (s *FileSource) Fetch(ctx context.Context, t domain.SyncTarget) (map[string]string, error) {
+	data, err := os.ReadFile(t.Repo)
+	if err != nil {
+		return nil, err
+	}
+	values, err := parse(t.Repo, data)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", t.Repo, err)
+	}
+	return values, nil
+}
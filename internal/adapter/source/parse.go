@@ -0,0 +1,24 @@
+package source
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"github.com/stormingluke/autoenv/internal/adapter/format"
+)
+
+// parse reads dotenv unless the data is a JSON object or, for a file
+// named *.json, *.yaml or *.yml, whatever `autoenv import` would detect.
+func parse(name string, data []byte) (map[string]string, error) {
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext != ".json" && ext != ".yaml" && ext != ".yml" && !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		return godotenv.UnmarshalBytes(data)
+	}
+	parser, err := format.NewParser(format.Detect(data), format.Options{})
+	if err != nil {
+		return nil, err
+	}
+	return parser.Parse(data)
+}
@@ -0,0 +1,418 @@
+package sqlite
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/stormingluke/autoenv/internal/domain"
+	"github.com/stormingluke/autoenv/internal/port"
+)
+
+// The conformance suite checks the repositories against their port
+// contracts. It has no build tags, so running the tests with
+// CGO_ENABLED=1 and CGO_ENABLED=0 covers both the libsql and the pure-Go
+// driver.
+
+// registry is a migrated projects database with two devices sharing it
+// and a home directory used as the "~" root on both.
+type registry struct {
+	home  string
+	repo  *ProjectRepo
+	other *ProjectRepo
+}
+
+func newRegistry(t *testing.T) *registry {
+	t.Helper()
+	db := openTestDB(t, "projects.db")
+	if err := migrateProjects(db); err != nil {
+		t.Fatal(err)
+	}
+	home := t.TempDir()
+	roots := domain.PathRoots{{Name: "~", Dir: home}}
+	return &registry{
+		home:  home,
+		repo:  NewProjectRepo(db, "this-device", roots),
+		other: NewProjectRepo(db, "other-device", roots),
+	}
+}
+
+// dir creates a directory below the home root and returns its path.
+func (r *registry) dir(t *testing.T, rel string) string {
+	t.Helper()
+	path := filepath.Join(r.home, filepath.FromSlash(rel))
+	if err := os.MkdirAll(path, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// add registers a project and returns it as the repository reports it.
+func (r *registry) add(t *testing.T, repo *ProjectRepo, rel, name string) *domain.Project {
+	t.Helper()
+	path := r.dir(t, rel)
+	if err := repo.Upsert(path, name, ""); err != nil {
+		t.Fatalf("Upsert %s: %v", rel, err)
+	}
+	p, err := repo.FindByName(name)
+	if err != nil || p == nil {
+		t.Fatalf("FindByName %s = %v, %v", name, p, err)
+	}
+	return p
+}
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+var _ port.ProjectRepository = (*ProjectRepo)(nil)
+
+func TestProjectRepositoryConformance(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, r *registry)
+	}{
+		{"upsert stores a portable path and this device's location", func(t *testing.T, r *registry) {
+			p := r.add(t, r.repo, "code/api", "api")
+			if p.PortablePath != "~/code/api" || p.Path != filepath.Join(r.home, "code", "api") || p.Status != domain.StatusOK {
+				t.Errorf("got %q at %q (%v)", p.PortablePath, p.Path, p.Status)
+			}
+			byPath, err := r.repo.FindByPath(p.Path)
+			must(t, err)
+			byID, err := r.repo.FindByID(p.ID)
+			must(t, err)
+			if byPath == nil || byID == nil || byPath.ID != p.ID || byID.Name != "api" {
+				t.Errorf("FindByPath = %+v, FindByID = %+v", byPath, byID)
+			}
+		}},
+		{"upsert of a known path updates it in place", func(t *testing.T, r *registry) {
+			p := r.add(t, r.repo, "code/api", "api")
+			must(t, r.repo.Upsert(p.Path, "", "git@example.com:me/api.git"))
+			must(t, r.repo.Upsert(p.Path, "api2", ""))
+			all, err := r.repo.ListAll()
+			must(t, err)
+			if len(all) != 1 || all[0].ID != p.ID || all[0].Name != "api2" || all[0].RemoteURL != "git@example.com:me/api.git" {
+				t.Errorf("ListAll = %+v", all)
+			}
+		}},
+		{"another device registering the same portable path shares the project", func(t *testing.T, r *registry) {
+			p := r.add(t, r.repo, "code/api", "api")
+			must(t, r.other.Upsert(p.Path, "api", ""))
+			all, err := r.repo.ListAll()
+			must(t, err)
+			if len(all) != 1 || all[0].OtherDevices != 1 {
+				t.Errorf("ListAll = %+v, want one project seen on one other device", all)
+			}
+		}},
+		{"a project checked out elsewhere resolves through its portable path", func(t *testing.T, r *registry) {
+			p := r.add(t, r.other, "code/api", "api")
+			got, err := r.repo.FindByID(p.ID)
+			must(t, err)
+			if got.Path != p.Path || got.Status != domain.StatusOK {
+				t.Errorf("got %q (%v), want %q", got.Path, got.Status, p.Path)
+			}
+			must(t, os.RemoveAll(p.Path))
+			got, err = r.repo.FindByID(p.ID)
+			must(t, err)
+			if got.Path != "" || got.Status != domain.StatusNotCheckedOut {
+				t.Errorf("got %q (%v), want not checked out", got.Path, got.Status)
+			}
+		}},
+		{"a recorded location that disappeared is missing", func(t *testing.T, r *registry) {
+			p := r.add(t, r.repo, "code/api", "api")
+			must(t, os.RemoveAll(p.Path))
+			got, err := r.repo.FindByID(p.ID)
+			must(t, err)
+			if got.Status != domain.StatusMissing {
+				t.Errorf("status = %v, want missing", got.Status)
+			}
+		}},
+		{"find by path matches this device's location or a portable path checked out here", func(t *testing.T, r *registry) {
+			api := r.add(t, r.repo, "code/api", "api")
+			web := r.add(t, r.other, "code/web", "web")
+			gone := r.add(t, r.other, "code/gone", "gone")
+			must(t, os.RemoveAll(gone.Path))
+			missing := r.add(t, r.repo, "code/missing", "missing")
+			must(t, os.RemoveAll(missing.Path))
+			cases := map[string]string{
+				api.Path:                       "api",
+				web.Path:                       "web",
+				gone.Path:                      "",
+				missing.Path:                   "missing",
+				filepath.Join(api.Path, "src"): "",
+				r.dir(t, "code/other"):         "",
+			}
+			for path, want := range cases {
+				p, err := r.repo.FindByPath(path)
+				must(t, err)
+				got := ""
+				if p != nil {
+					got = p.Name
+				}
+				if got != want {
+					t.Errorf("FindByPath(%s) = %q, want %q", path, got, want)
+				}
+			}
+		}},
+		{"match current prefers the most nested project", func(t *testing.T, r *registry) {
+			mono := r.add(t, r.repo, "code/mono", "mono")
+			web := r.add(t, r.repo, "code/mono/web", "web")
+			shared := r.add(t, r.other, "code/mono/shared", "shared")
+			cases := map[string]string{
+				mono.Path:                                 "mono",
+				filepath.Join(web.Path, "src", "pages"):   "web",
+				filepath.Join(mono.Path, "..web"):         "mono",
+				filepath.Join(shared.Path, "lib"):         "shared",
+				filepath.Join(r.home, "code", "monorail"): "",
+				r.home: "",
+			}
+			for dir, want := range cases {
+				p, err := r.repo.MatchCurrent(dir)
+				must(t, err)
+				got := ""
+				if p != nil {
+					got = p.Name
+				}
+				if got != want {
+					t.Errorf("MatchCurrent(%s) = %q, want %q", dir, got, want)
+				}
+			}
+		}},
+		{"a location recorded on this device outranks the portable path", func(t *testing.T, r *registry) {
+			p := r.add(t, r.repo, "code/api", "api")
+			moved := r.dir(t, "work/api")
+			must(t, r.repo.Relocate(p.ID, moved))
+			must(t, r.other.Upsert(r.dir(t, "code/api"), "old-api", ""))
+
+			got, err := r.repo.MatchCurrent(moved)
+			must(t, err)
+			if got == nil || got.ID != p.ID || got.Path != moved || got.PortablePath != "~/work/api" {
+				t.Errorf("MatchCurrent = %+v", got)
+			}
+		}},
+		{"relocating onto another project's path is refused", func(t *testing.T, r *registry) {
+			api := r.add(t, r.repo, "code/api", "api")
+			web := r.add(t, r.repo, "code/web", "web")
+			if err := r.repo.Relocate(api.ID, web.Path); !errors.Is(err, domain.ErrPathTaken) {
+				t.Errorf("Relocate = %v, want ErrPathTaken", err)
+			}
+			got, err := r.repo.FindByID(api.ID)
+			must(t, err)
+			if got.Path != api.Path {
+				t.Errorf("path = %q after a refused relocate", got.Path)
+			}
+		}},
+		{"rename, describe, tag and fingerprint", func(t *testing.T, r *registry) {
+			p := r.add(t, r.repo, "code/api", "api")
+			must(t, r.repo.Rename(p.ID, "backend"))
+			must(t, r.repo.SetDescription(p.ID, "the API"))
+			must(t, r.repo.AddTags(p.ID, []string{"work", "go", "work"}))
+			must(t, r.repo.RemoveTags(p.ID, []string{"work"}))
+			must(t, r.repo.AddTags(p.ID, []string{"api"}))
+			must(t, r.repo.SetFingerprint(p.ID, "abc123"))
+			got, err := r.repo.FindByName("backend")
+			must(t, err)
+			if got == nil || got.Description != "the API" || !slices.Equal(got.Tags, []string{"api", "go"}) || got.Fingerprint != "abc123" {
+				t.Errorf("got %+v", got)
+			}
+		}},
+		{"remove location keeps the project for other devices", func(t *testing.T, r *registry) {
+			p := r.add(t, r.repo, "code/api", "api")
+			must(t, r.other.Upsert(p.Path, "api", ""))
+			must(t, r.repo.RemoveLocation(p.ID))
+			got, err := r.other.FindByID(p.ID)
+			must(t, err)
+			if got == nil || got.OtherDevices != 0 {
+				t.Errorf("got %+v, want the project with no other devices", got)
+			}
+		}},
+		{"sync rules round trip and clear", func(t *testing.T, r *registry) {
+			p := r.add(t, r.repo, "code/api", "api")
+			rules := domain.SyncRules{
+				Include:     []string{"API_*"},
+				Exclude:     []string{"API_DEBUG"},
+				StripPrefix: "API_",
+				AddPrefix:   "APP_",
+				Rename:      map[string]string{"API_KEY": "TOKEN"},
+			}
+			must(t, r.repo.SetSyncRules(p.ID, rules))
+			got, err := r.repo.SyncRules(p.ID)
+			must(t, err)
+			if !slices.Equal(got.Include, rules.Include) || !slices.Equal(got.Exclude, rules.Exclude) ||
+				got.StripPrefix != "API_" || got.AddPrefix != "APP_" || got.Rename["API_KEY"] != "TOKEN" {
+				t.Errorf("SyncRules = %+v", got)
+			}
+			must(t, r.repo.SetSyncRules(p.ID, domain.SyncRules{}))
+			if got, err := r.repo.SyncRules(p.ID); err != nil || !got.IsZero() {
+				t.Errorf("SyncRules after clearing = %+v, %v", got, err)
+			}
+		}},
+		{"named sync targets are saved, replaced and removed", func(t *testing.T, r *registry) {
+			p := r.add(t, r.repo, "code/api", "api")
+			must(t, r.repo.SaveSyncTarget(p.ID, domain.NamedSyncTarget{Name: "staging", Target: "me/api", Environment: "staging"}))
+			must(t, r.repo.SaveSyncTarget(p.ID, domain.NamedSyncTarget{Name: "ci", Target: "gitlab.com/me/api", Protected: true, Masked: true}))
+			must(t, r.repo.SaveSyncTarget(p.ID, domain.NamedSyncTarget{Name: "staging", Target: "me/api", Environment: "stage"}))
+			got, err := r.repo.SyncTargets(p.ID)
+			must(t, err)
+			if len(got) != 2 || got[0].Name != "ci" || !got[0].Protected || !got[0].Masked || got[1].Environment != "stage" {
+				t.Errorf("SyncTargets = %+v", got)
+			}
+			must(t, r.repo.RemoveSyncTarget(p.ID, "ci"))
+			if got, err := r.repo.SyncTargets(p.ID); err != nil || len(got) != 1 {
+				t.Errorf("SyncTargets after remove = %+v, %v", got, err)
+			}
+		}},
+		{"delete removes the project and everything attached to it", func(t *testing.T, r *registry) {
+			p := r.add(t, r.repo, "code/api", "api")
+			keep := r.add(t, r.repo, "code/web", "web")
+			must(t, r.repo.AddTags(p.ID, []string{"go"}))
+			must(t, r.repo.SetSyncRules(p.ID, domain.SyncRules{Include: []string{"A"}, Rename: map[string]string{"A": "B"}}))
+			must(t, r.repo.SaveSyncTarget(p.ID, domain.NamedSyncTarget{Name: "ci", Target: "me/api"}))
+			must(t, r.repo.Delete(p.ID))
+
+			if got, err := r.repo.FindByID(p.ID); err != nil || got != nil {
+				t.Errorf("FindByID after delete = %+v, %v", got, err)
+			}
+			for _, table := range []string{"project_tags", "project_locations", "project_sync_rules", "project_sync_renames", "project_sync_targets"} {
+				var n int
+				must(t, r.repo.db.QueryRow(`SELECT count(*) FROM `+table+` WHERE project_id = ?`, p.ID).Scan(&n))
+				if n != 0 {
+					t.Errorf("%s still has %d rows", table, n)
+				}
+			}
+			if got, err := r.repo.FindByID(keep.ID); err != nil || got == nil {
+				t.Errorf("other project gone: %v", err)
+			}
+		}},
+		{"list all orders by name", func(t *testing.T, r *registry) {
+			r.add(t, r.repo, "code/b", "beta")
+			r.add(t, r.repo, "code/a", "alpha")
+			r.add(t, r.other, "code/c", "gamma")
+			all, err := r.repo.ListAll()
+			must(t, err)
+			var names []string
+			for _, p := range all {
+				names = append(names, p.Name)
+			}
+			if !slices.Equal(names, []string{"alpha", "beta", "gamma"}) {
+				t.Errorf("ListAll names = %q", names)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) { tt.run(t, newRegistry(t)) })
+	}
+}
+
+var _ port.SessionRepository = (*SessionRepo)(nil)
+
+func TestSessionRepositoryConformance(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, r *SessionRepo)
+	}{
+		{"an unknown shell has no session", func(t *testing.T, r *SessionRepo) {
+			s, err := r.Get(1)
+			must(t, err)
+			keys, err := r.GetKeys(1)
+			must(t, err)
+			if s != nil || len(keys) != 0 {
+				t.Errorf("Get = %+v, GetKeys = %+v", s, keys)
+			}
+		}},
+		{"upsert creates and then moves a session", func(t *testing.T, r *SessionRepo) {
+			must(t, r.Upsert(7, "/src/api", 100, false))
+			must(t, r.Upsert(7, "/src/web", 200, true))
+			s, err := r.Get(7)
+			must(t, err)
+			if s == nil || s.ShellPID != 7 || s.ProjectPath != "/src/web" || s.EnvFileMtime != 200 || !s.Pulled || s.LoadedAt == "" {
+				t.Errorf("Get = %+v", s)
+			}
+		}},
+		{"set keys replaces the previous keys", func(t *testing.T, r *SessionRepo) {
+			must(t, r.Upsert(7, "/src/api", 100, false))
+			must(t, r.SetKeys(7, map[string]string{"A": "h1", "B": "h2"}))
+			must(t, r.SetKeys(7, map[string]string{"B": "h3", "C": "h4"}))
+			keys, err := r.GetKeys(7)
+			must(t, err)
+			got := make(map[string]string)
+			for _, k := range keys {
+				got[k.KeyName] = k.KeyHash
+			}
+			if len(got) != 2 || got["B"] != "h3" || got["C"] != "h4" {
+				t.Errorf("GetKeys = %+v", keys)
+			}
+		}},
+		{"delete removes the session and its keys", func(t *testing.T, r *SessionRepo) {
+			must(t, r.Upsert(7, "/src/api", 100, false))
+			must(t, r.SetKeys(7, map[string]string{"A": "h1"}))
+			must(t, r.Upsert(8, "/src/web", 100, false))
+			must(t, r.SetKeys(8, map[string]string{"B": "h2"}))
+			must(t, r.Delete(7))
+			s, err := r.Get(7)
+			must(t, err)
+			keys, err := r.GetKeys(7)
+			must(t, err)
+			if s != nil || len(keys) != 0 {
+				t.Errorf("after delete: Get = %+v, GetKeys = %+v", s, keys)
+			}
+			if keys, err := r.GetKeys(8); err != nil || len(keys) != 1 {
+				t.Errorf("other shell's keys = %+v, %v", keys, err)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t, "sessions.db")
+			must(t, migrateSessions(db, lazyTestDB(t, "state.db", migrateState)))
+			tt.run(t, NewSessionRepo(db))
+		})
+	}
+}
+
+var _ port.ConfigStore = (*DefaultsRepo)(nil)
+
+func TestConfigStoreConformance(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, r *DefaultsRepo)
+	}{
+		{"an unset key is an error", func(t *testing.T, r *DefaultsRepo) {
+			if _, err := r.Get(domain.PathRootsKey); err == nil {
+				t.Error("Get of an unset key succeeded")
+			}
+		}},
+		{"set overwrites and list is sorted by key", func(t *testing.T, r *DefaultsRepo) {
+			must(t, r.Set("sync.interval", "1h"))
+			must(t, r.Set("github.default_owner", "me"))
+			must(t, r.Set("sync.interval", "30m"))
+			if v, err := r.Get("sync.interval"); err != nil || v != "30m" {
+				t.Errorf("Get = %q, %v", v, err)
+			}
+			got, err := r.List()
+			must(t, err)
+			want := []domain.DefaultSetting{{Key: "github.default_owner", Value: "me"}, {Key: "sync.interval", Value: "30m"}}
+			if !slices.Equal(got, want) {
+				t.Errorf("List = %+v, want %+v", got, want)
+			}
+		}},
+		{"an empty value is kept", func(t *testing.T, r *DefaultsRepo) {
+			must(t, r.Set("github.default_owner", ""))
+			if v, err := r.Get("github.default_owner"); err != nil || v != "" {
+				t.Errorf("Get = %q, %v", v, err)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t, "projects.db")
+			must(t, migrateProjects(db))
+			tt.run(t, NewDefaultsRepo(db))
+		})
+	}
+}
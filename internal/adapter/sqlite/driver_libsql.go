@@ -0,0 +1,39 @@
+//go:build cgo
+
+package sqlite
+
+import (
+	"github.com/stormingluke/autoenv/internal/domain"
+	"github.com/tursodatabase/go-libsql"
+)
+
+// driverName is the database/sql driver the adapter opens files with.
+// libsql needs CGO; builds without it use driver_purego.go instead.
+const driverName = "libsql"
+
+// encryptionSupported reports whether PRAGMA key is available.
+const encryptionSupported = true
+
+type libsqlReplica struct {
+	*libsql.Connector
+}
+
+func (r libsqlReplica) Sync() (domain.Replication, error) {
+	s, err := r.Connector.Sync()
+	return domain.Replication{FrameNo: s.FrameNo, FramesSynced: s.FramesSynced}, err
+}
+
+func openReplicaConnector(dbPath, tursoURL, authToken, key string) (replicaConnector, error) {
+	opts := []libsql.Option{
+		libsql.WithAuthToken(authToken),
+		libsql.WithSyncInterval(0),
+	}
+	if key != "" {
+		opts = append(opts, libsql.WithEncryption(key))
+	}
+	c, err := libsql.NewEmbeddedReplicaConnector(dbPath, tursoURL, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return libsqlReplica{c}, nil
+}
@@ -0,0 +1,16 @@
+//go:build !cgo
+
+package sqlite
+
+import _ "modernc.org/sqlite"
+
+// driverName is the pure-Go SQLite driver used when CGO is disabled. It
+// reads and writes the same files as libsql but has no Turso replication
+// and no encryption.
+const driverName = "sqlite"
+
+const encryptionSupported = false
+
+func openReplicaConnector(_, _, _, _ string) (replicaConnector, error) {
+	return nil, errNoReplication
+}
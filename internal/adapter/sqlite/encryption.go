@@ -0,0 +1,178 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// keyedConnector opens libsql connections and unlocks each one with
+// PRAGMA key before database/sql hands it out, so reconnects after an
+// idle timeout or a bad connection stay decrypted.
+type keyedConnector struct {
+	drv driver.Driver
+	dsn string
+	key string
+}
+
+func (c *keyedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.drv.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := pragmaConn(ctx, conn, "PRAGMA key = "+quoteKey(c.key)); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("set encryption key: %w", err)
+	}
+	return conn, nil
+}
+
+func (c *keyedConnector) Driver() driver.Driver { return c.drv }
+
+func pragmaConn(ctx context.Context, conn driver.Conn, stmt string) error {
+	q, ok := conn.(driver.QueryerContext)
+	if !ok {
+		return fmt.Errorf("driver does not support queries")
+	}
+	rows, err := q.QueryContext(ctx, stmt, nil)
+	if err != nil {
+		return err
+	}
+	return rows.Close()
+}
+
+// errNoEncryption is returned for a key in builds whose driver cannot
+// encrypt.
+var errNoEncryption = errors.New("database encryption is not available in builds without CGO")
+
+// CheckEncryption reports whether this build can encrypt databases.
+func CheckEncryption() error {
+	if !encryptionSupported {
+		return errNoEncryption
+	}
+	return nil
+}
+
+// openDB opens dsn, encrypted with key unless key is empty.
+func openDB(dsn, key string) (*sql.DB, error) {
+	if key != "" {
+		if err := CheckEncryption(); err != nil {
+			return nil, err
+		}
+	}
+	db, err := sql.Open(driverName, dsn)
+	if err != nil || key == "" {
+		return db, err
+	}
+	drv := db.Driver()
+	_ = db.Close()
+	return sql.OpenDB(&keyedConnector{drv: drv, dsn: dsn, key: key}), nil
+}
+
+func quoteKey(key string) string {
+	return "'" + strings.ReplaceAll(key, "'", "''") + "'"
+}
+
+// pragma runs a pragma that may return rows, which libsql refuses to
+// execute through Exec.
+func pragma(db *sql.DB, stmt string) error {
+	rows, err := db.Query(stmt)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+	}
+	if err := rows.Err(); err != nil {
+		_ = rows.Close()
+		return err
+	}
+	return rows.Close()
+}
+
+// checkReadable fails clearly when the key does not match the database,
+// rather than on the first real query.
+func checkReadable(db *sql.DB, path string) error {
+	var n int
+	if err := db.QueryRow(`SELECT count(*) FROM sqlite_master`).Scan(&n); err != nil {
+		return fmt.Errorf("cannot read %s: wrong or missing encryption key (set AUTOENV_DB_PASSPHRASE or AUTOENV_DB_KEY_FILE): %w", path, err)
+	}
+	return nil
+}
+
+// Unlocks reports whether key opens the database at path; an empty key
+// stands for plaintext.
+func Unlocks(path, key string) bool {
+	db, err := openDB(fmt.Sprintf("file:%s", path), key)
+	if err != nil {
+		return false
+	}
+	db.SetMaxOpenConns(1)
+	defer func() { _ = db.Close() }()
+	_ = pragma(db, "PRAGMA busy_timeout = 5000")
+	return checkReadable(db, path) == nil
+}
+
+// Rekey changes the encryption key of a local database in place. An
+// empty oldKey encrypts a plaintext database; an empty newKey decrypts.
+// A database that already opens with newKey is left alone, so a rekey
+// that failed halfway can be run again.
+func Rekey(path, oldKey, newKey string) error {
+	db, err := openDB(fmt.Sprintf("file:%s", path), oldKey)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", path, err)
+	}
+	db.SetMaxOpenConns(1)
+	defer func() { _ = db.Close() }()
+
+	// A connection closed a moment ago can still hold a lock.
+	_ = pragma(db, "PRAGMA busy_timeout = 5000")
+	if err := checkReadable(db, path); err != nil {
+		_ = db.Close()
+		if Unlocks(path, newKey) {
+			return nil
+		}
+		return err
+	}
+	// Rekeying is not supported in WAL mode; OpenLocal restores WAL.
+	if err := leaveWAL(db); err != nil {
+		return fmt.Errorf("leave WAL mode: %w", err)
+	}
+	if err := pragma(db, "PRAGMA rekey = "+quoteKey(newKey)); err != nil {
+		return fmt.Errorf("rekey %s: %w", path, err)
+	}
+	_ = db.Close()
+
+	check, err := OpenLocal(path, newKey)
+	if err != nil {
+		return err
+	}
+	return check.Close()
+}
+
+// leaveWAL switches db to a rollback journal. Leaving WAL needs the only
+// lock on the file and does not wait for it, so it is retried while a
+// connection libsql is still closing in the background lets go.
+func leaveWAL(db *sql.DB) error {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		err := pragma(db, "PRAGMA journal_mode=DELETE")
+		if err == nil || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// restrictFiles makes a database and its WAL files private to the user.
+func restrictFiles(path string) {
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		if _, err := os.Stat(path + suffix); err == nil {
+			_ = os.Chmod(path+suffix, 0o600)
+		}
+	}
+}
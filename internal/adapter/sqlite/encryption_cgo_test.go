@@ -0,0 +1,107 @@
+//go:build cgo
+
+package sqlite
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// plaintextDB creates a database at path holding one row.
+func plaintextDB(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "state.db")
+	db, err := OpenLocal(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	execTest(t, db, `CREATE TABLE kv (k TEXT PRIMARY KEY, v TEXT NOT NULL)`, `INSERT INTO kv VALUES ('a', '1')`)
+	_ = db.Close()
+	return path
+}
+
+// checkOpens verifies that key, and no other of the keys tried, reads
+// the row back.
+func checkOpens(t *testing.T, path, key string) {
+	t.Helper()
+	for _, k := range []string{"", "first key", "second key", "wrong"} {
+		db, err := OpenLocal(path, k)
+		if k != key {
+			if err == nil {
+				_ = db.Close()
+				t.Errorf("opened with %q, want only %q", k, key)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("open with %q: %v", k, err)
+		}
+		var v string
+		if err := db.QueryRow(`SELECT v FROM kv WHERE k = 'a'`).Scan(&v); err != nil || v != "1" {
+			t.Errorf("read with %q = %q, %v", k, v, err)
+		}
+		_ = db.Close()
+	}
+}
+
+func TestRekeyEncryptsRekeysAndDecrypts(t *testing.T) {
+	path := plaintextDB(t)
+	steps := []struct{ from, to string }{
+		{"", "first key"},
+		{"first key", "second key"},
+		{"second key", ""},
+	}
+	for _, s := range steps {
+		if err := Rekey(path, s.from, s.to); err != nil {
+			t.Fatalf("Rekey(%q -> %q): %v", s.from, s.to, err)
+		}
+		checkOpens(t, path, s.to)
+	}
+}
+
+func TestRekeyWithTheWrongKeyChangesNothing(t *testing.T) {
+	path := plaintextDB(t)
+	if err := Rekey(path, "", "first key"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Rekey(path, "wrong", "second key"); err == nil {
+		t.Fatal("rekeyed with the wrong key")
+	}
+	checkOpens(t, path, "first key")
+}
+
+// A rerun after a partial failure finds some databases already under the
+// new key and must leave them be, although the old key no longer opens
+// them.
+func TestRekeySkipsADatabaseAlreadyUnderTheNewKey(t *testing.T) {
+	path := plaintextDB(t)
+	for range 2 {
+		if err := Rekey(path, "", "first key"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkOpens(t, path, "first key")
+}
+
+// The connector keys every connection, including ones opened after the
+// pool dropped the first.
+func TestKeyedConnectorKeysEveryConnection(t *testing.T) {
+	path := plaintextDB(t)
+	if err := Rekey(path, "", "first key"); err != nil {
+		t.Fatal(err)
+	}
+	db, err := openDB("file:"+path, "first key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = db.Close() }()
+	db.SetMaxIdleConns(0)
+	for range 3 {
+		if got := countRows(t, db, "kv"); got != 1 {
+			t.Errorf("kv = %d rows, want 1", got)
+		}
+	}
+	if !Unlocks(path, "first key") || Unlocks(path, "") || Unlocks(path, "wrong") {
+		t.Error("Unlocks disagrees with the key the database was encrypted with")
+	}
+}
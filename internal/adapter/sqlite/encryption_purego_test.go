@@ -0,0 +1,27 @@
+//go:build !cgo
+
+package sqlite
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// The pure-Go driver cannot encrypt, so a key must be an error instead of
+// a database silently left in plaintext.
+func TestEncryptionNeedsCGO(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+	if err := CheckEncryption(); !errors.Is(err, errNoEncryption) {
+		t.Errorf("CheckEncryption = %v, want errNoEncryption", err)
+	}
+	if db, err := OpenLocal(path, "key"); !errors.Is(err, errNoEncryption) {
+		if err == nil {
+			_ = db.Close()
+		}
+		t.Errorf("OpenLocal with a key = %v, want errNoEncryption", err)
+	}
+	if err := Rekey(path, "", "key"); !errors.Is(err, errNoEncryption) {
+		t.Errorf("Rekey = %v, want errNoEncryption", err)
+	}
+}
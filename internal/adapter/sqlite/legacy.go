@@ -0,0 +1,212 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// legacyTables lists what a pre-split sessions.db held and which of the
+// new databases each table belongs in.
+var legacyTables = []struct {
+	name    string
+	columns []string
+	state   bool
+}{
+	{"sessions", []string{"shell_pid", "project_path", "env_file_mtime", "loaded_at"}, false},
+	{"session_keys", []string{"shell_pid", "key_name", "key_hash"}, false},
+	{"project_usage", []string{"project_path", "last_used_at"}, true},
+	{"outbox", []string{"op", "args", "queued_at"}, true},
+	{"db_sync_log", []string{"synced_at", "frame_no", "frames_synced", "error"}, true},
+}
+
+// MigrateLegacySessions moves the sessions.db older versions kept in the
+// config directory: active sessions go to the runtime sessions database,
+// and usage, queued writes and sync history to the state database. The
+// old file is removed afterwards. It is a no-op once migrated, and only
+// opens the state database when there is something to move.
+//
+// The file is claimed by renaming it to legacyPath.migrating-<pid>, so a
+// concurrent shell does not copy it a second time. A failed migration
+// renames it back, and a claim left by a process that died is picked up
+// again.
+func MigrateLegacySessions(legacyPath, key string, sessions *sql.DB, state *LazyDB) error {
+	leftovers, err := filepath.Glob(legacyPath + ".migrating-*")
+	if err != nil {
+		return err
+	}
+	for _, path := range append(leftovers, legacyPath) {
+		if path != legacyPath && claimHeld(path) {
+			continue
+		}
+		claimed, err := claimLegacy(path, key)
+		if err != nil || claimed == "" {
+			return err
+		}
+		if err := moveLegacyTables(claimed, key, sessions, state); err != nil {
+			return errors.Join(err, releaseLegacy(claimed, legacyPath))
+		}
+		removeStaleDB(claimed)
+	}
+	return nil
+}
+
+// claimHeld reports whether the process named in a claimed file's suffix
+// is still running, and so may still be migrating it.
+func claimHeld(claimed string) bool {
+	pid, err := strconv.Atoi(claimed[strings.LastIndex(claimed, "-")+1:])
+	if err != nil || pid <= 0 {
+		return false
+	}
+	if pid == os.Getpid() {
+		return true
+	}
+	return !errors.Is(syscall.Kill(pid, 0), syscall.ESRCH)
+}
+
+// claimLegacy folds path's WAL into the main file and renames it to this
+// process's claim, returning "" if another process got to it first.
+func claimLegacy(path, key string) (string, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return "", nil
+	}
+	if err := checkpoint(path, key); err != nil {
+		return "", err
+	}
+	claimed := path
+	if i := strings.LastIndex(claimed, ".migrating-"); i >= 0 {
+		claimed = claimed[:i]
+	}
+	claimed += ".migrating-" + strconv.Itoa(os.Getpid())
+	if err := os.Rename(path, claimed); err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	removeStaleDB(path)
+	return claimed, nil
+}
+
+// releaseLegacy gives a claimed file back so the next run retries it:
+// under its original name, unless that has reappeared, in which case the
+// claim stays for a later run to pick up. Any WAL moves with it.
+func releaseLegacy(claimed, legacyPath string) error {
+	if _, err := os.Stat(legacyPath); err == nil {
+		return nil
+	}
+	for _, suffix := range []string{"-wal", "-shm", ""} {
+		err := os.Rename(claimed+suffix, legacyPath+suffix)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// moveLegacyTables copies each table out of the claimed file and drops it
+// there, so a retry after a failure copies only what is left.
+func moveLegacyTables(claimed, key string, sessions *sql.DB, state *LazyDB) error {
+	old, err := OpenLocal(claimed, key)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = pragma(old, "PRAGMA journal_mode=DELETE")
+		_ = old.Close()
+	}()
+	for _, t := range legacyTables {
+		ok, err := tableExists(old, t.name)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		dst := sessions
+		if t.state {
+			if dst, err = state.DB(); err != nil {
+				return err
+			}
+		}
+		if err := copyTable(old, dst, t.name, t.columns); err != nil {
+			return fmt.Errorf("migrate %s from %s: %w", t.name, claimed, err)
+		}
+		if _, err := old.Exec(`DROP TABLE ` + t.name); err != nil {
+			return fmt.Errorf("migrate %s from %s: %w", t.name, claimed, err)
+		}
+	}
+	return nil
+}
+
+// checkpoint folds a database's WAL into its main file, so the file can
+// be renamed on its own.
+func checkpoint(path, key string) error {
+	db, err := OpenLocal(path, key)
+	if err != nil {
+		return err
+	}
+	err = pragma(db, "PRAGMA journal_mode=DELETE")
+	_ = db.Close()
+	if err != nil {
+		return fmt.Errorf("checkpoint %s: %w", path, err)
+	}
+	return nil
+}
+
+// querier is a database or a transaction to read through.
+type querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func tableExists(q querier, table string) (bool, error) {
+	var n int
+	err := q.QueryRow(`SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, table).Scan(&n)
+	return n > 0, err
+}
+
+func copyTable(src querier, dst *sql.DB, table string, columns []string) error {
+	if ok, err := tableExists(src, table); err != nil || !ok {
+		return err
+	}
+
+	cols := strings.Join(columns, ", ")
+	rows, err := src.Query(fmt.Sprintf(`SELECT %s FROM %s ORDER BY rowid`, cols, table))
+	if err != nil {
+		return err
+	}
+	var records [][]any
+	for rows.Next() {
+		vals := make([]any, len(columns))
+		ptrs := make([]any, len(columns))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		records = append(records, vals)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	insert := fmt.Sprintf(`INSERT OR IGNORE INTO %s (%s) VALUES (?%s)`,
+		table, cols, strings.Repeat(", ?", len(columns)-1))
+	return inTx(dst, func(tx *sql.Tx) error {
+		for _, vals := range records {
+			if _, err := tx.Exec(insert, vals...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,122 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeLegacySessions creates a pre-split sessions.db at path with one row
+// in each table.
+func writeLegacySessions(t *testing.T, path string) {
+	t.Helper()
+	db, err := OpenLocal(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	execTest(t, db,
+		`CREATE TABLE sessions (shell_pid INTEGER PRIMARY KEY, project_path TEXT NOT NULL,
+			env_file_mtime INTEGER NOT NULL, loaded_at TEXT NOT NULL DEFAULT '')`,
+		`CREATE TABLE session_keys (shell_pid INTEGER NOT NULL, key_name TEXT NOT NULL,
+			key_hash TEXT NOT NULL, PRIMARY KEY (shell_pid, key_name))`,
+		`CREATE TABLE project_usage (project_path TEXT PRIMARY KEY, last_used_at TEXT NOT NULL)`,
+		`CREATE TABLE outbox (id INTEGER PRIMARY KEY AUTOINCREMENT, op TEXT NOT NULL, args TEXT NOT NULL, queued_at TEXT NOT NULL)`,
+		`CREATE TABLE db_sync_log (id INTEGER PRIMARY KEY AUTOINCREMENT, synced_at TEXT NOT NULL,
+			frame_no INTEGER NOT NULL, frames_synced INTEGER NOT NULL, error TEXT NOT NULL)`,
+		`INSERT INTO sessions VALUES (42, '/src/api', 1, '')`,
+		`INSERT INTO session_keys VALUES (42, 'A', 'h')`,
+		`INSERT INTO project_usage VALUES ('/src/api', '2026-01-02T03:04:05Z')`,
+		`INSERT INTO outbox (op, args, queued_at) VALUES ('project.rename', '{}', 'a'), ('project.tag', '{}', 'b')`,
+		`INSERT INTO db_sync_log (synced_at, frame_no, frames_synced, error) VALUES ('a', 7, 3, '')`,
+	)
+	_ = db.Close()
+}
+
+func sessionsTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db := openTestDB(t, "sessions.db")
+	if err := migrateSessions(db, lazyTestDB(t, "unused-state.db", migrateState)); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func checkMigrated(t *testing.T, legacyPath string, sessions *sql.DB, state *LazyDB) {
+	t.Helper()
+	if matches, _ := filepath.Glob(legacyPath + "*"); len(matches) != 0 {
+		t.Errorf("left behind: %v", matches)
+	}
+	stateDB, err := state.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for table, want := range map[string]int{"sessions": 1, "session_keys": 1} {
+		if got := countRows(t, sessions, table); got != want {
+			t.Errorf("sessions %s = %d rows, want %d", table, got, want)
+		}
+	}
+	for table, want := range map[string]int{"project_usage": 1, "outbox": 2, "db_sync_log": 1} {
+		if got := countRows(t, stateDB, table); got != want {
+			t.Errorf("state %s = %d rows, want %d", table, got, want)
+		}
+	}
+}
+
+// A copy that fails gives the file back under its old name, and the next
+// run finishes the move without copying anything twice.
+func TestMigrateLegacySessionsRetriesAfterAFailedCopy(t *testing.T) {
+	legacyPath := filepath.Join(t.TempDir(), "sessions.db")
+	writeLegacySessions(t, legacyPath)
+	sessions := sessionsTestDB(t)
+
+	broken := NewLazyDB(func() (*sql.DB, io.Closer, error) { return nil, nil, errors.New("disk full") })
+	if err := MigrateLegacySessions(legacyPath, "", sessions, broken); err == nil {
+		t.Fatal("migration succeeded without a state database")
+	}
+	if _, err := os.Stat(legacyPath); err != nil {
+		t.Fatalf("legacy file not restored: %v", err)
+	}
+	if matches, _ := filepath.Glob(legacyPath + ".migrating-*"); len(matches) != 0 {
+		t.Errorf("claim left behind: %v", matches)
+	}
+
+	state := lazyTestDB(t, "state.db", migrateState)
+	if err := MigrateLegacySessions(legacyPath, "", sessions, state); err != nil {
+		t.Fatal(err)
+	}
+	checkMigrated(t, legacyPath, sessions, state)
+}
+
+// A claim whose process died mid-migration is picked up by the next run.
+func TestMigrateLegacySessionsResumesAnAbandonedClaim(t *testing.T) {
+	legacyPath := filepath.Join(t.TempDir(), "sessions.db")
+	// No process has a pid above the kernel's limit of 2^22.
+	writeLegacySessions(t, legacyPath+".migrating-99999999")
+	sessions := sessionsTestDB(t)
+	state := lazyTestDB(t, "state.db", migrateState)
+
+	if err := MigrateLegacySessions(legacyPath, "", sessions, state); err != nil {
+		t.Fatal(err)
+	}
+	checkMigrated(t, legacyPath, sessions, state)
+}
+
+// A claim held by a running process is left to it.
+func TestMigrateLegacySessionsLeavesALiveClaim(t *testing.T) {
+	claimed := filepath.Join(t.TempDir(), "sessions.db") + ".migrating-1"
+	writeLegacySessions(t, claimed)
+	sessions := sessionsTestDB(t)
+
+	if err := MigrateLegacySessions(claimed[:len(claimed)-len(".migrating-1")], "", sessions, lazyTestDB(t, "state.db", migrateState)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(claimed); err != nil {
+		t.Errorf("live claim was taken: %v", err)
+	}
+	if got := countRows(t, sessions, "sessions"); got != 0 {
+		t.Errorf("sessions = %d rows, want 0", got)
+	}
+}
@@ -2,24 +2,30 @@ package sqlite
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"io"
-
-	_ "github.com/tursodatabase/go-libsql"
+	"sync"
 )
 
-type sessionsDB struct {
+type dbCloser struct {
 	db *sql.DB
 }
 
-func (s *sessionsDB) Close() error { return s.db.Close() }
+func (s *dbCloser) Close() error { return s.db.Close() }
 
-func OpenLocal(path string) (*sql.DB, error) {
-	db, err := sql.Open("libsql", fmt.Sprintf("file:%s", path))
+// OpenLocal opens a database file, decrypting it with key when key is
+// not empty.
+func OpenLocal(path, key string) (*sql.DB, error) {
+	db, err := openDB(fmt.Sprintf("file:%s", path), key)
 	if err != nil {
 		return nil, fmt.Errorf("open local db %s: %w", path, err)
 	}
 	db.SetMaxOpenConns(1)
+	if err := checkReadable(db, path); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
 	var mode string
 	if err := db.QueryRow("PRAGMA journal_mode=WAL").Scan(&mode); err != nil {
 		_ = db.Close()
@@ -27,17 +33,86 @@ func OpenLocal(path string) (*sql.DB, error) {
 	}
 	// libsql may not support this pragma; ignore error
 	_, _ = db.Exec("PRAGMA foreign_keys = ON")
+	restrictFiles(path)
 	return db, nil
 }
 
-func OpenSessionsDB(path string) (*sql.DB, io.Closer, error) {
-	db, err := OpenLocal(path)
+// OpenSessionsDB opens the runtime sessions database. Tables older
+// versions kept there that belong in state.db are moved into state.
+func OpenSessionsDB(path, key string, state *LazyDB) (*sql.DB, io.Closer, error) {
+	db, err := OpenLocal(path, key)
 	if err != nil {
 		return nil, nil, err
 	}
-	if err := migrateSessions(db); err != nil {
+	if err := migrateSessions(db, state); err != nil {
 		_ = db.Close()
 		return nil, nil, fmt.Errorf("migrate sessions: %w", err)
 	}
-	return db, &sessionsDB{db: db}, nil
+	return db, &dbCloser{db: db}, nil
+}
+
+func OpenStateDB(path, key string) (*sql.DB, io.Closer, error) {
+	db, err := OpenLocal(path, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := migrateState(db); err != nil {
+		_ = db.Close()
+		return nil, nil, fmt.Errorf("migrate state: %w", err)
+	}
+	return db, &dbCloser{db: db}, nil
+}
+
+// LazyDB opens a database the first time it is needed, so commands that
+// never use it, such as the shell hook on most prompts, do not pay for
+// opening and migrating it.
+type LazyDB struct {
+	open   func() (*sql.DB, io.Closer, error)
+	once   sync.Once
+	db     *sql.DB
+	closer io.Closer
+	err    error
+}
+
+func NewLazyDB(open func() (*sql.DB, io.Closer, error)) *LazyDB {
+	return &LazyDB{open: open}
+}
+
+// DB opens the database on first use and returns the same handle, or the
+// same error, afterwards.
+func (l *LazyDB) DB() (*sql.DB, error) {
+	l.once.Do(func() {
+		l.db, l.closer, l.err = l.open()
+	})
+	return l.db, l.err
+}
+
+// Close closes the database if it was opened; it cannot be opened after.
+func (l *LazyDB) Close() error {
+	l.once.Do(func() {
+		l.err = errors.New("database already closed")
+	})
+	if l.closer == nil {
+		return nil
+	}
+	return l.closer.Close()
+}
+
+// OpenReadOnly opens an existing database without taking write locks or
+// running migrations. It is used on the shell hook path, where the
+// projects database only needs to be consulted.
+func OpenReadOnly(path, key string) (*sql.DB, io.Closer, error) {
+	db, err := openDB(fmt.Sprintf("file:%s?mode=ro", path), key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("open read-only db %s: %w", path, err)
+	}
+	db.SetMaxOpenConns(1)
+	// The replica connector that just failed can still hold a lock for a
+	// moment; wait it out rather than report it as a wrong key.
+	_ = pragma(db, "PRAGMA busy_timeout = 5000")
+	if err := checkReadable(db, path); err != nil {
+		_ = db.Close()
+		return nil, nil, err
+	}
+	return db, &dbCloser{db: db}, nil
 }
@@ -0,0 +1,211 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ErrSchemaTooNew is returned when a database was migrated by a newer
+// autoenv than the one running.
+var ErrSchemaTooNew = errors.New("database schema is newer than this autoenv")
+
+// migration is one step of a schema's history. Versions start at 1 and
+// increase by one; up must tolerate databases created before versioning,
+// where the objects it creates may already exist.
+type migration struct {
+	version     int
+	description string
+	up          func(tx *sql.Tx) error
+	down        func(tx *sql.Tx) error
+}
+
+// versionTracker records which migrations a database has applied.
+type versionTracker interface {
+	current(db *sql.DB) (int, error)
+	record(tx *sql.Tx, m migration) error
+	forget(tx *sql.Tx, m migration) error
+}
+
+// userVersion tracks the schema in PRAGMA user_version, for local-only
+// databases.
+type userVersion struct{}
+
+func (userVersion) current(db *sql.DB) (int, error) {
+	var v int
+	err := db.QueryRow(`PRAGMA user_version`).Scan(&v)
+	return v, err
+}
+
+func (userVersion) record(tx *sql.Tx, m migration) error {
+	_, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, m.version))
+	return err
+}
+
+func (userVersion) forget(tx *sql.Tx, m migration) error {
+	_, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, m.version-1))
+	return err
+}
+
+// migrationTable tracks the schema in a schema_migrations table. The
+// Turso replica uses it because pragmas are not replicated, while the
+// table syncs along with the schema it describes.
+type migrationTable struct{}
+
+func (migrationTable) current(db *sql.DB) (int, error) {
+	var exists int
+	if err := db.QueryRow(
+		`SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'`,
+	).Scan(&exists); err != nil {
+		return 0, err
+	}
+	if exists == 0 {
+		return 0, nil
+	}
+	var v int
+	err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&v)
+	return v, err
+}
+
+func (migrationTable) record(tx *sql.Tx, m migration) error {
+	if _, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version     INTEGER PRIMARY KEY,
+			description TEXT NOT NULL,
+			applied_at  TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ', 'now'))
+		)
+	`); err != nil {
+		return err
+	}
+	_, err := tx.Exec(
+		`INSERT OR IGNORE INTO schema_migrations (version, description) VALUES (?, ?)`,
+		m.version, m.description,
+	)
+	return err
+}
+
+func (migrationTable) forget(tx *sql.Tx, m migration) error {
+	_, err := tx.Exec(`DELETE FROM schema_migrations WHERE version = ?`, m.version)
+	return err
+}
+
+// migrate brings db to the latest version in migrations. An up-to-date
+// database costs a single read.
+func migrate(db *sql.DB, tracker versionTracker, migrations []migration) error {
+	return migrateTo(db, tracker, migrations, migrations[len(migrations)-1].version)
+}
+
+// migrateTo applies or reverts migrations, each in its own transaction,
+// until db is at target.
+func migrateTo(db *sql.DB, tracker versionTracker, migrations []migration, target int) error {
+	cur, err := tracker.current(db)
+	if err != nil {
+		return fmt.Errorf("read schema version: %w", err)
+	}
+	latest := migrations[len(migrations)-1].version
+	if cur > latest {
+		return fmt.Errorf("%w (version %d, this autoenv supports up to %d); upgrade autoenv", ErrSchemaTooNew, cur, latest)
+	}
+
+	for _, m := range migrations {
+		if m.version <= cur || m.version > target {
+			continue
+		}
+		if err := inTx(db, func(tx *sql.Tx) error {
+			if err := m.up(tx); err != nil {
+				return err
+			}
+			return tracker.record(tx, m)
+		}); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.version, m.description, err)
+		}
+	}
+
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if m.version > cur || m.version <= target {
+			continue
+		}
+		if err := inTx(db, func(tx *sql.Tx) error {
+			if err := m.down(tx); err != nil {
+				return err
+			}
+			return tracker.forget(tx, m)
+		}); err != nil {
+			return fmt.Errorf("revert migration %d (%s): %w", m.version, m.description, err)
+		}
+	}
+	return nil
+}
+
+// schemaCurrent reports whether db has every migration applied, without
+// writing to it.
+func schemaCurrent(db *sql.DB, tracker versionTracker, migrations []migration) (bool, error) {
+	cur, err := tracker.current(db)
+	if err != nil {
+		return false, err
+	}
+	return cur >= migrations[len(migrations)-1].version, nil
+}
+
+func inTx(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// addColumn adds a column to an existing table unless it is already
+// there, since SQLite has no ADD COLUMN IF NOT EXISTS.
+func addColumn(tx *sql.Tx, table, column, definition string) error {
+	rows, err := tx.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rows.Close() }()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		vals := make([]any, len(cols))
+		var name string
+		for i := range vals {
+			vals[i] = new(any)
+		}
+		vals[1] = &name
+		if err := rows.Scan(vals...); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	_ = rows.Close()
+
+	_, err = tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+func dropColumn(tx *sql.Tx, table, column string) error {
+	_, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", table, column))
+	return err
+}
+
+func execAll(tx *sql.Tx, stmts ...string) error {
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
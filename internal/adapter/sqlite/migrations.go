@@ -1,46 +1,330 @@
 package sqlite
 
-import "database/sql"
+import (
+	"database/sql"
+	"fmt"
+)
 
-func migrateProjects(db *sql.DB) error {
-	if _, err := db.Exec(`
-		CREATE TABLE IF NOT EXISTS projects (
-			id         INTEGER PRIMARY KEY AUTOINCREMENT,
-			path       TEXT NOT NULL UNIQUE,
-			name       TEXT,
-			created_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ', 'now'))
-		)
-	`); err != nil {
-		return err
-	}
-	_, err := db.Exec(`
-		CREATE TABLE IF NOT EXISTS defaults (
-			key        TEXT PRIMARY KEY,
-			value      TEXT NOT NULL,
-			updated_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ', 'now'))
-		)
-	`)
-	return err
+// projectMigrations is the schema history of projects.db. Append new
+// steps; never edit one that has shipped.
+var projectMigrations = []migration{
+	{
+		version:     1,
+		description: "projects and defaults",
+		up: func(tx *sql.Tx) error {
+			return execAll(tx, `
+				CREATE TABLE IF NOT EXISTS projects (
+					id         INTEGER PRIMARY KEY AUTOINCREMENT,
+					path       TEXT NOT NULL UNIQUE,
+					name       TEXT,
+					created_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ', 'now'))
+				)`, `
+				CREATE TABLE IF NOT EXISTS defaults (
+					key        TEXT PRIMARY KEY,
+					value      TEXT NOT NULL,
+					updated_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ', 'now'))
+				)`,
+			)
+		},
+		down: func(tx *sql.Tx) error {
+			return execAll(tx, `DROP TABLE IF EXISTS defaults`, `DROP TABLE IF EXISTS projects`)
+		},
+	},
+	{
+		version:     2,
+		description: "project descriptions and tags",
+		up: func(tx *sql.Tx) error {
+			if err := addColumn(tx, "projects", "description", "TEXT NOT NULL DEFAULT ''"); err != nil {
+				return err
+			}
+			return execAll(tx, `
+				CREATE TABLE IF NOT EXISTS project_tags (
+					project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+					tag        TEXT NOT NULL,
+					PRIMARY KEY (project_id, tag)
+				)`,
+			)
+		},
+		down: func(tx *sql.Tx) error {
+			if err := execAll(tx, `DROP TABLE IF EXISTS project_tags`); err != nil {
+				return err
+			}
+			return dropColumn(tx, "projects", "description")
+		},
+	},
+	{
+		version:     3,
+		description: "remote URLs and per-device locations",
+		up: func(tx *sql.Tx) error {
+			if err := addColumn(tx, "projects", "remote_url", "TEXT NOT NULL DEFAULT ''"); err != nil {
+				return err
+			}
+			return execAll(tx, `
+				CREATE TABLE IF NOT EXISTS project_locations (
+					project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+					device_id  TEXT NOT NULL,
+					path       TEXT NOT NULL,
+					updated_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ', 'now')),
+					PRIMARY KEY (project_id, device_id)
+				)`,
+			)
+		},
+		down: func(tx *sql.Tx) error {
+			if err := execAll(tx, `DROP TABLE IF EXISTS project_locations`); err != nil {
+				return err
+			}
+			return dropColumn(tx, "projects", "remote_url")
+		},
+	},
+	{
+		version:     4,
+		description: "env fingerprints",
+		up: func(tx *sql.Tx) error {
+			return addColumn(tx, "project_locations", "env_fingerprint", "TEXT NOT NULL DEFAULT ''")
+		},
+		down: func(tx *sql.Tx) error {
+			return dropColumn(tx, "project_locations", "env_fingerprint")
+		},
+	},
+	{
+		version:     5,
+		description: "secret sync rules",
+		up: func(tx *sql.Tx) error {
+			return execAll(tx, `
+				CREATE TABLE IF NOT EXISTS project_sync_rules (
+					project_id   INTEGER PRIMARY KEY REFERENCES projects(id) ON DELETE CASCADE,
+					include      TEXT NOT NULL DEFAULT '',
+					exclude      TEXT NOT NULL DEFAULT '',
+					strip_prefix TEXT NOT NULL DEFAULT '',
+					add_prefix   TEXT NOT NULL DEFAULT ''
+				)`, `
+				CREATE TABLE IF NOT EXISTS project_sync_renames (
+					project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+					from_key   TEXT NOT NULL,
+					to_key     TEXT NOT NULL,
+					PRIMARY KEY (project_id, from_key)
+				)`,
+			)
+		},
+		down: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`DROP TABLE IF EXISTS project_sync_renames`,
+				`DROP TABLE IF EXISTS project_sync_rules`,
+			)
+		},
+	},
+	{
+		version:     6,
+		description: "named sync targets",
+		up: func(tx *sql.Tx) error {
+			return execAll(tx, `
+				CREATE TABLE IF NOT EXISTS project_sync_targets (
+					project_id  INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+					name        TEXT NOT NULL,
+					target      TEXT NOT NULL,
+					environment TEXT NOT NULL DEFAULT '',
+					kind        TEXT NOT NULL DEFAULT '',
+					visibility  TEXT NOT NULL DEFAULT '',
+					PRIMARY KEY (project_id, name)
+				)`,
+			)
+		},
+		down: func(tx *sql.Tx) error {
+			return execAll(tx, `DROP TABLE IF EXISTS project_sync_targets`)
+		},
+	},
+	{
+		version:     7,
+		description: "GitLab variable attributes on named sync targets",
+		up: func(tx *sql.Tx) error {
+			if err := addColumn(tx, "project_sync_targets", "protected", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+				return err
+			}
+			return addColumn(tx, "project_sync_targets", "masked", "INTEGER NOT NULL DEFAULT 0")
+		},
+		down: func(tx *sql.Tx) error {
+			if err := dropColumn(tx, "project_sync_targets", "masked"); err != nil {
+				return err
+			}
+			return dropColumn(tx, "project_sync_targets", "protected")
+		},
+	},
+	{
+		// The shell hook matches the current directory against locations
+		// on every prompt.
+		version:     8,
+		description: "index project locations by path",
+		up: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`CREATE INDEX IF NOT EXISTS project_locations_path ON project_locations (device_id, path)`,
+			)
+		},
+		down: func(tx *sql.Tx) error {
+			return execAll(tx, `DROP INDEX IF EXISTS project_locations_path`)
+		},
+	},
 }
 
-func migrateSessions(db *sql.DB) error {
-	if _, err := db.Exec(`
-		CREATE TABLE IF NOT EXISTS sessions (
-			shell_pid      INTEGER PRIMARY KEY,
-			project_path   TEXT NOT NULL,
-			env_file_mtime INTEGER NOT NULL,
-			loaded_at      TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ', 'now'))
-		)
-	`); err != nil {
-		return err
+// sessionMigrations is the schema history of sessions.db. state is
+// opened only if there are tables to move into it.
+func sessionMigrations(state *LazyDB) []migration {
+	return []migration{
+		{
+			version:     1,
+			description: "sessions",
+			up: func(tx *sql.Tx) error {
+				return execAll(tx, `
+					CREATE TABLE IF NOT EXISTS sessions (
+						shell_pid      INTEGER PRIMARY KEY,
+						project_path   TEXT NOT NULL,
+						env_file_mtime INTEGER NOT NULL,
+						loaded_at      TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ', 'now'))
+					)`, `
+					CREATE TABLE IF NOT EXISTS session_keys (
+						shell_pid  INTEGER NOT NULL REFERENCES sessions(shell_pid) ON DELETE CASCADE,
+						key_name   TEXT NOT NULL,
+						key_hash   TEXT NOT NULL,
+						PRIMARY KEY (shell_pid, key_name)
+					)`,
+				)
+			},
+			down: func(tx *sql.Tx) error {
+				return execAll(tx, `DROP TABLE IF EXISTS session_keys`, `DROP TABLE IF EXISTS sessions`)
+			},
+		},
+		{
+			// sessions.db moved to the runtime directory, which is cleared on
+			// reboot; data that must persist now lives in state.db. This also
+			// covers a runtime directory equal to the config directory, where
+			// there is no separate legacy file to migrate.
+			version:     2,
+			description: "move persistent tables to state.db",
+			up: func(tx *sql.Tx) error {
+				for _, t := range legacyTables {
+					if !t.state {
+						continue
+					}
+					ok, err := tableExists(tx, t.name)
+					if err != nil {
+						return err
+					}
+					if !ok {
+						continue
+					}
+					stateDB, err := state.DB()
+					if err != nil {
+						return err
+					}
+					if err := copyTable(tx, stateDB, t.name, t.columns); err != nil {
+						return fmt.Errorf("move %s: %w", t.name, err)
+					}
+					if err := execAll(tx, `DROP TABLE `+t.name); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			// The tables stay in state.db, where they belong.
+			down: func(*sql.Tx) error { return nil },
+		},
+		{
+			version:     3,
+			description: "sessions holding pulled values",
+			up: func(tx *sql.Tx) error {
+				return addColumn(tx, "sessions", "pulled", "INTEGER NOT NULL DEFAULT 0")
+			},
+			down: func(tx *sql.Tx) error {
+				return dropColumn(tx, "sessions", "pulled")
+			},
+		},
 	}
-	_, err := db.Exec(`
-		CREATE TABLE IF NOT EXISTS session_keys (
-			shell_pid  INTEGER NOT NULL REFERENCES sessions(shell_pid) ON DELETE CASCADE,
-			key_name   TEXT NOT NULL,
-			key_hash   TEXT NOT NULL,
-			PRIMARY KEY (shell_pid, key_name)
-		)
-	`)
-	return err
+}
+
+// stateMigrations is the schema history of state.db, the local data that
+// must survive a reboot.
+var stateMigrations = []migration{
+	{
+		version:     1,
+		description: "usage, outbox and sync log",
+		up: func(tx *sql.Tx) error {
+			return execAll(tx, `
+				CREATE TABLE IF NOT EXISTS project_usage (
+					project_path TEXT PRIMARY KEY,
+					last_used_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ', 'now'))
+				)`, `
+				CREATE TABLE IF NOT EXISTS outbox (
+					id        INTEGER PRIMARY KEY AUTOINCREMENT,
+					op        TEXT NOT NULL,
+					args      TEXT NOT NULL,
+					queued_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ', 'now'))
+				)`, `
+				CREATE TABLE IF NOT EXISTS db_sync_log (
+					id            INTEGER PRIMARY KEY AUTOINCREMENT,
+					synced_at     TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ', 'now')),
+					frame_no      INTEGER NOT NULL DEFAULT 0,
+					frames_synced INTEGER NOT NULL DEFAULT 0,
+					error         TEXT NOT NULL DEFAULT ''
+				)`,
+			)
+		},
+		down: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`DROP TABLE IF EXISTS db_sync_log`,
+				`DROP TABLE IF EXISTS outbox`,
+				`DROP TABLE IF EXISTS project_usage`,
+			)
+		},
+	},
+	{
+		version:     2,
+		description: "per-project sync ledger",
+		up: func(tx *sql.Tx) error {
+			return execAll(tx, `
+				CREATE TABLE IF NOT EXISTS sync_state (
+					project_path TEXT NOT NULL,
+					target       TEXT NOT NULL,
+					key_name     TEXT NOT NULL,
+					value_hash   TEXT NOT NULL,
+					pushed_at    TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ', 'now')),
+					PRIMARY KEY (project_path, target, key_name)
+				)`,
+			)
+		},
+		down: func(tx *sql.Tx) error {
+			return execAll(tx, `DROP TABLE IF EXISTS sync_state`)
+		},
+	},
+	{
+		version:     3,
+		description: "one-off tasks done on this machine",
+		up: func(tx *sql.Tx) error {
+			return execAll(tx, `
+				CREATE TABLE IF NOT EXISTS done_tasks (
+					name    TEXT PRIMARY KEY,
+					done_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ', 'now'))
+				)`,
+			)
+		},
+		down: func(tx *sql.Tx) error {
+			return execAll(tx, `DROP TABLE IF EXISTS done_tasks`)
+		},
+	},
+}
+
+func migrateProjects(db *sql.DB) error {
+	return migrate(db, migrationTable{}, projectMigrations)
+}
+
+func migrateSessions(db *sql.DB, state *LazyDB) error {
+	return migrate(db, userVersion{}, sessionMigrations(state))
+}
+
+func migrateState(db *sql.DB) error {
+	return migrate(db, userVersion{}, stateMigrations)
+}
+
+// ProjectsSchemaCurrent reports whether a projects database opened with
+// OpenReadOnly has been migrated to the schema this binary expects.
+func ProjectsSchemaCurrent(db *sql.DB) (bool, error) {
+	return schemaCurrent(db, migrationTable{}, projectMigrations)
 }
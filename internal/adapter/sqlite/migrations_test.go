@@ -0,0 +1,250 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func openTestDB(t *testing.T, name string) *sql.DB {
+	t.Helper()
+	db, err := OpenLocal(filepath.Join(t.TempDir(), name), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+func lazyTestDB(t *testing.T, name string, migrate func(*sql.DB) error) *LazyDB {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	l := NewLazyDB(func() (*sql.DB, io.Closer, error) {
+		db, err := OpenLocal(path, "")
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := migrate(db); err != nil {
+			return nil, nil, err
+		}
+		return db, &dbCloser{db: db}, nil
+	})
+	t.Cleanup(func() { _ = l.Close() })
+	return l
+}
+
+func execTest(t *testing.T, db *sql.DB, stmts ...string) {
+	t.Helper()
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+}
+
+func countRows(t *testing.T, db *sql.DB, table string) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(`SELECT count(*) FROM ` + table).Scan(&n); err != nil {
+		t.Fatalf("count %s: %v", table, err)
+	}
+	return n
+}
+
+// A sessions.db at version 1 that still holds persistent tables, with no
+// separate legacy file to migrate, must hand them to state.db instead of
+// dropping them.
+func TestSessionsV2MovesPersistentTables(t *testing.T) {
+	sessions := openTestDB(t, "sessions.db")
+	execTest(t, sessions, `
+		CREATE TABLE sessions (
+			shell_pid INTEGER PRIMARY KEY, project_path TEXT NOT NULL,
+			env_file_mtime INTEGER NOT NULL, loaded_at TEXT NOT NULL DEFAULT ''
+		)`, `
+		CREATE TABLE session_keys (
+			shell_pid INTEGER NOT NULL, key_name TEXT NOT NULL, key_hash TEXT NOT NULL,
+			PRIMARY KEY (shell_pid, key_name)
+		)`,
+		`CREATE TABLE project_usage (project_path TEXT PRIMARY KEY, last_used_at TEXT NOT NULL)`,
+		`CREATE TABLE outbox (id INTEGER PRIMARY KEY AUTOINCREMENT, op TEXT NOT NULL, args TEXT NOT NULL, queued_at TEXT NOT NULL)`,
+		`CREATE TABLE db_sync_log (id INTEGER PRIMARY KEY AUTOINCREMENT, synced_at TEXT NOT NULL,
+			frame_no INTEGER NOT NULL, frames_synced INTEGER NOT NULL, error TEXT NOT NULL)`,
+		`INSERT INTO sessions VALUES (42, '/src/api', 1, '')`,
+		`INSERT INTO project_usage VALUES ('/src/api', '2026-01-02T03:04:05Z')`,
+		`INSERT INTO outbox (op, args, queued_at) VALUES ('project.rename', '{}', 'a'), ('project.tag', '{}', 'b')`,
+		`INSERT INTO db_sync_log (synced_at, frame_no, frames_synced, error) VALUES ('a', 7, 3, '')`,
+	)
+	if err := pragma(sessions, `PRAGMA user_version = 1`); err != nil {
+		t.Fatal(err)
+	}
+
+	state := lazyTestDB(t, "state.db", migrateState)
+	if err := migrateSessions(sessions, state); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, table := range []string{"project_usage", "outbox", "db_sync_log"} {
+		if ok, err := tableExists(sessions, table); err != nil || ok {
+			t.Errorf("%s still in sessions.db (err %v)", table, err)
+		}
+	}
+	if got := countRows(t, sessions, "sessions"); got != 1 {
+		t.Errorf("sessions = %d rows, want 1", got)
+	}
+	stateDB, err := state.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for table, want := range map[string]int{"project_usage": 1, "outbox": 2, "db_sync_log": 1} {
+		if got := countRows(t, stateDB, table); got != want {
+			t.Errorf("state %s = %d rows, want %d", table, got, want)
+		}
+	}
+}
+
+// A new sessions.db has nothing to move, so state.db stays closed.
+func TestSessionsMigrationLeavesStateClosed(t *testing.T) {
+	sessions := openTestDB(t, "sessions.db")
+	opened := false
+	state := NewLazyDB(func() (*sql.DB, io.Closer, error) {
+		opened = true
+		return nil, nil, io.EOF
+	})
+	if err := migrateSessions(sessions, state); err != nil {
+		t.Fatal(err)
+	}
+	if opened {
+		t.Error("state.db opened for a fresh sessions.db")
+	}
+}
+
+// schemaOf describes every table and index in db, leaving out the
+// migration bookkeeping, so schemas can be compared step by step.
+func schemaOf(t *testing.T, db *sql.DB) []string {
+	t.Helper()
+	rows, err := db.Query(`SELECT type, name, tbl_name FROM sqlite_master
+		WHERE name NOT LIKE 'sqlite_%' AND name != 'schema_migrations' ORDER BY type, name`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type object struct{ kind, name, table string }
+	var objects []object
+	for rows.Next() {
+		var o object
+		if err := rows.Scan(&o.kind, &o.name, &o.table); err != nil {
+			t.Fatal(err)
+		}
+		objects = append(objects, o)
+	}
+	_ = rows.Close()
+
+	var schema []string
+	for _, o := range objects {
+		if o.kind != "table" {
+			schema = append(schema, fmt.Sprintf("%s %s on %s", o.kind, o.name, o.table))
+			continue
+		}
+		cols, err := db.Query(fmt.Sprintf(`SELECT name, type, "notnull", pk FROM pragma_table_info('%s')`, o.name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for cols.Next() {
+			var name, typ string
+			var notNull, pk int
+			if err := cols.Scan(&name, &typ, &notNull, &pk); err != nil {
+				t.Fatal(err)
+			}
+			schema = append(schema, fmt.Sprintf("%s.%s %s notnull=%d pk=%d", o.name, name, typ, notNull, pk))
+		}
+		_ = cols.Close()
+	}
+	return schema
+}
+
+type schemaHistory struct {
+	name       string
+	tracker    versionTracker
+	migrations func(t *testing.T) []migration
+}
+
+var schemaHistories = []schemaHistory{
+	{"projects", migrationTable{}, func(*testing.T) []migration { return projectMigrations }},
+	{"sessions", userVersion{}, func(t *testing.T) []migration {
+		return sessionMigrations(lazyTestDB(t, "state.db", migrateState))
+	}},
+	{"state", userVersion{}, func(*testing.T) []migration { return stateMigrations }},
+}
+
+// Every migration must apply one step at a time and revert to exactly the
+// schema of the version before it, down to an empty database and back.
+func TestMigrationsRoundTrip(t *testing.T) {
+	for _, h := range schemaHistories {
+		t.Run(h.name, func(t *testing.T) {
+			db := openTestDB(t, h.name+".db")
+			migrations := h.migrations(t)
+
+			step := func(target int) {
+				t.Helper()
+				if err := migrateTo(db, h.tracker, migrations, target); err != nil {
+					t.Fatalf("migrate to %d: %v", target, err)
+				}
+				if v, err := h.tracker.current(db); err != nil || v != target {
+					t.Fatalf("version = %d (err %v), want %d", v, err, target)
+				}
+			}
+
+			schemas := map[int][]string{0: schemaOf(t, db)}
+			for _, m := range migrations {
+				step(m.version)
+				schemas[m.version] = schemaOf(t, db)
+			}
+			for i := len(migrations) - 1; i >= 0; i-- {
+				v := migrations[i].version - 1
+				step(v)
+				if got, want := schemaOf(t, db), schemas[v]; !slices.Equal(got, want) {
+					t.Errorf("after reverting %d:\n got %q\nwant %q", migrations[i].version, got, want)
+				}
+			}
+			if err := migrate(db, h.tracker, migrations); err != nil {
+				t.Fatalf("migrate again: %v", err)
+			}
+			latest := migrations[len(migrations)-1].version
+			if got, want := schemaOf(t, db), schemas[latest]; !slices.Equal(got, want) {
+				t.Errorf("after migrating again:\n got %q\nwant %q", got, want)
+			}
+		})
+	}
+}
+
+func TestMigrateRejectsNewerSchema(t *testing.T) {
+	for _, h := range schemaHistories {
+		t.Run(h.name, func(t *testing.T) {
+			db := openTestDB(t, h.name+".db")
+			migrations := h.migrations(t)
+			if err := migrate(db, h.tracker, migrations); err != nil {
+				t.Fatal(err)
+			}
+			newer := migration{
+				version:     migrations[len(migrations)-1].version + 1,
+				description: "from a newer autoenv",
+				up:          func(*sql.Tx) error { return nil },
+				down:        func(*sql.Tx) error { return nil },
+			}
+			if err := migrate(db, h.tracker, append(slices.Clone(migrations), newer)); err != nil {
+				t.Fatal(err)
+			}
+
+			err := migrate(db, h.tracker, migrations)
+			if !errors.Is(err, ErrSchemaTooNew) {
+				t.Fatalf("migrate = %v, want ErrSchemaTooNew", err)
+			}
+			if current, err := schemaCurrent(db, h.tracker, migrations); err != nil || !current {
+				t.Errorf("schemaCurrent = %v, %v; want true", current, err)
+			}
+		})
+	}
+}
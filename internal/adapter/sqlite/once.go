@@ -0,0 +1,21 @@
+package sqlite
+
+import "database/sql"
+
+// RunOnce runs fn unless an earlier call with the same name succeeded on
+// this machine. The record is kept in state.db rather than the synced
+// registry, so every device runs the task once for itself.
+func RunOnce(state *sql.DB, name string, fn func() error) error {
+	var done int
+	if err := state.QueryRow(`SELECT count(*) FROM done_tasks WHERE name = ?`, name).Scan(&done); err != nil {
+		return err
+	}
+	if done > 0 {
+		return nil
+	}
+	if err := fn(); err != nil {
+		return err
+	}
+	_, err := state.Exec(`INSERT OR IGNORE INTO done_tasks (name) VALUES (?)`, name)
+	return err
+}
@@ -0,0 +1,231 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	"github.com/stormingluke/autoenv/internal/domain"
+	"github.com/stormingluke/autoenv/internal/port"
+)
+
+var (
+	_ port.ProjectRepository = (*QueuedProjectRepo)(nil)
+	_ port.ConfigStore       = (*QueuedDefaultsRepo)(nil)
+)
+
+// Outbox holds registry writes made while Turso was unreachable. It lives
+// in a local database and is replayed by FlushOutbox once the replica is
+// writable again.
+type Outbox struct {
+	db *sql.DB
+}
+
+func NewOutbox(db *sql.DB) *Outbox {
+	return &Outbox{db: db}
+}
+
+func (o *Outbox) Enqueue(op string, args any) error {
+	data, err := json.Marshal(args)
+	if err != nil {
+		return err
+	}
+	_, err = o.db.Exec(`INSERT INTO outbox (op, args) VALUES (?, ?)`, op, string(data))
+	return err
+}
+
+func (o *Outbox) Pending() (int, error) {
+	var n int
+	err := o.db.QueryRow(`SELECT count(*) FROM outbox`).Scan(&n)
+	return n, err
+}
+
+type outboxEntry struct {
+	id   int
+	op   string
+	args []byte
+}
+
+const (
+	opUpsert         = "project.upsert"
+	opRename         = "project.rename"
+	opRelocate       = "project.relocate"
+	opFingerprint    = "project.fingerprint"
+	opRemoveLocation = "project.remove_location"
+	opDescribe       = "project.describe"
+	opAddTags        = "project.add_tags"
+	opRemoveTags     = "project.remove_tags"
+	opSyncRules      = "project.sync_rules"
+	opSaveTarget     = "project.save_target"
+	opRemoveTarget   = "project.remove_target"
+	opDelete         = "project.delete"
+	opSetDefault     = "defaults.set"
+)
+
+type outboxArgs struct {
+	ID     int                     `json:"id,omitempty"`
+	Path   string                  `json:"path,omitempty"`
+	Name   string                  `json:"name,omitempty"`
+	Value  string                  `json:"value,omitempty"`
+	Tags   []string                `json:"tags,omitempty"`
+	Rules  *domain.SyncRules       `json:"rules,omitempty"`
+	Target *domain.NamedSyncTarget `json:"target,omitempty"`
+}
+
+// FlushOutbox replays queued writes in order against the writable
+// registry, removing each one once applied. It stops at the first
+// failure so later writes are never applied ahead of earlier ones.
+func FlushOutbox(o *Outbox, projects port.ProjectWriter, defaults port.ConfigStore) (int, error) {
+	rows, err := o.db.Query(`SELECT id, op, args FROM outbox ORDER BY id`)
+	if err != nil {
+		return 0, err
+	}
+	var entries []outboxEntry
+	for rows.Next() {
+		var e outboxEntry
+		if err := rows.Scan(&e.id, &e.op, &e.args); err != nil {
+			_ = rows.Close()
+			return 0, err
+		}
+		entries = append(entries, e)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for i, e := range entries {
+		if err := replay(e, projects, defaults); err != nil {
+			return i, fmt.Errorf("replay queued %s: %w", e.op, err)
+		}
+		if _, err := o.db.Exec(`DELETE FROM outbox WHERE id = ?`, e.id); err != nil {
+			return i, err
+		}
+	}
+	return len(entries), nil
+}
+
+func replay(e outboxEntry, projects port.ProjectWriter, defaults port.ConfigStore) error {
+	var a outboxArgs
+	if err := json.Unmarshal(e.args, &a); err != nil {
+		return err
+	}
+	switch e.op {
+	case opUpsert:
+		return projects.Upsert(a.Path, a.Name, a.Value)
+	case opRename:
+		return projects.Rename(a.ID, a.Name)
+	case opRelocate:
+		return projects.Relocate(a.ID, a.Path)
+	case opFingerprint:
+		return projects.SetFingerprint(a.ID, a.Value)
+	case opRemoveLocation:
+		return projects.RemoveLocation(a.ID)
+	case opDescribe:
+		return projects.SetDescription(a.ID, a.Value)
+	case opAddTags:
+		return projects.AddTags(a.ID, a.Tags)
+	case opRemoveTags:
+		return projects.RemoveTags(a.ID, a.Tags)
+	case opSyncRules:
+		if a.Rules == nil {
+			return projects.SetSyncRules(a.ID, domain.SyncRules{})
+		}
+		return projects.SetSyncRules(a.ID, *a.Rules)
+	case opSaveTarget:
+		if a.Target == nil {
+			return fmt.Errorf("missing target")
+		}
+		return projects.SaveSyncTarget(a.ID, *a.Target)
+	case opRemoveTarget:
+		return projects.RemoveSyncTarget(a.ID, a.Name)
+	case opDelete:
+		return projects.Delete(a.ID)
+	case opSetDefault:
+		return defaults.Set(a.Name, a.Value)
+	default:
+		return fmt.Errorf("unknown operation")
+	}
+}
+
+// QueuedProjectRepo reads from a read-only replica and queues writes in
+// the outbox.
+type QueuedProjectRepo struct {
+	*ProjectRepo
+	outbox *Outbox
+}
+
+func NewQueuedProjectRepo(repo *ProjectRepo, outbox *Outbox) *QueuedProjectRepo {
+	return &QueuedProjectRepo{ProjectRepo: repo, outbox: outbox}
+}
+
+func (r *QueuedProjectRepo) Upsert(path, name, remoteURL string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("resolve path: %w", err)
+	}
+	return r.outbox.Enqueue(opUpsert, outboxArgs{Path: abs, Name: name, Value: remoteURL})
+}
+
+func (r *QueuedProjectRepo) Rename(id int, name string) error {
+	return r.outbox.Enqueue(opRename, outboxArgs{ID: id, Name: name})
+}
+
+func (r *QueuedProjectRepo) Relocate(id int, path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("resolve path: %w", err)
+	}
+	return r.outbox.Enqueue(opRelocate, outboxArgs{ID: id, Path: abs})
+}
+
+func (r *QueuedProjectRepo) SetFingerprint(id int, fingerprint string) error {
+	return r.outbox.Enqueue(opFingerprint, outboxArgs{ID: id, Value: fingerprint})
+}
+
+func (r *QueuedProjectRepo) RemoveLocation(id int) error {
+	return r.outbox.Enqueue(opRemoveLocation, outboxArgs{ID: id})
+}
+
+func (r *QueuedProjectRepo) SetDescription(id int, description string) error {
+	return r.outbox.Enqueue(opDescribe, outboxArgs{ID: id, Value: description})
+}
+
+func (r *QueuedProjectRepo) AddTags(id int, tags []string) error {
+	return r.outbox.Enqueue(opAddTags, outboxArgs{ID: id, Tags: tags})
+}
+
+func (r *QueuedProjectRepo) RemoveTags(id int, tags []string) error {
+	return r.outbox.Enqueue(opRemoveTags, outboxArgs{ID: id, Tags: tags})
+}
+
+func (r *QueuedProjectRepo) SetSyncRules(id int, rules domain.SyncRules) error {
+	return r.outbox.Enqueue(opSyncRules, outboxArgs{ID: id, Rules: &rules})
+}
+
+func (r *QueuedProjectRepo) SaveSyncTarget(id int, t domain.NamedSyncTarget) error {
+	return r.outbox.Enqueue(opSaveTarget, outboxArgs{ID: id, Target: &t})
+}
+
+func (r *QueuedProjectRepo) RemoveSyncTarget(id int, name string) error {
+	return r.outbox.Enqueue(opRemoveTarget, outboxArgs{ID: id, Name: name})
+}
+
+func (r *QueuedProjectRepo) Delete(id int) error {
+	return r.outbox.Enqueue(opDelete, outboxArgs{ID: id})
+}
+
+// QueuedDefaultsRepo is the ConfigStore counterpart of QueuedProjectRepo.
+type QueuedDefaultsRepo struct {
+	*DefaultsRepo
+	outbox *Outbox
+}
+
+func NewQueuedDefaultsRepo(repo *DefaultsRepo, outbox *Outbox) *QueuedDefaultsRepo {
+	return &QueuedDefaultsRepo{DefaultsRepo: repo, outbox: outbox}
+}
+
+func (r *QueuedDefaultsRepo) Set(key, value string) error {
+	return r.outbox.Enqueue(opSetDefault, outboxArgs{Name: key, Value: value})
+}
@@ -0,0 +1,94 @@
+package sqlite
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/stormingluke/autoenv/internal/port"
+)
+
+// recordingWriter logs the writes replayed into it and fails the ones
+// listed in fail. Writes the test does not queue are left unimplemented.
+type recordingWriter struct {
+	port.ProjectWriter
+	port.ConfigStore
+	calls []string
+	fail  map[string]bool
+}
+
+func (w *recordingWriter) call(name string) error {
+	w.calls = append(w.calls, name)
+	if w.fail[name] {
+		return errors.New("registry unavailable")
+	}
+	return nil
+}
+
+func (w *recordingWriter) Rename(id int, name string) error {
+	return w.call(fmt.Sprintf("rename %d %s", id, name))
+}
+
+func (w *recordingWriter) AddTags(id int, tags []string) error {
+	return w.call(fmt.Sprintf("tag %d %v", id, tags))
+}
+
+func (w *recordingWriter) Delete(id int) error {
+	return w.call(fmt.Sprintf("delete %d", id))
+}
+
+func (w *recordingWriter) Set(key, value string) error {
+	return w.call(fmt.Sprintf("set %s=%s", key, value))
+}
+
+func TestFlushOutboxReplaysInOrderAndStopsAtFirstFailure(t *testing.T) {
+	state := openTestDB(t, "state.db")
+	if err := migrateState(state); err != nil {
+		t.Fatal(err)
+	}
+	outbox := NewOutbox(state)
+	projects := NewQueuedProjectRepo(nil, outbox)
+	defaults := NewQueuedDefaultsRepo(nil, outbox)
+
+	for _, queue := range []func() error{
+		func() error { return projects.Rename(1, "api") },
+		func() error { return defaults.Set("github.default_owner", "me") },
+		func() error { return projects.AddTags(1, []string{"go"}) },
+		func() error { return projects.Delete(2) },
+		func() error { return projects.Rename(3, "web") },
+	} {
+		if err := queue(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := &recordingWriter{fail: map[string]bool{"delete 2": true}}
+	n, err := FlushOutbox(outbox, w, w)
+	if err == nil {
+		t.Fatal("FlushOutbox succeeded past a failing write")
+	}
+	if n != 3 {
+		t.Errorf("applied = %d, want 3", n)
+	}
+	want := []string{"rename 1 api", "set github.default_owner=me", "tag 1 [go]", "delete 2"}
+	if !slices.Equal(w.calls, want) {
+		t.Errorf("replayed %q, want %q", w.calls, want)
+	}
+	if pending, _ := outbox.Pending(); pending != 2 {
+		t.Errorf("pending = %d, want the failed write and the one after it", pending)
+	}
+
+	w = &recordingWriter{}
+	n, err = FlushOutbox(outbox, w, w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"delete 2", "rename 3 web"}
+	if n != 2 || !slices.Equal(w.calls, want) {
+		t.Errorf("second flush applied %d: %q, want %q", n, w.calls, want)
+	}
+	if pending, _ := outbox.Pending(); pending != 0 {
+		t.Errorf("pending = %d after a full flush", pending)
+	}
+}
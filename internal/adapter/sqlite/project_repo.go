@@ -2,8 +2,12 @@ package sqlite
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/stormingluke/autoenv/internal/domain"
 	"github.com/stormingluke/autoenv/internal/port"
@@ -14,101 +18,595 @@ var (
 	_ port.ProjectWriter = (*ProjectRepo)(nil)
 )
 
+// ProjectRepo stores projects under a machine-independent path (see
+// domain.PathRoots) and keeps a per-device table of where each project
+// is checked out, so the same synced registry works on every machine.
 type ProjectRepo struct {
-	db *sql.DB
+	db       *sql.DB
+	deviceID string
+	roots    domain.PathRoots
 }
 
-func NewProjectRepo(db *sql.DB) *ProjectRepo {
-	return &ProjectRepo{db: db}
+func NewProjectRepo(db *sql.DB, deviceID string, roots domain.PathRoots) *ProjectRepo {
+	return &ProjectRepo{db: db, deviceID: deviceID, roots: roots}
 }
 
-func (r *ProjectRepo) Upsert(path, name string) error {
+// selectProjects runs a projects query with this device's location
+// joined in; tail holds the WHERE/ORDER BY clauses.
+const selectProjects = `SELECT p.id, p.path, p.name, p.description, p.remote_url, p.created_at,
+	COALESCE((SELECT group_concat(t.tag, ',') FROM project_tags t WHERE t.project_id = p.id), ''),
+	COALESCE(l.path, ''), COALESCE(l.env_fingerprint, ''),
+	(SELECT count(*) FROM project_locations o WHERE o.project_id = p.id AND o.device_id != ?)
+	FROM projects p
+	LEFT JOIN project_locations l ON l.project_id = p.id AND l.device_id = ? `
+
+// resolveFunc decides where a project lives on this machine from its
+// portable path and the location recorded for this device.
+type resolveFunc func(portable, recorded string) (string, domain.ProjectStatus)
+
+func scanProject(rows *sql.Rows, resolve resolveFunc) (*domain.Project, error) {
+	p := &domain.Project{}
+	var tags, local string
+	if err := rows.Scan(
+		&p.ID, &p.PortablePath, &p.Name, &p.Description, &p.RemoteURL, &p.CreatedAt,
+		&tags, &local, &p.Fingerprint, &p.OtherDevices,
+	); err != nil {
+		return nil, err
+	}
+	if tags != "" {
+		p.Tags = strings.Split(tags, ",")
+		sort.Strings(p.Tags)
+	}
+	p.Path, p.Status = resolve(p.PortablePath, local)
+	return p, nil
+}
+
+// localPath prefers the location recorded for this device, then the
+// portable path resolved against this machine's roots if it exists here.
+// A recorded location that has disappeared is reported as missing.
+func (r *ProjectRepo) localPath(portable, recorded string) (string, domain.ProjectStatus) {
+	if recorded != "" {
+		if _, err := os.Stat(recorded); err != nil {
+			return recorded, domain.StatusMissing
+		}
+		return recorded, domain.StatusOK
+	}
+	resolved := r.roots.Resolve(portable)
+	if resolved == "" {
+		return "", domain.StatusNotCheckedOut
+	}
+	if _, err := os.Stat(resolved); err != nil {
+		return "", domain.StatusNotCheckedOut
+	}
+	return resolved, domain.StatusOK
+}
+
+func (r *ProjectRepo) Upsert(path, name, remoteURL string) error {
 	abs, err := filepath.Abs(path)
 	if err != nil {
 		return fmt.Errorf("resolve path: %w", err)
 	}
-	_, err = r.db.Exec(
-		`INSERT INTO projects (path, name) VALUES (?, ?)
-		 ON CONFLICT(path) DO UPDATE SET name = excluded.name`,
-		abs, name,
+
+	// A project is never left registered without its location here.
+	return inTx(r.db, func(tx *sql.Tx) error {
+		id, err := r.findID(tx, abs, remoteURL)
+		if err != nil {
+			return err
+		}
+
+		if id == 0 {
+			err = tx.QueryRow(
+				`INSERT INTO projects (path, name, remote_url) VALUES (?, ?, ?) RETURNING id`,
+				r.roots.Portable(abs), name, remoteURL,
+			).Scan(&id)
+		} else {
+			_, err = tx.Exec(
+				`UPDATE projects SET
+				   name = COALESCE(NULLIF(?, ''), name),
+				   remote_url = COALESCE(NULLIF(?, ''), remote_url)
+				 WHERE id = ?`,
+				name, remoteURL, id,
+			)
+		}
+		if err != nil {
+			return err
+		}
+
+		return r.setLocation(tx, id, abs)
+	})
+}
+
+// execer is a database or a transaction that can also write.
+type execer interface {
+	querier
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// findID looks up the project an absolute path belongs to: by this
+// device's recorded location, then by portable (or legacy absolute) path,
+// then by git remote for projects not yet located on this device.
+func (r *ProjectRepo) findID(q querier, abs, remoteURL string) (int, error) {
+	var id int
+	err := q.QueryRow(
+		`SELECT project_id FROM project_locations WHERE device_id = ? AND path = ?`,
+		r.deviceID, abs,
+	).Scan(&id)
+	if err != sql.ErrNoRows {
+		return id, err
+	}
+
+	portable := r.roots.Portable(abs)
+	err = q.QueryRow(
+		`SELECT id FROM projects WHERE path IN (?, ?) ORDER BY path = ? DESC LIMIT 1`,
+		portable, abs, portable,
+	).Scan(&id)
+	if err != sql.ErrNoRows {
+		return id, err
+	}
+
+	if remoteURL == "" {
+		return 0, nil
+	}
+	rows, err := q.Query(
+		`SELECT p.id FROM projects p
+		 WHERE p.remote_url = ? AND NOT EXISTS (
+		   SELECT 1 FROM project_locations l WHERE l.project_id = p.id AND l.device_id = ?
+		 )`,
+		remoteURL, r.deviceID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var ids []int
+	for rows.Next() {
+		if err := rows.Scan(&id); err != nil {
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	// Several checkouts of one remote (e.g. monorepo subdirectories) are
+	// ambiguous; register a new project rather than guess.
+	if len(ids) != 1 {
+		return 0, nil
+	}
+	return ids[0], nil
+}
+
+func (r *ProjectRepo) setLocation(q execer, id int, abs string) error {
+	_, err := q.Exec(
+		`INSERT INTO project_locations (project_id, device_id, path) VALUES (?, ?, ?)
+		 ON CONFLICT(project_id, device_id) DO UPDATE SET
+		   path = excluded.path,
+		   updated_at = strftime('%Y-%m-%dT%H:%M:%SZ', 'now')`,
+		id, r.deviceID, abs,
 	)
 	return err
 }
 
-func (r *ProjectRepo) FindByPath(path string) (*domain.Project, error) {
+// Normalize converts entries stored with an absolute path by older
+// versions into portable paths, recording the absolute path as this
+// device's location when it exists here. Entries whose portable path is
+// already taken by another project are left alone and reported.
+func (r *ProjectRepo) Normalize() error {
+	rows, err := r.db.Query(`SELECT id, path FROM projects`)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rows.Close() }()
+
+	type legacy struct {
+		id   int
+		path string
+	}
+	var pending []legacy
+	for rows.Next() {
+		var l legacy
+		if err := rows.Scan(&l.id, &l.path); err != nil {
+			return err
+		}
+		if filepath.IsAbs(l.path) && r.roots.Portable(l.path) != l.path {
+			pending = append(pending, l)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	_ = rows.Close()
+
+	var conflicts []error
+	for _, l := range pending {
+		if _, err := os.Stat(l.path); err != nil {
+			continue
+		}
+		if err := r.setPath(l.id, r.roots.Portable(l.path)); errors.Is(err, domain.ErrPathTaken) {
+			conflicts = append(conflicts, fmt.Errorf("%s: %w", l.path, err))
+			continue
+		} else if err != nil {
+			return err
+		}
+		if err := r.setLocation(r.db, l.id, l.path); err != nil {
+			return err
+		}
+	}
+	return errors.Join(conflicts...)
+}
+
+// Relocate moves the project to path on this device and updates the
+// portable path to match.
+func (r *ProjectRepo) Relocate(id int, path string) error {
 	abs, err := filepath.Abs(path)
 	if err != nil {
-		return nil, fmt.Errorf("resolve path: %w", err)
+		return fmt.Errorf("resolve path: %w", err)
 	}
-	row := r.db.QueryRow(
-		`SELECT id, path, name, created_at FROM projects WHERE path = ?`, abs,
+	if err := r.setPath(id, r.roots.Portable(abs)); err != nil {
+		return err
+	}
+	return r.setLocation(r.db, id, abs)
+}
+
+// setPath changes a project's portable path, refusing to take over the
+// path of another registered project.
+func (r *ProjectRepo) setPath(id int, portable string) error {
+	var other int
+	err := r.db.QueryRow(`SELECT id FROM projects WHERE path = ? AND id != ?`, portable, id).Scan(&other)
+	switch {
+	case err == nil:
+		return fmt.Errorf("%w: %s (project %d)", domain.ErrPathTaken, portable, other)
+	case err != sql.ErrNoRows:
+		return err
+	}
+	_, err = r.db.Exec(`UPDATE projects SET path = ? WHERE id = ?`, portable, id)
+	return err
+}
+
+func (r *ProjectRepo) SetFingerprint(id int, fingerprint string) error {
+	_, err := r.db.Exec(
+		`UPDATE project_locations SET env_fingerprint = ? WHERE project_id = ? AND device_id = ?`,
+		fingerprint, id, r.deviceID,
 	)
-	p := &domain.Project{}
-	if err := row.Scan(&p.ID, &p.Path, &p.Name, &p.CreatedAt); err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil
+	return err
+}
+
+// RemoveLocation forgets where the project lives on this machine while
+// keeping it in the registry for other machines.
+func (r *ProjectRepo) RemoveLocation(id int) error {
+	_, err := r.db.Exec(
+		`DELETE FROM project_locations WHERE project_id = ? AND device_id = ?`,
+		id, r.deviceID,
+	)
+	return err
+}
+
+func (r *ProjectRepo) Rename(id int, name string) error {
+	_, err := r.db.Exec(`UPDATE projects SET name = ? WHERE id = ?`, name, id)
+	return err
+}
+
+func (r *ProjectRepo) SetDescription(id int, description string) error {
+	_, err := r.db.Exec(`UPDATE projects SET description = ? WHERE id = ?`, description, id)
+	return err
+}
+
+func (r *ProjectRepo) AddTags(id int, tags []string) error {
+	for _, tag := range tags {
+		if _, err := r.db.Exec(
+			`INSERT OR IGNORE INTO project_tags (project_id, tag) VALUES (?, ?)`, id, tag,
+		); err != nil {
+			return err
 		}
-		return nil, err
 	}
-	return p, nil
+	return nil
 }
 
-func (r *ProjectRepo) ListAll() ([]domain.Project, error) {
+func (r *ProjectRepo) RemoveTags(id int, tags []string) error {
+	for _, tag := range tags {
+		if _, err := r.db.Exec(
+			`DELETE FROM project_tags WHERE project_id = ? AND tag = ?`, id, tag,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *ProjectRepo) SyncRules(id int) (domain.SyncRules, error) {
+	var rules domain.SyncRules
+	var include, exclude string
+	err := r.db.QueryRow(
+		`SELECT include, exclude, strip_prefix, add_prefix FROM project_sync_rules WHERE project_id = ?`, id,
+	).Scan(&include, &exclude, &rules.StripPrefix, &rules.AddPrefix)
+	if err != nil && err != sql.ErrNoRows {
+		return rules, err
+	}
+	rules.Include = splitList(include)
+	rules.Exclude = splitList(exclude)
+
+	rows, err := r.db.Query(`SELECT from_key, to_key FROM project_sync_renames WHERE project_id = ?`, id)
+	if err != nil {
+		return rules, err
+	}
+	defer func() { _ = rows.Close() }()
+	for rows.Next() {
+		var from, to string
+		if err := rows.Scan(&from, &to); err != nil {
+			return rules, err
+		}
+		if rules.Rename == nil {
+			rules.Rename = make(map[string]string)
+		}
+		rules.Rename[from] = to
+	}
+	return rules, rows.Err()
+}
+
+// SetSyncRules replaces a project's sync rules; zero rules remove them.
+func (r *ProjectRepo) SetSyncRules(id int, rules domain.SyncRules) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, q := range []string{
+		`DELETE FROM project_sync_rules WHERE project_id = ?`,
+		`DELETE FROM project_sync_renames WHERE project_id = ?`,
+	} {
+		if _, err := tx.Exec(q, id); err != nil {
+			return err
+		}
+	}
+	if rules.IsZero() {
+		return tx.Commit()
+	}
+	if _, err := tx.Exec(
+		`INSERT INTO project_sync_rules (project_id, include, exclude, strip_prefix, add_prefix)
+		 VALUES (?, ?, ?, ?, ?)`,
+		id, strings.Join(rules.Include, ","), strings.Join(rules.Exclude, ","), rules.StripPrefix, rules.AddPrefix,
+	); err != nil {
+		return err
+	}
+	for from, to := range rules.Rename {
+		if _, err := tx.Exec(
+			`INSERT INTO project_sync_renames (project_id, from_key, to_key) VALUES (?, ?, ?)`, id, from, to,
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *ProjectRepo) SyncTargets(id int) ([]domain.NamedSyncTarget, error) {
 	rows, err := r.db.Query(
-		`SELECT id, path, name, created_at FROM projects ORDER BY name, path`,
+		`SELECT name, target, environment, kind, visibility, protected, masked FROM project_sync_targets
+		 WHERE project_id = ? ORDER BY name`, id,
 	)
 	if err != nil {
 		return nil, err
 	}
 	defer func() { _ = rows.Close() }()
 
-	var projects []domain.Project
+	var targets []domain.NamedSyncTarget
 	for rows.Next() {
-		var p domain.Project
-		if err := rows.Scan(&p.ID, &p.Path, &p.Name, &p.CreatedAt); err != nil {
+		var t domain.NamedSyncTarget
+		if err := rows.Scan(&t.Name, &t.Target, &t.Environment, &t.Kind, &t.Visibility, &t.Protected, &t.Masked); err != nil {
 			return nil, err
 		}
-		projects = append(projects, p)
+		targets = append(targets, t)
 	}
-	return projects, rows.Err()
+	return targets, rows.Err()
+}
+
+// SaveSyncTarget adds a named target, replacing one of the same name.
+func (r *ProjectRepo) SaveSyncTarget(id int, t domain.NamedSyncTarget) error {
+	_, err := r.db.Exec(
+		`INSERT INTO project_sync_targets (project_id, name, target, environment, kind, visibility, protected, masked)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT(project_id, name) DO UPDATE SET
+		   target = excluded.target, environment = excluded.environment,
+		   kind = excluded.kind, visibility = excluded.visibility,
+		   protected = excluded.protected, masked = excluded.masked`,
+		id, t.Name, t.Target, t.Environment, string(t.Kind), string(t.Visibility), t.Protected, t.Masked,
+	)
+	return err
+}
+
+func (r *ProjectRepo) RemoveSyncTarget(id int, name string) error {
+	_, err := r.db.Exec(`DELETE FROM project_sync_targets WHERE project_id = ? AND name = ?`, id, name)
+	return err
+}
+
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
 }
 
-func (r *ProjectRepo) Delete(path string) error {
+// FindByPath finds the project at path on this device: by its recorded
+// location, then by portable path for projects not located here. Like
+// MatchCurrent it looks the path up rather than scanning the registry.
+func (r *ProjectRepo) FindByPath(path string) (*domain.Project, error) {
 	abs, err := filepath.Abs(path)
 	if err != nil {
-		return fmt.Errorf("resolve path: %w", err)
+		return nil, fmt.Errorf("resolve path: %w", err)
 	}
-	_, err = r.db.Exec(`DELETE FROM projects WHERE path = ?`, abs)
-	return err
+	id, _, err := r.matchLocation([]string{abs})
+	if err == nil && id == 0 {
+		id, _, err = r.matchPortable([]string{abs})
+	}
+	if err != nil || id == 0 {
+		return nil, err
+	}
+	p, err := r.FindByID(id)
+	// A portable path only resolves to a checkout that exists.
+	if err != nil || p == nil || p.Path != abs {
+		return nil, err
+	}
+	return p, nil
 }
 
+func (r *ProjectRepo) FindByID(id int) (*domain.Project, error) {
+	projects, err := r.query(`WHERE p.id = ?`, id)
+	if err != nil || len(projects) == 0 {
+		return nil, err
+	}
+	return &projects[0], nil
+}
+
+func (r *ProjectRepo) FindByName(name string) (*domain.Project, error) {
+	projects, err := r.query(`WHERE p.name = ?`, name)
+	if err != nil || len(projects) == 0 {
+		return nil, err
+	}
+	return &projects[0], nil
+}
+
+func (r *ProjectRepo) ListAll() ([]domain.Project, error) {
+	return r.query(`ORDER BY p.name, p.path`)
+}
+
+func (r *ProjectRepo) Delete(id int) error {
+	// Foreign keys may be disabled on the replica, so cascade by hand, all
+	// or nothing.
+	return inTx(r.db, func(tx *sql.Tx) error {
+		for _, q := range []string{
+			`DELETE FROM project_tags WHERE project_id = ?`,
+			`DELETE FROM project_locations WHERE project_id = ?`,
+			`DELETE FROM project_sync_rules WHERE project_id = ?`,
+			`DELETE FROM project_sync_renames WHERE project_id = ?`,
+			`DELETE FROM project_sync_targets WHERE project_id = ?`,
+			`DELETE FROM projects WHERE id = ?`,
+		} {
+			if _, err := tx.Exec(q, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// MatchCurrent finds the project containing dir, the most deeply nested
+// one when projects are nested. It looks dir and its ancestors up by path
+// instead of scanning the registry, and never stats: a project that
+// contains the current directory necessarily exists.
 func (r *ProjectRepo) MatchCurrent(dir string) (*domain.Project, error) {
 	abs, err := filepath.Abs(dir)
 	if err != nil {
 		return nil, fmt.Errorf("resolve path: %w", err)
 	}
+	ancestors := domain.Ancestors(abs)
+
+	id, path, err := r.matchLocation(ancestors)
+	if err != nil {
+		return nil, err
+	}
+	// A portable path only counts for projects not located on this device,
+	// and only if it is nested deeper than the located match.
+	if pid, ppath, err := r.matchPortable(ancestors); err != nil {
+		return nil, err
+	} else if len(ppath) > len(path) {
+		id, path = pid, ppath
+	}
+	if id == 0 {
+		return nil, nil
+	}
+
+	found := func(string, string) (string, domain.ProjectStatus) { return path, domain.StatusOK }
+	projects, err := r.queryWith(found, `WHERE p.id = ?`, id)
+	if err != nil || len(projects) == 0 {
+		return nil, err
+	}
+	return &projects[0], nil
+}
+
+// matchLocation returns the project recorded on this device at the
+// longest of paths.
+func (r *ProjectRepo) matchLocation(paths []string) (int, string, error) {
+	args := []any{r.deviceID}
+	for _, p := range paths {
+		args = append(args, p)
+	}
+	var id int
+	var path string
+	err := r.db.QueryRow(
+		`SELECT project_id, path FROM project_locations
+		 WHERE device_id = ? AND path IN (`+placeholders(len(paths))+`)
+		 ORDER BY length(path) DESC LIMIT 1`,
+		args...,
+	).Scan(&id, &path)
+	if err == sql.ErrNoRows {
+		return 0, "", nil
+	}
+	return id, path, err
+}
 
+// matchPortable returns the project without a location on this device
+// whose stored path resolves to the longest of paths.
+func (r *ProjectRepo) matchPortable(paths []string) (int, string, error) {
+	at := make(map[string]string)
+	var args []any
+	for _, p := range paths {
+		for _, form := range r.roots.Forms(p) {
+			if _, ok := at[form]; !ok {
+				at[form] = p
+				args = append(args, form)
+			}
+		}
+	}
 	rows, err := r.db.Query(
-		`SELECT id, path, name, created_at FROM projects ORDER BY length(path) DESC`,
+		`SELECT p.id, p.path FROM projects p
+		 WHERE p.path IN (`+placeholders(len(args))+`) AND NOT EXISTS (
+		   SELECT 1 FROM project_locations l WHERE l.project_id = p.id AND l.device_id = ?
+		 )`,
+		append(args, r.deviceID)...,
 	)
 	if err != nil {
-		return nil, err
+		return 0, "", err
 	}
 	defer func() { _ = rows.Close() }()
 
+	var bestID int
+	var best string
 	for rows.Next() {
-		var p domain.Project
-		if err := rows.Scan(&p.ID, &p.Path, &p.Name, &p.CreatedAt); err != nil {
-			return nil, err
+		var id int
+		var stored string
+		if err := rows.Scan(&id, &stored); err != nil {
+			return 0, "", err
 		}
-		rel, err := filepath.Rel(p.Path, abs)
-		if err != nil {
-			continue
+		if path := at[stored]; len(path) > len(best) && r.roots.Resolve(stored) == path {
+			bestID, best = id, path
 		}
-		if len(rel) >= 2 && rel[:2] == ".." {
-			continue
+	}
+	return bestID, best, rows.Err()
+}
+
+func placeholders(n int) string {
+	return "?" + strings.Repeat(", ?", n-1)
+}
+
+func (r *ProjectRepo) query(tail string, args ...any) ([]domain.Project, error) {
+	return r.queryWith(r.localPath, tail, args...)
+}
+
+func (r *ProjectRepo) queryWith(resolve resolveFunc, tail string, args ...any) ([]domain.Project, error) {
+	rows, err := r.db.Query(selectProjects+tail, append([]any{r.deviceID, r.deviceID}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var projects []domain.Project
+	for rows.Next() {
+		p, err := scanProject(rows, resolve)
+		if err != nil {
+			return nil, err
 		}
-		return &p, nil
+		projects = append(projects, *p)
 	}
-	return nil, rows.Err()
+	return projects, rows.Err()
 }
@@ -19,11 +19,11 @@ func NewSessionRepo(db *sql.DB) *SessionRepo {
 
 func (r *SessionRepo) Get(shellPID int) (*domain.Session, error) {
 	row := r.db.QueryRow(
-		`SELECT shell_pid, project_path, env_file_mtime, loaded_at FROM sessions WHERE shell_pid = ?`,
+		`SELECT shell_pid, project_path, env_file_mtime, pulled, loaded_at FROM sessions WHERE shell_pid = ?`,
 		shellPID,
 	)
 	s := &domain.Session{}
-	if err := row.Scan(&s.ShellPID, &s.ProjectPath, &s.EnvFileMtime, &s.LoadedAt); err != nil {
+	if err := row.Scan(&s.ShellPID, &s.ProjectPath, &s.EnvFileMtime, &s.Pulled, &s.LoadedAt); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
@@ -32,15 +32,16 @@ func (r *SessionRepo) Get(shellPID int) (*domain.Session, error) {
 	return s, nil
 }
 
-func (r *SessionRepo) Upsert(shellPID int, projectPath string, envFileMtime int64) error {
+func (r *SessionRepo) Upsert(shellPID int, projectPath string, envFileMtime int64, pulled bool) error {
 	_, err := r.db.Exec(
-		`INSERT INTO sessions (shell_pid, project_path, env_file_mtime)
-		 VALUES (?, ?, ?)
+		`INSERT INTO sessions (shell_pid, project_path, env_file_mtime, pulled)
+		 VALUES (?, ?, ?, ?)
 		 ON CONFLICT(shell_pid) DO UPDATE SET
 		   project_path = excluded.project_path,
 		   env_file_mtime = excluded.env_file_mtime,
+		   pulled = excluded.pulled,
 		   loaded_at = strftime('%Y-%m-%dT%H:%M:%SZ', 'now')`,
-		shellPID, projectPath, envFileMtime,
+		shellPID, projectPath, envFileMtime, pulled,
 	)
 	return err
 }
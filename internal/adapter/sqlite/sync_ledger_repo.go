@@ -0,0 +1,105 @@
+package sqlite
+
+import (
+	"database/sql"
+
+	"github.com/stormingluke/autoenv/internal/domain"
+	"github.com/stormingluke/autoenv/internal/port"
+)
+
+var _ port.SyncLedger = (*SyncLedgerRepo)(nil)
+
+type SyncLedgerRepo struct {
+	db *sql.DB
+}
+
+func NewSyncLedgerRepo(db *sql.DB) *SyncLedgerRepo {
+	return &SyncLedgerRepo{db: db}
+}
+
+func (r *SyncLedgerRepo) Targets(project string) ([]string, error) {
+	rows, err := r.db.Query(
+		`SELECT DISTINCT target FROM sync_state WHERE project_path = ? ORDER BY target`,
+		project,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var targets []string
+	for rows.Next() {
+		var target string
+		if err := rows.Scan(&target); err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+	return targets, rows.Err()
+}
+
+func (r *SyncLedgerRepo) Entries(project, target string) (map[string]domain.SyncLedgerEntry, error) {
+	rows, err := r.db.Query(
+		`SELECT key_name, value_hash, pushed_at FROM sync_state
+		 WHERE project_path = ? AND target = ?`,
+		project, target,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	entries := make(map[string]domain.SyncLedgerEntry)
+	for rows.Next() {
+		var e domain.SyncLedgerEntry
+		if err := rows.Scan(&e.Key, &e.Hash, &e.PushedAt); err != nil {
+			return nil, err
+		}
+		entries[e.Key] = e
+	}
+	return entries, rows.Err()
+}
+
+func (r *SyncLedgerRepo) Record(project, target string, hashes map[string]string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	stmt, err := tx.Prepare(
+		`INSERT INTO sync_state (project_path, target, key_name, value_hash) VALUES (?, ?, ?, ?)
+		 ON CONFLICT(project_path, target, key_name) DO UPDATE SET
+		   value_hash = excluded.value_hash,
+		   pushed_at = strftime('%Y-%m-%dT%H:%M:%SZ', 'now')`,
+	)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = stmt.Close() }()
+
+	for key, hash := range hashes {
+		if _, err := stmt.Exec(project, target, key, hash); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *SyncLedgerRepo) Forget(project, target string, keys []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, key := range keys {
+		if _, err := tx.Exec(
+			`DELETE FROM sync_state WHERE project_path = ? AND target = ? AND key_name = ?`,
+			project, target, key,
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,65 @@
+package sqlite
+
+import (
+	"database/sql"
+
+	"github.com/stormingluke/autoenv/internal/domain"
+	"github.com/stormingluke/autoenv/internal/port"
+)
+
+var _ port.SyncLog = (*SyncLogRepo)(nil)
+
+// syncLogKeep bounds the history so the table does not grow forever.
+const syncLogKeep = 100
+
+type SyncLogRepo struct {
+	db *sql.DB
+}
+
+func NewSyncLogRepo(db *sql.DB) *SyncLogRepo {
+	return &SyncLogRepo{db: db}
+}
+
+func (r *SyncLogRepo) Record(rec domain.DBSyncRecord) error {
+	if _, err := r.db.Exec(
+		`INSERT INTO db_sync_log (frame_no, frames_synced, error) VALUES (?, ?, ?)`,
+		rec.FrameNo, rec.FramesSynced, rec.Error,
+	); err != nil {
+		return err
+	}
+	_, err := r.db.Exec(
+		`DELETE FROM db_sync_log WHERE id NOT IN (SELECT id FROM db_sync_log ORDER BY id DESC LIMIT ?)`,
+		syncLogKeep,
+	)
+	return err
+}
+
+func (r *SyncLogRepo) Recent(limit int) ([]domain.DBSyncRecord, error) {
+	return r.query(`ORDER BY id DESC LIMIT ?`, limit)
+}
+
+func (r *SyncLogRepo) LastSuccess() (*domain.DBSyncRecord, error) {
+	records, err := r.query(`WHERE error = '' ORDER BY id DESC LIMIT 1`)
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+	return &records[0], nil
+}
+
+func (r *SyncLogRepo) query(tail string, args ...any) ([]domain.DBSyncRecord, error) {
+	rows, err := r.db.Query(`SELECT synced_at, frame_no, frames_synced, error FROM db_sync_log `+tail, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var records []domain.DBSyncRecord
+	for rows.Next() {
+		var rec domain.DBSyncRecord
+		if err := rows.Scan(&rec.At, &rec.FrameNo, &rec.FramesSynced, &rec.Error); err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+	return records, rows.Err()
+}
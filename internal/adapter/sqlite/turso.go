@@ -2,29 +2,65 @@ package sqlite
 
 import (
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
 
-	"github.com/tursodatabase/go-libsql"
+	"github.com/stormingluke/autoenv/internal/domain"
+	"github.com/stormingluke/autoenv/internal/port"
 )
 
+var _ port.DatabaseSyncer = (*TursoDB)(nil)
+
+// replicaConnector is an embedded replica connection that can pull from
+// Turso. Only the libsql driver provides one.
+type replicaConnector interface {
+	driver.Connector
+	Sync() (domain.Replication, error)
+	Close() error
+}
+
+// errNoReplication is returned by openReplicaConnector in builds whose
+// driver cannot replicate.
+var errNoReplication = errors.New("Turso sync needs a CGO build")
+
 type TursoDB struct {
 	DB        *sql.DB
-	connector *libsql.Connector
+	connector replicaConnector
+	// Offline is set when Turso was unreachable and DB is the local
+	// replica opened read-only; OfflineErr holds the connection error.
+	Offline    bool
+	OfflineErr error
+	closer     io.Closer
 }
 
-func OpenTurso(dbPath, tursoURL, authToken string) (*TursoDB, error) {
+// OpenTurso opens the project registry, as an embedded replica when Turso
+// credentials are set. A non-empty key encrypts the local file.
+func OpenTurso(dbPath, tursoURL, authToken, key string) (*TursoDB, error) {
 	if tursoURL == "" || authToken == "" {
-		return openTursoLocal(dbPath)
+		return openTursoLocal(dbPath, key)
 	}
 
-	connector, err := openReplicaConnector(dbPath, tursoURL, authToken)
+	connector, err := openReplicaConnector(dbPath, tursoURL, authToken, key)
 	if err != nil && strings.Contains(err.Error(), "metadata file does not") {
 		// DB was created locally without Turso — remove stale files and retry
 		removeStaleDB(dbPath)
-		connector, err = openReplicaConnector(dbPath, tursoURL, authToken)
+		connector, err = openReplicaConnector(dbPath, tursoURL, authToken, key)
+	}
+	if errors.Is(err, errNoReplication) {
+		// Falling back to the replica would queue every write in an outbox
+		// this build can never flush.
+		return nil, fmt.Errorf("%w: build autoenv with CGO_ENABLED=1, or unset AUTOENV_TURSO_DATABASE_URL to use %s as a local database",
+			err, dbPath)
+	}
+	if err != nil && isNetworkError(err) {
+		if t, ferr := openOfflineReplica(dbPath, key, err); ferr == nil {
+			return t, nil
+		}
 	}
 	if err != nil {
 		return nil, fmt.Errorf("turso connector at %s: %w", filepath.Dir(dbPath), err)
@@ -38,17 +74,56 @@ func OpenTurso(dbPath, tursoURL, authToken string) (*TursoDB, error) {
 		_ = connector.Close()
 		return nil, fmt.Errorf("migrate projects: %w", err)
 	}
+	restrictFiles(dbPath)
 
 	return &TursoDB{DB: db, connector: connector}, nil
 }
 
-func openReplicaConnector(dbPath, tursoURL, authToken string) (*libsql.Connector, error) {
-	return libsql.NewEmbeddedReplicaConnector(
-		dbPath,
-		tursoURL,
-		libsql.WithAuthToken(authToken),
-		libsql.WithSyncInterval(0),
-	)
+// openOfflineReplica opens the last synced replica read-only so commands
+// keep working without network access.
+func openOfflineReplica(dbPath, key string, cause error) (*TursoDB, error) {
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil, err
+	}
+	db, closer, err := OpenReadOnly(dbPath, key)
+	if err != nil {
+		return nil, err
+	}
+	current, err := ProjectsSchemaCurrent(db)
+	if err != nil || !current {
+		_ = closer.Close()
+		return nil, fmt.Errorf("local replica schema is out of date")
+	}
+	// libsql errors repeat the whole connection chain; the last cause is
+	// the part worth showing.
+	msg := cause.Error()
+	if i := strings.LastIndex(msg, ": "); i >= 0 {
+		msg = msg[i+2:]
+	}
+	return &TursoDB{DB: db, Offline: true, OfflineErr: errors.New(msg), closer: closer}, nil
+}
+
+// networkErrors are fragments of the errors libsql reports when the
+// remote cannot be reached, as opposed to auth or replica errors.
+var networkErrors = []string{
+	"error trying to connect",
+	"tcp connect error",
+	"dns error",
+	"connection refused",
+	"connection reset",
+	"timed out",
+	"network is unreachable",
+	"no route to host",
+}
+
+func isNetworkError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, fragment := range networkErrors {
+		if strings.Contains(msg, fragment) {
+			return true
+		}
+	}
+	return false
 }
 
 func removeStaleDB(dbPath string) {
@@ -57,8 +132,25 @@ func removeStaleDB(dbPath string) {
 	}
 }
 
-func openTursoLocal(path string) (*TursoDB, error) {
-	db, err := OpenLocal(path)
+// IsReplica reports whether dbPath is an embedded Turso replica rather
+// than a plain local database.
+func IsReplica(dbPath string) bool {
+	_, err := os.Stat(dbPath + "-info")
+	return err == nil
+}
+
+// ResetReplica deletes a replica's local files so the next OpenTurso
+// downloads it again, for example under a new encryption key. Only use it
+// while online: anything not yet synced is lost.
+func ResetReplica(dbPath string) {
+	removeStaleDB(dbPath)
+	for _, suffix := range []string{"-info", "-client_wal_index"} {
+		_ = os.Remove(dbPath + suffix)
+	}
+}
+
+func openTursoLocal(path, key string) (*TursoDB, error) {
+	db, err := OpenLocal(path, key)
 	if err != nil {
 		return nil, err
 	}
@@ -69,15 +161,26 @@ func openTursoLocal(path string) (*TursoDB, error) {
 	return &TursoDB{DB: db}, nil
 }
 
-func (t *TursoDB) Sync() error {
+func (t *TursoDB) Sync() (domain.Replication, error) {
+	if t.Offline {
+		return domain.Replication{}, fmt.Errorf("turso unreachable: %w", t.OfflineErr)
+	}
 	if t.connector == nil {
-		return fmt.Errorf("turso cloud sync not configured (set AUTOENV_TURSO_DATABASE_URL and AUTOENV_TURSO_AUTH_TOKEN)")
+		return domain.Replication{}, fmt.Errorf("%w (set AUTOENV_TURSO_DATABASE_URL and AUTOENV_TURSO_AUTH_TOKEN)", domain.ErrSyncDisabled)
 	}
-	_, err := t.connector.Sync()
-	return err
+	return t.connector.Sync()
+}
+
+// Replicated reports whether the registry is a live Turso replica, as
+// opposed to a local-only or offline database.
+func (t *TursoDB) Replicated() bool {
+	return t.connector != nil
 }
 
 func (t *TursoDB) Close() error {
+	if t.closer != nil {
+		return t.closer.Close()
+	}
 	_ = t.DB.Close()
 	if t.connector != nil {
 		_ = t.connector.Close()
@@ -0,0 +1,95 @@
+//go:build cgo
+
+package sqlite
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// refusingURL returns the address of a port nothing listens on, a Turso
+// stand-in that refuses every connection.
+func refusingURL(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	_ = l.Close()
+	return "http://" + addr
+}
+
+func TestOpenTursoOfflineWhenRefused(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "projects.db")
+	local, err := openTursoLocal(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := local.DB.Exec(`INSERT INTO projects (path, name) VALUES ('~/api', 'api')`); err != nil {
+		t.Fatal(err)
+	}
+	_ = local.Close()
+
+	tdb, err := OpenTurso(path, refusingURL(t), "token", "")
+	if err != nil {
+		t.Fatalf("OpenTurso: %v", err)
+	}
+	defer func() { _ = tdb.Close() }()
+
+	if !tdb.Offline || tdb.Replicated() {
+		t.Fatalf("Offline = %v, Replicated = %v; want an offline replica", tdb.Offline, tdb.Replicated())
+	}
+	if !strings.Contains(strings.ToLower(tdb.OfflineErr.Error()), "refused") {
+		t.Errorf("OfflineErr = %v, want the refused connection", tdb.OfflineErr)
+	}
+	var name string
+	if err := tdb.DB.QueryRow(`SELECT name FROM projects`).Scan(&name); err != nil || name != "api" {
+		t.Errorf("read replica: %q, %v", name, err)
+	}
+	if _, err := tdb.DB.Exec(`INSERT INTO projects (path, name) VALUES ('~/web', 'web')`); err == nil {
+		t.Error("offline replica accepted a write")
+	}
+	if _, err := tdb.Sync(); err == nil {
+		t.Error("Sync succeeded while offline")
+	}
+}
+
+// Without a local replica to fall back on, a refused connection is an
+// error rather than an empty registry.
+func TestOpenTursoRefusedWithoutReplica(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "projects.db")
+	if tdb, err := OpenTurso(path, refusingURL(t), "token", ""); err == nil {
+		_ = tdb.Close()
+		t.Fatal("OpenTurso succeeded with no replica and no network")
+	}
+}
+
+// Turso answering with an error is not a network failure, so it must not
+// fall back to the offline replica.
+func TestOpenTursoRejectedIsNotOffline(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "projects.db")
+	local, err := openTursoLocal(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = local.Close()
+
+	tdb, err := OpenTurso(path, srv.URL, "token", "")
+	if err == nil {
+		_ = tdb.Close()
+		t.Fatal("OpenTurso succeeded against a server rejecting the token")
+	}
+	if !strings.Contains(err.Error(), "Unauthorized") {
+		t.Errorf("err = %v, want the server's answer", err)
+	}
+}
@@ -0,0 +1,22 @@
+//go:build !cgo
+
+package sqlite
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// Without CGO there is no replication, so Turso credentials must be an
+// error instead of a registry that queues writes it can never send.
+func TestOpenTursoNeedsCGO(t *testing.T) {
+	tdb, err := OpenTurso(filepath.Join(t.TempDir(), "projects.db"), "libsql://db.example.turso.io", "token", "")
+	if err == nil {
+		_ = tdb.Close()
+		t.Fatal("OpenTurso succeeded without replication support")
+	}
+	if !errors.Is(err, errNoReplication) {
+		t.Errorf("err = %v, want errNoReplication", err)
+	}
+}
@@ -0,0 +1,25 @@
+package sqlite
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestIsNetworkError(t *testing.T) {
+	tests := []struct {
+		msg  string
+		want bool
+	}{
+		{"sync error: error trying to connect: tcp connect error: Connection refused (os error 111)", true},
+		{"error trying to connect: dns error: failed to lookup address information", true},
+		{"operation timed out", true},
+		{"Network is unreachable (os error 101)", true},
+		{"sync error: Unauthorized", false},
+		{"replica metadata file does not exist", false},
+	}
+	for _, tt := range tests {
+		if got := isNetworkError(errors.New(tt.msg)); got != tt.want {
+			t.Errorf("isNetworkError(%q) = %v, want %v", tt.msg, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package sqlite
+
+import (
+	"github.com/stormingluke/autoenv/internal/port"
+)
+
+var _ port.UsageRepository = (*UsageRepo)(nil)
+
+// UsageRepo opens state.db only when usage is read or recorded.
+type UsageRepo struct {
+	db *LazyDB
+}
+
+func NewUsageRepo(db *LazyDB) *UsageRepo {
+	return &UsageRepo{db: db}
+}
+
+func (r *UsageRepo) Touch(projectPath string) error {
+	db, err := r.db.DB()
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(
+		`INSERT INTO project_usage (project_path) VALUES (?)
+		 ON CONFLICT(project_path) DO UPDATE SET
+		   last_used_at = strftime('%Y-%m-%dT%H:%M:%SZ', 'now')`,
+		projectPath,
+	)
+	return err
+}
+
+func (r *UsageRepo) LastUsed() (map[string]string, error) {
+	db, err := r.db.DB()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(`SELECT project_path, last_used_at FROM project_usage`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	used := make(map[string]string)
+	for rows.Next() {
+		var path, at string
+		if err := rows.Scan(&path, &at); err != nil {
+			return nil, err
+		}
+		used[path] = at
+	}
+	return used, rows.Err()
+}
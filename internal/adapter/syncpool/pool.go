@@ -0,0 +1,52 @@
+package syncpool
+
+import (
+	"context"
+	"sync"
+
+	"github.com/stormingluke/autoenv/internal/domain"
+)
+
+// Run calls fn for each key on at most workers goroutines and reports
+// every key's outcome in the order given. Keys not yet started when ctx
+// is cancelled are skipped, and the run returns ctx's error.
+func Run(ctx context.Context, workers int, keys []string, fn func(context.Context, string) error) ([]domain.KeyResult, error) {
+	results := make([]domain.KeyResult, len(keys))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range min(workers, len(keys)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i] = domain.KeyResult{Key: keys[i], Outcome: domain.KeyOK}
+				if ctx.Err() != nil {
+					results[i].Outcome = domain.KeySkipped
+				} else if err := fn(ctx, keys[i]); err != nil {
+					if ctx.Err() != nil {
+						// Cut off mid-request: it may or may not have landed.
+						err = ctx.Err()
+					}
+					results[i].Outcome, results[i].Err = domain.KeyFailed, err
+				}
+			}
+		}()
+	}
+
+	i := 0
+feed:
+	for ; i < len(keys); i++ {
+		select {
+		case <-ctx.Done():
+			break feed
+		case next <- i:
+		}
+	}
+	close(next)
+	wg.Wait()
+
+	for ; i < len(keys); i++ {
+		results[i] = domain.KeyResult{Key: keys[i], Outcome: domain.KeySkipped}
+	}
+	return results, ctx.Err()
+}
@@ -0,0 +1,115 @@
+package syncpool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stormingluke/autoenv/internal/domain"
+)
+
+func keys(n int) []string {
+	ks := make([]string, n)
+	for i := range ks {
+		ks[i] = fmt.Sprintf("KEY_%02d", i)
+	}
+	return ks
+}
+
+func TestRunBoundsConcurrency(t *testing.T) {
+	var running, peak atomic.Int32
+	results, err := Run(context.Background(), 3, keys(20), func(context.Context, string) error {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(2 * time.Millisecond)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := peak.Load(); p > 3 || p < 2 {
+		t.Errorf("peak concurrency = %d, want at most 3 and more than 1", p)
+	}
+	for i, r := range results {
+		if r.Key != keys(20)[i] || r.Outcome != domain.KeyOK {
+			t.Errorf("result %d = %+v", i, r)
+		}
+	}
+}
+
+// One key failing is reported against that key and does not stop the
+// others.
+func TestRunReportsErrorsPerKey(t *testing.T) {
+	boom := errors.New("boom")
+	results, err := Run(context.Background(), 2, []string{"A", "B", "C"}, func(_ context.Context, key string) error {
+		if key == "B" {
+			return boom
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []domain.KeyOutcome{domain.KeyOK, domain.KeyFailed, domain.KeyOK}
+	for i, r := range results {
+		if r.Outcome != want[i] {
+			t.Errorf("%s: %v, want %v", r.Key, r.Outcome, want[i])
+		}
+	}
+	if !errors.Is(results[1].Err, boom) {
+		t.Errorf("B: err = %v, want boom", results[1].Err)
+	}
+}
+
+// Cancelling skips the keys not started yet, fails the ones cut off
+// mid-request with the context's error, and returns it.
+func TestRunStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	results, err := Run(ctx, 2, keys(10), func(ctx context.Context, key string) error {
+		if key == "KEY_00" {
+			cancel()
+		}
+		<-ctx.Done()
+		return errors.New("request aborted")
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+
+	var failed, skipped int
+	for _, r := range results {
+		switch r.Outcome {
+		case domain.KeyFailed:
+			failed++
+			if !errors.Is(r.Err, context.Canceled) {
+				t.Errorf("%s failed with %v, want context.Canceled", r.Key, r.Err)
+			}
+		case domain.KeySkipped:
+			skipped++
+		default:
+			t.Errorf("%s: %v", r.Key, r.Outcome)
+		}
+	}
+	if failed < 1 || failed > 2 || failed+skipped != 10 {
+		t.Errorf("%d failed and %d skipped, want at most 2 started and the rest skipped", failed, skipped)
+	}
+}
+
+func TestRunWithNoKeys(t *testing.T) {
+	results, err := Run(context.Background(), 4, nil, func(context.Context, string) error {
+		t.Error("called without keys")
+		return nil
+	})
+	if err != nil || len(results) != 0 {
+		t.Errorf("Run = %v, %v", results, err)
+	}
+}
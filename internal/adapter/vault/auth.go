@@ -0,0 +1,50 @@
+package vault
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultAddr is where the vault CLI looks when VAULT_ADDR is unset.
+const DefaultAddr = "https://127.0.0.1:8200"
+
+// ResolveAddr returns the configured address, else VAULT_ADDR, else
+// DefaultAddr.
+func ResolveAddr(configured string) string {
+	if configured != "" {
+		return configured
+	}
+	if addr := os.Getenv("VAULT_ADDR"); addr != "" {
+		return addr
+	}
+	return DefaultAddr
+}
+
+// ResolveNamespace returns the configured Vault Enterprise namespace,
+// else VAULT_NAMESPACE.
+func ResolveNamespace(configured string) string {
+	if configured != "" {
+		return configured
+	}
+	return os.Getenv("VAULT_NAMESPACE")
+}
+
+// ResolveAuth picks how to log in. AppRole credentials win when a role ID
+// is configured; otherwise the token is the configured one, then
+// VAULT_TOKEN, then the vault CLI's ~/.vault-token.
+func ResolveAuth(token, roleID, secretID string) Auth {
+	if roleID != "" {
+		return Auth{RoleID: roleID, SecretID: secretID}
+	}
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+	if token == "" {
+		home, _ := os.UserHomeDir()
+		if data, err := os.ReadFile(filepath.Join(home, ".vault-token")); err == nil {
+			token = strings.TrimSpace(string(data))
+		}
+	}
+	return Auth{Token: token}
+}
@@ -0,0 +1,188 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stormingluke/autoenv/internal/adapter/httpretry"
+)
+
+// Auth is how the client logs in: a token, or an AppRole role and secret
+// ID exchanged for a token on first use.
+type Auth struct {
+	Token    string
+	RoleID   string
+	SecretID string
+}
+
+type client struct {
+	http      *http.Client
+	baseURL   string
+	namespace string
+	auth      Auth
+
+	mu    sync.Mutex
+	token string
+}
+
+// APIError is a non-2xx response from Vault. RetryAfter is how long a
+// rate limit quota asked to wait before retrying, if it said.
+type APIError struct {
+	StatusCode int
+	Errors     []string
+	RetryAfter time.Duration
+	body       []byte
+}
+
+func (e *APIError) Error() string {
+	if len(e.Errors) == 0 {
+		return fmt.Sprintf("vault: %s", http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("vault: %s (%d)", strings.Join(e.Errors, "; "), e.StatusCode)
+}
+
+func newClient(addr, namespace string, auth Auth) *client {
+	return &client{
+		http:      &http.Client{Timeout: 30 * time.Second},
+		baseURL:   strings.TrimRight(addr, "/") + "/v1",
+		namespace: namespace,
+		auth:      auth,
+		token:     auth.Token,
+	}
+}
+
+// login returns the client token, logging in with AppRole the first time
+// when no token was given.
+func (c *client) login(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" {
+		return c.token, nil
+	}
+	if c.auth.RoleID == "" {
+		return "", fmt.Errorf("no Vault token: set VAULT_TOKEN or AUTOENV_VAULT_TOKEN, run `vault login`, or set AUTOENV_VAULT_ROLE_ID for AppRole")
+	}
+
+	body := map[string]string{"role_id": c.auth.RoleID}
+	if c.auth.SecretID != "" {
+		body["secret_id"] = c.auth.SecretID
+	}
+	var resp struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	// Logging in again only issues another token, so the POST is retried.
+	if err := c.retry(ctx, http.MethodPost, "/auth/approle/login", "", body, &resp, true); err != nil {
+		return "", fmt.Errorf("approle login: %w", err)
+	}
+	if resp.Auth.ClientToken == "" {
+		return "", fmt.Errorf("approle login: no token in response")
+	}
+	c.token = resp.Auth.ClientToken
+	return c.token, nil
+}
+
+// do sends an authenticated JSON request, decoding the response into out
+// if set.
+func (c *client) do(ctx context.Context, method, path string, body, out any) error {
+	token, err := c.login(ctx)
+	if err != nil {
+		return err
+	}
+	return c.retry(ctx, method, path, token, body, out, idempotent(method))
+}
+
+// retry sends a request and, if again is set, retries rate limits, server
+// errors and network failures with exponential backoff until ctx is done.
+func (c *client) retry(ctx context.Context, method, path, token string, body, out any, again bool) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	send := func() error { return c.send(ctx, method, path, token, data, out) }
+	if !again {
+		return send()
+	}
+	return httpretry.Do(ctx, send, temporary)
+}
+
+func (c *client) send(ctx context.Context, method, path, token string, data []byte, out any) error {
+	var r io.Reader
+	if data != nil {
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, r)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if c.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", c.namespace)
+	}
+	if data != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		apiErr.RetryAfter, _ = httpretry.RetryAfter(resp.Header)
+		apiErr.body, _ = io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		var msg struct {
+			Errors []string `json:"errors"`
+		}
+		if json.Unmarshal(apiErr.body, &msg) == nil {
+			apiErr.Errors = msg.Errors
+		}
+		return apiErr
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// idempotent reports whether a request can be sent again without risk.
+// A KV write that failed with a server error or a dropped connection may
+// still have created a version, and sending it again would fail its
+// check-and-set; Vault treats PUT as the same write as POST.
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// temporary reports whether a failed request may succeed if sent again,
+// and how long Vault asked to wait first. Vault answers 412 while a
+// performance standby catches up.
+func temporary(err error) (time.Duration, bool) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusTooManyRequests ||
+		apiErr.StatusCode == http.StatusPreconditionFailed || apiErr.StatusCode >= 500) {
+		return apiErr.RetryAfter, true
+	}
+	return 0, false
+}
@@ -0,0 +1,201 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/stormingluke/autoenv/internal/domain"
+	"github.com/stormingluke/autoenv/internal/port"
+)
+
+var (
+	_ port.SecretSyncer = (*KVStore)(nil)
+	_ port.SecretSource = (*KVStore)(nil)
+)
+
+// casAttempts bounds how often a write is retried after another writer
+// changed the secret between our read and write.
+const casAttempts = 5
+
+// KVStore keeps a project's values as the fields of one KV v2 secret.
+// Every write is a new version made with check-and-set on the version it
+// was based on, so concurrent writers never silently undo each other.
+type KVStore struct {
+	client *client
+}
+
+// NewKVStore returns a store for the Vault server at addr, in namespace
+// when set.
+func NewKVStore(addr, namespace string, auth Auth) *KVStore {
+	return &KVStore{client: newClient(addr, namespace, auth)}
+}
+
+type secret struct {
+	Data struct {
+		Data     map[string]any `json:"data"`
+		Metadata struct {
+			Version int `json:"version"`
+		} `json:"metadata"`
+	} `json:"data"`
+}
+
+func (s *KVStore) List(ctx context.Context, t domain.SyncTarget) ([]string, error) {
+	data, _, err := s.read(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(data))
+	for name := range data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Fetch returns the secret's fields. Values that are not strings, as
+// written by other tools, are returned as JSON.
+func (s *KVStore) Fetch(ctx context.Context, t domain.SyncTarget) (map[string]string, error) {
+	data, _, err := s.read(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]string, len(data))
+	for name, v := range data {
+		if str, ok := v.(string); ok {
+			values[name] = str
+			continue
+		}
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		values[name] = string(raw)
+	}
+	return values, nil
+}
+
+// Sync writes the values into the secret, keeping its other fields. The
+// write is a single version, so every key shares its outcome.
+func (s *KVStore) Sync(ctx context.Context, t domain.SyncTarget, values map[string]string) ([]domain.KeyResult, error) {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	err := s.update(ctx, t, func(data map[string]any) {
+		for key, v := range values {
+			data[key] = v
+		}
+	})
+	return results(keys, err)
+}
+
+func (s *KVStore) Delete(ctx context.Context, t domain.SyncTarget, names []string) ([]domain.KeyResult, error) {
+	err := s.update(ctx, t, func(data map[string]any) {
+		for _, name := range names {
+			delete(data, name)
+		}
+	})
+	return results(names, err)
+}
+
+// update applies change to the latest version of the secret and writes
+// the result, starting over if another writer got in first.
+func (s *KVStore) update(ctx context.Context, t domain.SyncTarget, change func(map[string]any)) error {
+	for attempt := 1; ; attempt++ {
+		data, version, err := s.read(ctx, t)
+		if err != nil {
+			return err
+		}
+		change(data)
+		body := map[string]any{
+			"options": map[string]int{"cas": version},
+			"data":    data,
+		}
+		err = s.client.do(ctx, http.MethodPost, dataPath(t), body, nil)
+		switch {
+		case err == nil:
+			return nil
+		case !casMismatch(err):
+			return fmt.Errorf("write %s: %w", t, err)
+		case attempt == casAttempts:
+			return fmt.Errorf("write %s: the secret kept changing while writing it; try again", t)
+		}
+	}
+}
+
+// read returns the latest version of the secret's data. A secret that was
+// never written is empty at version 0; one whose latest version was
+// deleted is empty at that version, which the next write must be based on.
+func (s *KVStore) read(ctx context.Context, t domain.SyncTarget) (map[string]any, int, error) {
+	var sec secret
+	err := s.client.do(ctx, http.MethodGet, dataPath(t), nil, &sec)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		sec = secret{}
+		_ = json.Unmarshal(apiErr.body, &sec)
+		sec.Data.Data = nil
+		err = nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("read %s: %w", t, err)
+	}
+	if sec.Data.Data == nil {
+		sec.Data.Data = make(map[string]any)
+	}
+	return sec.Data.Data, sec.Data.Metadata.Version, nil
+}
+
+// casMismatch reports whether a write was refused because the secret is
+// no longer at the version it was based on.
+func casMismatch(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		return false
+	}
+	for _, msg := range apiErr.Errors {
+		if strings.Contains(msg, "check-and-set") {
+			return true
+		}
+	}
+	return false
+}
+
+// results gives every key the outcome of a single write. A cancelled
+// write is the run's error, and its keys are skipped.
+func results(keys []string, err error) ([]domain.KeyResult, error) {
+	keys = append([]string(nil), keys...)
+	sort.Strings(keys)
+	out := make([]domain.KeyResult, len(keys))
+	for i, key := range keys {
+		switch {
+		case err == nil:
+			out[i] = domain.KeyResult{Key: key, Outcome: domain.KeyOK}
+		case errors.Is(err, context.Canceled):
+			out[i] = domain.KeyResult{Key: key, Outcome: domain.KeySkipped}
+		default:
+			out[i] = domain.KeyResult{Key: key, Outcome: domain.KeyFailed, Err: err}
+		}
+	}
+	if errors.Is(err, context.Canceled) {
+		return out, err
+	}
+	return out, nil
+}
+
+func dataPath(t domain.SyncTarget) string {
+	return "/" + escapePath(t.Owner) + "/data/" + escapePath(t.Repo)
+}
+
+func escapePath(p string) string {
+	segs := strings.Split(p, "/")
+	for i, seg := range segs {
+		segs[i] = url.PathEscape(seg)
+	}
+	return strings.Join(segs, "/")
+}
@@ -0,0 +1,343 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stormingluke/autoenv/internal/adapter/httpretry"
+	"github.com/stormingluke/autoenv/internal/domain"
+)
+
+// fakeVault serves one KV v2 secret at secret/data/app with Vault's
+// check-and-set rules. The next racing writes each find that another
+// writer got in between their read and write.
+type fakeVault struct {
+	t         *testing.T
+	token     string
+	namespace string
+
+	mu        sync.Mutex
+	version   int
+	data      map[string]any
+	deleted   bool
+	destroyed bool
+	racing    int
+	writes    []int // the cas of each write, in order
+	logins    []map[string]string
+
+	// failures are answered, in order, before any request is served,
+	// with retryAfter as the Retry-After header if set.
+	failures   []int
+	retryAfter string
+	requests   int
+	failWrites int
+}
+
+const secretPath = "/v1/secret/data/app"
+
+var app = domain.SyncTarget{Provider: domain.ProviderVault, Owner: "secret", Repo: "app"}
+
+func newFakeVault(t *testing.T, auth Auth, namespace string) (*fakeVault, *KVStore) {
+	t.Helper()
+	f := &fakeVault{t: t, token: "s.test", namespace: namespace}
+	srv := httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(srv.Close)
+	return f, NewKVStore(srv.URL, namespace, auth)
+}
+
+func (f *fakeVault) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests++
+	if len(f.failures) > 0 {
+		if f.retryAfter != "" {
+			w.Header().Set("Retry-After", f.retryAfter)
+		}
+		writeJSON(w, f.failures[0], map[string]any{"errors": []string{"try again"}})
+		f.failures = f.failures[1:]
+		return
+	}
+	if got := r.Header.Get("X-Vault-Namespace"); got != f.namespace {
+		f.t.Errorf("%s %s: X-Vault-Namespace = %q, want %q", r.Method, r.URL.Path, got, f.namespace)
+	}
+
+	if r.Method == http.MethodPost && r.URL.Path == "/v1/auth/approle/login" {
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		f.logins = append(f.logins, body)
+		if body["role_id"] != "role" || body["secret_id"] != "secret" {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"errors": []string{"invalid role or secret ID"}})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"auth": map[string]any{"client_token": f.token}})
+		return
+	}
+	if got := r.Header.Get("X-Vault-Token"); got != f.token {
+		writeJSON(w, http.StatusForbidden, map[string]any{"errors": []string{"permission denied"}})
+		return
+	}
+	if r.URL.Path != secretPath {
+		writeJSON(w, http.StatusNotFound, map[string]any{"errors": []string{}})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		metadata := map[string]any{"version": f.version, "destroyed": f.destroyed, "deletion_time": ""}
+		switch {
+		case f.version == 0:
+			writeJSON(w, http.StatusNotFound, map[string]any{"errors": []string{}})
+		case f.deleted || f.destroyed:
+			// Vault still describes the version it cannot return.
+			if f.deleted {
+				metadata["deletion_time"] = "2026-10-01T00:00:00Z"
+			}
+			writeJSON(w, http.StatusNotFound, map[string]any{"data": map[string]any{"data": nil, "metadata": metadata}})
+		default:
+			writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"data": f.data, "metadata": metadata}})
+		}
+	case http.MethodPost:
+		var body struct {
+			Options struct {
+				CAS int `json:"cas"`
+			} `json:"options"`
+			Data map[string]any `json:"data"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			f.t.Errorf("write body: %v", err)
+		}
+		if f.failWrites > 0 {
+			f.failWrites--
+			writeJSON(w, http.StatusInternalServerError, map[string]any{"errors": []string{"internal error"}})
+			return
+		}
+		f.writes = append(f.writes, body.Options.CAS)
+		if f.racing > 0 {
+			f.racing--
+			f.put(map[string]any{"OTHER": "written meanwhile", "KEEP": f.data["KEEP"]})
+		}
+		if body.Options.CAS != f.version {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"errors": []string{"check-and-set parameter did not match the current version"}})
+			return
+		}
+		f.put(body.Data)
+		writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"version": f.version}})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// put stores a new version of the secret. Callers hold f.mu.
+func (f *fakeVault) put(data map[string]any) {
+	f.version++
+	f.data = maps.Clone(data)
+	f.deleted, f.destroyed = false, false
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func tokenAuth() Auth { return Auth{Token: "s.test"} }
+
+func TestSyncRereadsAndMergesAfterAConcurrentWrite(t *testing.T) {
+	f, s := newFakeVault(t, tokenAuth(), "")
+	f.put(map[string]any{"KEEP": "1", "API_KEY": "old"})
+	f.racing = 2
+
+	rs, err := s.Sync(context.Background(), app, map[string]string{"API_KEY": "new"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs) != 1 || rs[0].Outcome != domain.KeyOK {
+		t.Fatalf("results = %+v", rs)
+	}
+	if want := []int{1, 2, 3}; !slices.Equal(f.writes, want) {
+		t.Errorf("writes based on versions %v, want %v", f.writes, want)
+	}
+	want := map[string]any{"KEEP": "1", "OTHER": "written meanwhile", "API_KEY": "new"}
+	if !maps.Equal(f.data, want) || f.version != 4 {
+		t.Errorf("secret = %v at version %d, want %v at 4", f.data, f.version, want)
+	}
+}
+
+func TestSyncGivesUpWhenTheSecretKeepsChanging(t *testing.T) {
+	f, s := newFakeVault(t, tokenAuth(), "")
+	f.put(map[string]any{"KEEP": "1"})
+	f.racing = casAttempts + 1
+
+	rs, err := s.Sync(context.Background(), app, map[string]string{"A": "1", "B": "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range rs {
+		if r.Outcome != domain.KeyFailed || !strings.Contains(r.Err.Error(), "kept changing") {
+			t.Errorf("%s: %v %v, want failed because the secret kept changing", r.Key, r.Outcome, r.Err)
+		}
+	}
+	if len(f.writes) != casAttempts {
+		t.Errorf("%d writes, want %d", len(f.writes), casAttempts)
+	}
+	if _, ok := f.data["A"]; ok {
+		t.Error("A was written")
+	}
+}
+
+// A secret whose latest version was deleted or destroyed reads as empty,
+// and the next write is based on that version rather than failing the
+// check-and-set.
+func TestWriteAfterTheLatestVersionIsGone(t *testing.T) {
+	tests := []struct {
+		name    string
+		prepare func(*fakeVault)
+		cas     int
+	}{
+		{"never written", func(*fakeVault) {}, 0},
+		{"deleted", func(f *fakeVault) {
+			f.put(map[string]any{"OLD": "1"})
+			f.put(map[string]any{"OLD": "2"})
+			f.deleted = true
+		}, 2},
+		{"destroyed", func(f *fakeVault) {
+			f.put(map[string]any{"OLD": "1"})
+			f.put(map[string]any{"OLD": "2"})
+			f.put(map[string]any{"OLD": "3"})
+			f.destroyed = true
+		}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, s := newFakeVault(t, tokenAuth(), "")
+			tt.prepare(f)
+
+			values, err := s.Fetch(context.Background(), app)
+			if err != nil || len(values) != 0 {
+				t.Fatalf("Fetch = %v, %v; want nothing", values, err)
+			}
+			rs, err := s.Sync(context.Background(), app, map[string]string{"NEW": "1"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rs[0].Outcome != domain.KeyOK {
+				t.Fatalf("NEW: %v %v", rs[0].Outcome, rs[0].Err)
+			}
+			if !slices.Equal(f.writes, []int{tt.cas}) {
+				t.Errorf("writes based on versions %v, want [%d]", f.writes, tt.cas)
+			}
+			if want := map[string]any{"NEW": "1"}; !maps.Equal(f.data, want) {
+				t.Errorf("secret = %v, want %v", f.data, want)
+			}
+		})
+	}
+}
+
+func TestAppRoleLogsInOnceAndUsesItsToken(t *testing.T) {
+	f, s := newFakeVault(t, Auth{RoleID: "role", SecretID: "secret"}, "team/dev")
+	f.put(map[string]any{"A": "1"})
+
+	// The fake refuses any other token, so reads succeed only with the
+	// one the login returned.
+	for range 2 {
+		values, err := s.Fetch(context.Background(), app)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if values["A"] != "1" {
+			t.Errorf("Fetch = %v", values)
+		}
+	}
+	if len(f.logins) != 1 {
+		t.Errorf("%d logins, want 1", len(f.logins))
+	}
+}
+
+func TestAppRoleLoginFailure(t *testing.T) {
+	f, s := newFakeVault(t, Auth{RoleID: "role", SecretID: "wrong"}, "")
+	_, err := s.Fetch(context.Background(), app)
+	if err == nil || !strings.Contains(err.Error(), "approle login") || !strings.Contains(err.Error(), "invalid role or secret ID (400)") {
+		t.Fatalf("Fetch = %v, want the login error", err)
+	}
+	if len(f.logins) != 1 {
+		t.Errorf("%d logins, want 1: a rejected login is not retried", len(f.logins))
+	}
+}
+
+func TestReadsAndLoginsAreRetried(t *testing.T) {
+	defer func(d time.Duration) { httpretry.Base = d }(httpretry.Base)
+	httpretry.Base = time.Millisecond
+
+	f, s := newFakeVault(t, Auth{RoleID: "role", SecretID: "secret"}, "")
+	f.put(map[string]any{"A": "1"})
+	// The first two failures hit the login, the next two the read.
+	f.failures = []int{http.StatusInternalServerError, http.StatusBadGateway, http.StatusTooManyRequests, http.StatusPreconditionFailed}
+
+	values, err := s.Fetch(context.Background(), app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values["A"] != "1" {
+		t.Errorf("Fetch = %v", values)
+	}
+	if len(f.logins) != 1 || f.requests != 6 {
+		t.Errorf("%d logins in %d requests, want 1 in 6", len(f.logins), f.requests)
+	}
+}
+
+// A write that failed may still have created a version, so it is not
+// sent again.
+func TestWritesAreNotRetried(t *testing.T) {
+	defer func(d time.Duration) { httpretry.Base = d }(httpretry.Base)
+	httpretry.Base = time.Millisecond
+
+	f, s := newFakeVault(t, tokenAuth(), "")
+	f.put(map[string]any{"A": "1"})
+	f.failWrites = 1
+
+	rs, err := s.Sync(context.Background(), app, map[string]string{"B": "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rs[0].Outcome != domain.KeyFailed {
+		t.Errorf("B: %v, want failed", rs[0].Outcome)
+	}
+	if f.requests != 2 || f.version != 1 {
+		t.Errorf("%d requests left the secret at version %d, want a read and one write, at 1", f.requests, f.version)
+	}
+}
+
+func TestRetryAfterIsHonored(t *testing.T) {
+	defer func(d time.Duration) { httpretry.Base = d }(httpretry.Base)
+	// Without Retry-After the retry would not happen before the deadline.
+	httpretry.Base = time.Hour
+
+	f, s := newFakeVault(t, tokenAuth(), "")
+	f.put(map[string]any{"A": "1"})
+	f.failures = []int{http.StatusTooManyRequests}
+	f.retryAfter = "1"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := s.Fetch(ctx, app); err != nil {
+		t.Fatal(err)
+	}
+
+	// A wait longer than httpretry.MaxWait is reported instead.
+	f.failures = []int{http.StatusTooManyRequests}
+	f.retryAfter = "3600"
+	_, err := s.Fetch(ctx, app)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.RetryAfter != time.Hour {
+		t.Errorf("Fetch = %v, want the 429 asking to wait an hour", err)
+	}
+}
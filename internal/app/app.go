@@ -1,30 +1,56 @@
 package app
 
-import "github.com/stormingluke/autoenv/internal/port"
+import (
+	"github.com/stormingluke/autoenv/internal/domain"
+	"github.com/stormingluke/autoenv/internal/port"
+)
 
 type App struct {
 	Export    *ExportService
-	Clear    *ClearService
-	List     *ListService
-	Sync     *SyncService
+	Clear     *ClearService
+	List      *ListService
+	Sync      *SyncService
 	Configure *ConfigureService
+	Render    *RenderService
+	Import    *ImportService
+	Project   *ProjectService
+	Load      *LoadService
+	DBSync    *DBSyncService
 }
 
 type Deps struct {
-	Projects  port.ProjectRepository
-	Sessions  port.SessionRepository
-	EnvLoader port.EnvLoader
-	Shell     port.ShellRenderer
-	Syncer    port.SecretSyncer
-	Config    port.ConfigStore
+	Projects     port.ProjectRepository
+	Sessions     port.SessionRepository
+	Usage        port.UsageRepository
+	EnvLoader    port.EnvLoader
+	EnvWriter    port.EnvWriter
+	Shell        port.ShellRenderer
+	Syncer       port.SecretSyncer
+	GitLabSyncer port.SecretSyncer
+	Hosts        domain.Hosts
+	VaultSyncer  port.SecretSyncer
+	Sources      map[domain.Provider]port.SecretSource
+	SyncLedger   port.SyncLedger
+	Config       port.ConfigStore
+	Repos        port.RepoInspector
+	Scanner      port.ProjectScanner
+	DBSyncer     port.DatabaseSyncer
+	SyncLog      port.SyncLog
+	Hasher       *domain.Hasher
 }
 
 func New(d Deps) *App {
+	projects := &ProjectService{projects: d.Projects, repos: d.Repos, envLoader: d.EnvLoader, scanner: d.Scanner, hasher: d.Hasher, hosts: d.Hosts, ledger: d.SyncLedger}
 	return &App{
-		Export:    &ExportService{sessions: d.Sessions, envLoader: d.EnvLoader, shell: d.Shell},
-		Clear:    &ClearService{sessions: d.Sessions, shell: d.Shell},
-		List:     &ListService{projects: d.Projects},
-		Sync:     &SyncService{projects: d.Projects, envLoader: d.EnvLoader, syncer: d.Syncer, config: d.Config},
+		Export:    &ExportService{projects: d.Projects, sessions: d.Sessions, envLoader: d.EnvLoader, shell: d.Shell, config: d.Config, usage: d.Usage, hasher: d.Hasher},
+		Clear:     &ClearService{sessions: d.Sessions, shell: d.Shell},
+		List:      &ListService{projects: d.Projects, usage: d.Usage, envLoader: d.EnvLoader},
+		Sync:      &SyncService{projects: d.Projects, envLoader: d.EnvLoader, syncer: d.Syncer, gitlab: d.GitLabSyncer, hosts: d.Hosts, vault: d.VaultSyncer, sources: d.Sources, writer: d.EnvWriter, config: d.Config, ledger: d.SyncLedger, hasher: d.Hasher},
 		Configure: &ConfigureService{config: d.Config},
+		Render:    &RenderService{envLoader: d.EnvLoader},
+		Import:    &ImportService{envLoader: d.EnvLoader, writer: d.EnvWriter},
+		Project:   projects,
+		Load:      &LoadService{envLoader: d.EnvLoader, projects: projects, usage: d.Usage},
+		DBSync:    &DBSyncService{syncer: d.DBSyncer, log: d.SyncLog, config: d.Config},
 	}
 }
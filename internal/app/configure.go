@@ -15,6 +15,16 @@ func (s *ConfigureService) Set(key, value string) error {
 	if s.config == nil {
 		return fmt.Errorf("config store not available")
 	}
+	switch key {
+	case domain.AutoloadModeKey:
+		if _, err := domain.ParseAutoloadMode(value); err != nil {
+			return err
+		}
+	case domain.SyncIntervalKey:
+		if _, err := domain.ParseSyncInterval(value); err != nil {
+			return err
+		}
+	}
 	return s.config.Set(key, value)
 }
 
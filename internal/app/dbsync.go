@@ -0,0 +1,91 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/stormingluke/autoenv/internal/domain"
+	"github.com/stormingluke/autoenv/internal/port"
+)
+
+type DBSyncService struct {
+	syncer port.DatabaseSyncer
+	log    port.SyncLog
+	config port.ConfigStore
+}
+
+type DBSyncStatus struct {
+	LastSuccess *domain.DBSyncRecord
+	Recent      []domain.DBSyncRecord
+	Interval    time.Duration
+}
+
+// Sync replicates the registry and records the attempt, successful or not.
+func (s *DBSyncService) Sync() (domain.Replication, error) {
+	if s.syncer == nil {
+		return domain.Replication{}, fmt.Errorf("database sync not available")
+	}
+	r, err := s.syncer.Sync()
+	if errors.Is(err, domain.ErrSyncDisabled) {
+		return r, err
+	}
+	rec := domain.DBSyncRecord{Replication: r}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	if s.log != nil {
+		if logErr := s.log.Record(rec); logErr != nil && err == nil {
+			err = fmt.Errorf("record sync: %w", logErr)
+		}
+	}
+	return r, err
+}
+
+// SyncIfDue syncs when sync.interval is set and the last successful sync
+// is older than it. It reports whether a sync was attempted.
+func (s *DBSyncService) SyncIfDue(now time.Time) (bool, error) {
+	interval, err := s.interval()
+	if err != nil || interval == 0 {
+		return false, err
+	}
+	last, err := s.log.LastSuccess()
+	if err != nil {
+		return false, err
+	}
+	if last != nil {
+		at, err := time.Parse(time.RFC3339, last.At)
+		if err == nil && now.Sub(at) < interval {
+			return false, nil
+		}
+	}
+	_, err = s.Sync()
+	return true, err
+}
+
+func (s *DBSyncService) Status(limit int) (*DBSyncStatus, error) {
+	st := &DBSyncStatus{}
+	var err error
+	if st.Interval, err = s.interval(); err != nil {
+		return nil, err
+	}
+	if st.LastSuccess, err = s.log.LastSuccess(); err != nil {
+		return nil, err
+	}
+	if st.Recent, err = s.log.Recent(limit); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+func (s *DBSyncService) interval() (time.Duration, error) {
+	if s.config == nil {
+		return 0, nil
+	}
+	value, err := s.config.Get(domain.SyncIntervalKey)
+	if err != nil {
+		// Unset
+		return 0, nil
+	}
+	return domain.ParseSyncInterval(value)
+}
@@ -6,14 +6,17 @@ import (
 )
 
 type ExportService struct {
+	projects  port.ProjectReader
 	sessions  port.SessionRepository
 	envLoader port.EnvLoader
 	shell     port.ShellRenderer
+	config    port.ConfigStore
+	usage     port.UsageRepository
+	hasher    *domain.Hasher
 }
 
 func (s *ExportService) Export(shellType string, shellPID int, cwd string) (string, error) {
-	// Load .env directly from cwd (no project DB lookup)
-	envFile, err := s.envLoader.Load(cwd)
+	envFile, err := s.loadEnv(cwd)
 	if err != nil {
 		return "", err
 	}
@@ -28,23 +31,29 @@ func (s *ExportService) Export(shellType string, shellPID int, cwd string) (stri
 		return "", err
 	}
 
-	// No .env in current directory
+	// No .env in current directory, or loading it is not allowed
 	if envFile == nil {
 		if session == nil {
 			return "", nil
 		}
+		// Values put in by `pull --session` stay until the shell leaves.
+		if session.ProjectPath == cwd && session.Pulled {
+			return "", nil
+		}
 		output := s.shell.FormatUnsets(shellType, domain.KeyNames(loadedKeys))
 		output += "unset _AUTOENV_ACTIVE\n"
 		_ = s.sessions.Delete(shellPID)
 		return output, nil
 	}
 
-	// Same directory, unchanged .env — skip
-	if session != nil && session.ProjectPath == cwd && session.EnvFileMtime == envFile.Mtime {
+	// Same directory, unchanged .env — skip, unless the stored hashes are
+	// from an older version and need rewriting
+	if session != nil && session.ProjectPath == cwd && session.EnvFileMtime == envFile.Mtime &&
+		!domain.NeedsRehash(loadedKeys) {
 		return "", nil
 	}
 
-	diff := domain.Diff(envFile, loadedKeys)
+	diff := domain.Diff(s.hasher, envFile, loadedKeys)
 
 	// Switching directories — unset old keys not in new .env
 	if session != nil && session.ProjectPath != cwd {
@@ -58,8 +67,76 @@ func (s *ExportService) Export(shellType string, shellPID int, cwd string) (stri
 	output := s.shell.FormatUnsets(shellType, diff.Unset) + s.shell.FormatExports(shellType, diff.Export)
 	output += "export _AUTOENV_ACTIVE=1\n"
 
-	_ = s.sessions.Upsert(shellPID, cwd, envFile.Mtime)
-	_ = s.sessions.SetKeys(shellPID, domain.KeyHashes(envFile))
+	if s.usage != nil && (session == nil || session.ProjectPath != cwd) {
+		_ = s.usage.Touch(cwd)
+	}
+	_ = s.sessions.Upsert(shellPID, cwd, envFile.Mtime, false)
+	_ = s.sessions.SetKeys(shellPID, s.hasher.KeyHashes(envFile))
 
 	return output, nil
 }
+
+// Record adds values exported into the shell outside the hook, as by
+// `pull --session`, to the shell's session, so the hook unsets them once
+// the shell leaves cwd. Keys the hook loaded from cwd's .env are kept.
+func (s *ExportService) Record(shellPID int, cwd string, values map[string]string) error {
+	session, err := s.sessions.Get(shellPID)
+	if err != nil {
+		return err
+	}
+	hashes := make(map[string]string, len(values))
+	var mtime int64
+	if session != nil && session.ProjectPath == cwd {
+		loadedKeys, err := s.sessions.GetKeys(shellPID)
+		if err != nil {
+			return err
+		}
+		for _, k := range loadedKeys {
+			hashes[k.KeyName] = k.KeyHash
+		}
+		mtime = session.EnvFileMtime
+	}
+	for k, v := range values {
+		hashes[k] = s.hasher.Hash(v)
+	}
+	if err := s.sessions.Upsert(shellPID, cwd, mtime, true); err != nil {
+		return err
+	}
+	return s.sessions.SetKeys(shellPID, hashes)
+}
+
+// loadEnv returns the .env for cwd, or nil when the autoload mode says
+// this directory should not be loaded.
+func (s *ExportService) loadEnv(cwd string) (*domain.EnvFile, error) {
+	switch s.autoloadMode() {
+	case domain.AutoloadOff:
+		return nil, nil
+	case domain.AutoloadRegistered:
+		if s.projects == nil {
+			return nil, nil
+		}
+		project, err := s.projects.MatchCurrent(cwd)
+		if err != nil {
+			return nil, err
+		}
+		if project == nil {
+			return nil, nil
+		}
+	}
+	return s.envLoader.Load(cwd)
+}
+
+func (s *ExportService) autoloadMode() domain.AutoloadMode {
+	if s.config == nil {
+		return domain.DefaultAutoloadMode
+	}
+	value, err := s.config.Get(domain.AutoloadModeKey)
+	if err != nil {
+		return domain.DefaultAutoloadMode
+	}
+	mode, err := domain.ParseAutoloadMode(value)
+	if err != nil {
+		return domain.DefaultAutoloadMode
+	}
+	return mode
+}
@@ -0,0 +1,41 @@
+package app
+
+import (
+	"github.com/stormingluke/autoenv/internal/domain"
+	"github.com/stormingluke/autoenv/internal/port"
+)
+
+type ImportService struct {
+	envLoader port.EnvLoader
+	writer    port.EnvWriter
+}
+
+// Plan compares incoming values against the project's current .env
+// without modifying anything.
+func (s *ImportService) Plan(projectPath string, incoming map[string]string) ([]domain.EnvChange, error) {
+	envFile, err := s.envLoader.Load(projectPath)
+	if err != nil {
+		return nil, err
+	}
+	var current map[string]string
+	if envFile != nil {
+		current = envFile.Values
+	}
+	return domain.CompareEnv(current, incoming), nil
+}
+
+// Apply writes the added and updated keys from changes into the project's
+// .env, leaving unchanged keys and the rest of the file as they are.
+func (s *ImportService) Apply(projectPath string, incoming map[string]string, changes []domain.EnvChange) error {
+	values := make(map[string]string, len(changes))
+	for _, c := range changes {
+		if c.Kind == domain.ChangeUnchanged {
+			continue
+		}
+		values[c.Key] = incoming[c.Key]
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	return s.writer.Merge(projectPath, values)
+}
@@ -1,14 +1,97 @@
 package app
 
 import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
 	"github.com/stormingluke/autoenv/internal/domain"
 	"github.com/stormingluke/autoenv/internal/port"
 )
 
 type ListService struct {
-	projects port.ProjectReader
+	projects  port.ProjectReader
+	usage     port.UsageRepository
+	envLoader port.EnvLoader
+}
+
+type ListOptions struct {
+	// Tag keeps only projects carrying this tag.
+	Tag string
+	// Filter is a glob matched against the project name, path and
+	// directory name.
+	Filter string
+	// Sort is one of "name" (default), "created" or "last-used".
+	Sort string
+}
+
+func (s *ListService) List(opts ListOptions) ([]domain.Project, error) {
+	if opts.Filter != "" {
+		if _, err := filepath.Match(opts.Filter, ""); err != nil {
+			return nil, fmt.Errorf("invalid filter %q: %w", opts.Filter, err)
+		}
+	}
+
+	all, err := s.projects.ListAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var used map[string]string
+	if s.usage != nil {
+		if used, err = s.usage.LastUsed(); err != nil {
+			return nil, err
+		}
+	}
+
+	projects := make([]domain.Project, 0, len(all))
+	for _, p := range all {
+		if opts.Tag != "" && !p.HasTag(opts.Tag) {
+			continue
+		}
+		if opts.Filter != "" && !matchesFilter(opts.Filter, &p) {
+			continue
+		}
+		p.LastUsedAt = lastUsed(p.Path, used)
+		checkEnv(s.envLoader, &p)
+		projects = append(projects, p)
+	}
+
+	switch opts.Sort {
+	case "", "name":
+		// ListAll already orders by name
+	case "created":
+		sort.SliceStable(projects, func(i, j int) bool { return projects[i].CreatedAt < projects[j].CreatedAt })
+	case "last-used":
+		// Most recent first; never-used projects sort last
+		sort.SliceStable(projects, func(i, j int) bool { return projects[i].LastUsedAt > projects[j].LastUsedAt })
+	default:
+		return nil, fmt.Errorf("invalid sort %q (valid: name, created, last-used)", opts.Sort)
+	}
+
+	return projects, nil
+}
+
+func matchesFilter(pattern string, p *domain.Project) bool {
+	for _, candidate := range []string{p.Name, p.Path, filepath.Base(p.Path)} {
+		if ok, _ := filepath.Match(pattern, candidate); ok {
+			return true
+		}
+	}
+	return false
 }
 
-func (s *ListService) ListProjects() ([]domain.Project, error) {
-	return s.projects.ListAll()
+// lastUsed returns the most recent use of the project directory or any
+// directory below it, since the hook records the directory it loaded.
+func lastUsed(projectPath string, used map[string]string) string {
+	latest := ""
+	for dir, at := range used {
+		if !domain.Within(projectPath, dir) {
+			continue
+		}
+		if at > latest {
+			latest = at
+		}
+	}
+	return latest
 }
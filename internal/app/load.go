@@ -0,0 +1,35 @@
+package app
+
+import (
+	"fmt"
+
+	"github.com/stormingluke/autoenv/internal/domain"
+	"github.com/stormingluke/autoenv/internal/port"
+)
+
+type LoadService struct {
+	envLoader port.EnvLoader
+	projects  *ProjectService
+	usage     port.UsageRepository
+}
+
+// Load reads the .env in dir and registers dir as a project so that it
+// shows up in `autoenv list`.
+func (s *LoadService) Load(dir string) (*domain.EnvFile, *domain.Project, error) {
+	envFile, err := s.envLoader.Load(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	if envFile == nil {
+		return nil, nil, fmt.Errorf("%w in %s", domain.ErrNoEnvFile, dir)
+	}
+
+	project, err := s.projects.Register(dir, "")
+	if err != nil {
+		return nil, nil, fmt.Errorf("register project: %w", err)
+	}
+	if s.usage != nil {
+		_ = s.usage.Touch(project.Path)
+	}
+	return envFile, project, nil
+}
@@ -0,0 +1,520 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"sort"
+
+	"github.com/stormingluke/autoenv/internal/domain"
+	"github.com/stormingluke/autoenv/internal/port"
+)
+
+type ProjectService struct {
+	projects  port.ProjectRepository
+	repos     port.RepoInspector
+	envLoader port.EnvLoader
+	scanner   port.ProjectScanner
+	hasher    *domain.Hasher
+	hosts     domain.Hosts
+	ledger    port.SyncLedger
+}
+
+type ProjectDetails struct {
+	domain.Project
+	EnvFile *domain.EnvFile
+}
+
+// Relocation is the outcome of searching for one project. NewPath is set
+// when exactly one candidate matched and the registry was updated. Taken
+// reports that the one candidate is another project's path, for instance
+// one relocated there earlier in the same run.
+type Relocation struct {
+	Project    domain.Project
+	NewPath    string
+	Candidates []string
+	Taken      bool
+}
+
+// Register adds dir to the registry. An empty name keeps the name of an
+// existing entry, or derives one from the git repository or directory.
+func (s *ProjectService) Register(dir, name string) (*domain.Project, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("resolve path: %w", err)
+	}
+
+	existing, err := s.projects.FindByPath(abs)
+	if err != nil {
+		return nil, err
+	}
+
+	var root, remote string
+	if s.repos != nil {
+		root, _ = s.repos.Root(abs)
+		remote, _ = s.repos.RemoteURL(abs)
+	}
+
+	switch {
+	case name != "":
+		id := 0
+		if existing != nil {
+			id = existing.ID
+		}
+		if err := s.checkNameFree(name, id); err != nil {
+			return nil, err
+		}
+	case existing != nil && existing.Name != "":
+		name = existing.Name
+	default:
+		name, err = s.defaultName(abs, root, remote)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.projects.Upsert(abs, name, remote); err != nil {
+		return nil, err
+	}
+	p, err := s.projects.FindByPath(abs)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		// The write was queued (offline) and is not visible yet
+		return &domain.Project{Path: abs, Name: name, RemoteURL: remote}, nil
+	}
+
+	// Remember the env fingerprint so relocate can recognise the project
+	// if its directory is moved.
+	ef, err := s.envLoader.Load(abs)
+	if err != nil {
+		return nil, err
+	}
+	if fp := s.hasher.Fingerprint(ef); fp != "" && fp != p.Fingerprint {
+		if err := s.projects.SetFingerprint(p.ID, fp); err != nil {
+			return nil, err
+		}
+		p.Fingerprint = fp
+	}
+	return p, nil
+}
+
+func (s *ProjectService) Remove(ref string) (*domain.Project, error) {
+	p, err := s.Resolve(ref)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.projects.Delete(p.ID); err != nil {
+		return p, err
+	}
+	return p, s.forgetSyncs(p.Path)
+}
+
+func (s *ProjectService) Rename(ref, name string) (*domain.Project, error) {
+	p, err := s.Resolve(ref)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkNameFree(name, p.ID); err != nil {
+		return nil, err
+	}
+	if err := s.projects.Rename(p.ID, name); err != nil {
+		return nil, err
+	}
+	p.Name = name
+	return p, nil
+}
+
+func (s *ProjectService) Describe(ref, description string) (*domain.Project, error) {
+	p, err := s.Resolve(ref)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.projects.SetDescription(p.ID, description); err != nil {
+		return nil, err
+	}
+	p.Description = description
+	return p, nil
+}
+
+func (s *ProjectService) AddTags(ref string, tags []string) (*domain.Project, error) {
+	p, err := s.Resolve(ref)
+	if err != nil {
+		return nil, err
+	}
+	for _, tag := range tags {
+		if err := domain.ValidateTag(tag); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.projects.AddTags(p.ID, tags); err != nil {
+		return nil, err
+	}
+	return s.projects.FindByID(p.ID)
+}
+
+func (s *ProjectService) RemoveTags(ref string, tags []string) (*domain.Project, error) {
+	p, err := s.Resolve(ref)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.projects.RemoveTags(p.ID, tags); err != nil {
+		return nil, err
+	}
+	return s.projects.FindByID(p.ID)
+}
+
+func (s *ProjectService) SyncRules(ref string) (*domain.Project, domain.SyncRules, error) {
+	p, err := s.Resolve(ref)
+	if err != nil {
+		return nil, domain.SyncRules{}, err
+	}
+	rules, err := s.projects.SyncRules(p.ID)
+	return p, rules, err
+}
+
+// UpdateSyncRules applies update to a project's sync rules and stores the
+// result.
+func (s *ProjectService) UpdateSyncRules(ref string, update func(*domain.SyncRules)) (*domain.Project, domain.SyncRules, error) {
+	p, rules, err := s.SyncRules(ref)
+	if err != nil {
+		return nil, rules, err
+	}
+	update(&rules)
+	if err := rules.Validate(); err != nil {
+		return nil, rules, err
+	}
+	return p, rules, s.projects.SetSyncRules(p.ID, rules)
+}
+
+func (s *ProjectService) SyncTargets(ref string) (*domain.Project, []domain.NamedSyncTarget, error) {
+	p, err := s.Resolve(ref)
+	if err != nil {
+		return nil, nil, err
+	}
+	targets, err := s.projects.SyncTargets(p.ID)
+	return p, targets, err
+}
+
+// AddSyncTarget saves a named target on a project, replacing any target
+// of the same name.
+func (s *ProjectService) AddSyncTarget(ref string, t domain.NamedSyncTarget) (*domain.Project, error) {
+	if err := domain.ValidateTargetName(t.Name); err != nil {
+		return nil, err
+	}
+	if _, err := t.SyncTarget(s.hosts); err != nil {
+		return nil, err
+	}
+	p, err := s.Resolve(ref)
+	if err != nil {
+		return nil, err
+	}
+	return p, s.projects.SaveSyncTarget(p.ID, t)
+}
+
+func (s *ProjectService) RemoveSyncTarget(ref, name string) (*domain.Project, error) {
+	p, targets, err := s.SyncTargets(ref)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range targets {
+		if t.Name == name {
+			return p, s.projects.RemoveSyncTarget(p.ID, name)
+		}
+	}
+	return nil, fmt.Errorf("%s has no target named %q", p.Name, name)
+}
+
+func (s *ProjectService) Show(ref string) (*ProjectDetails, error) {
+	p, err := s.Resolve(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	details := &ProjectDetails{Project: *p}
+	if p.Path == "" {
+		return details, nil
+	}
+	details.EnvFile, err = s.envLoader.Load(p.Path)
+	if err != nil {
+		return nil, err
+	}
+	return details, nil
+}
+
+// Stale returns the projects whose location on this machine no longer
+// exists or no longer contains a .env file.
+func (s *ProjectService) Stale() ([]domain.Project, error) {
+	all, err := s.projects.ListAll()
+	if err != nil {
+		return nil, err
+	}
+	var stale []domain.Project
+	for _, p := range all {
+		checkEnv(s.envLoader, &p)
+		if p.Stale() {
+			stale = append(stale, p)
+		}
+	}
+	return stale, nil
+}
+
+// Prune removes stale projects. A project still checked out on another
+// machine only loses this machine's location.
+func (s *ProjectService) Prune(projects []domain.Project) error {
+	for _, p := range projects {
+		var err error
+		if p.OtherDevices > 0 {
+			err = s.projects.RemoveLocation(p.ID)
+		} else {
+			err = s.projects.Delete(p.ID)
+		}
+		if err == nil {
+			err = s.forgetSyncs(p.Path)
+		}
+		if err != nil {
+			return fmt.Errorf("prune %s: %w", p.PortablePath, err)
+		}
+	}
+	return nil
+}
+
+// forgetSyncs drops the ledger's record of what was pushed from dir, a
+// checkout this machine no longer tracks.
+func (s *ProjectService) forgetSyncs(dir string) error {
+	if s.ledger == nil || dir == "" {
+		return nil
+	}
+	targets, err := s.ledger.Targets(dir)
+	if err != nil {
+		return err
+	}
+	for _, target := range targets {
+		entries, err := s.ledger.Entries(dir, target)
+		if err != nil {
+			return err
+		}
+		if err := s.ledger.Forget(dir, target, slices.Collect(maps.Keys(entries))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Relocate searches roots for the new location of each referenced
+// project, or of every stale project when refs is empty. A directory
+// matches when it is the root of a checkout of the same git remote or
+// holds a .env with the same fingerprint.
+func (s *ProjectService) Relocate(refs, roots []string) ([]Relocation, error) {
+	var projects []domain.Project
+	if len(refs) == 0 {
+		stale, err := s.Stale()
+		if err != nil {
+			return nil, err
+		}
+		projects = stale
+	}
+	for _, ref := range refs {
+		p, err := s.Resolve(ref)
+		if err != nil {
+			return nil, err
+		}
+		projects = append(projects, *p)
+	}
+	if len(projects) == 0 {
+		return nil, nil
+	}
+
+	candidates, err := s.relocationCandidates(roots)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]Relocation, 0, len(projects))
+	for _, p := range projects {
+		r := Relocation{Project: p}
+		for _, c := range candidates {
+			if c.dir == p.Path {
+				continue
+			}
+			if (p.RemoteURL != "" && c.remote == p.RemoteURL) || (p.Fingerprint != "" && c.fingerprint == p.Fingerprint) {
+				r.Candidates = append(r.Candidates, c.dir)
+			}
+		}
+		sort.Strings(r.Candidates)
+		if len(r.Candidates) == 1 {
+			dir := r.Candidates[0]
+			if err := s.projects.Relocate(p.ID, dir); errors.Is(err, domain.ErrPathTaken) {
+				r.Taken = true
+				results = append(results, r)
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+			if err := s.projects.SetFingerprint(p.ID, candidates[dir].fingerprint); err != nil {
+				return nil, err
+			}
+			r.NewPath = dir
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+// Discovery is an unregistered directory found by Discover, with the name
+// it would be registered under.
+type Discovery struct {
+	Dir  string
+	Name string
+}
+
+// Discover finds directories below root that contain a .env file and are
+// not yet registered on this machine. It also returns how many of the
+// directories found were already registered.
+func (s *ProjectService) Discover(root string, maxDepth int) ([]Discovery, int, error) {
+	dirs, err := s.scanner.FindEnvDirs(root, maxDepth)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	all, err := s.projects.ListAll()
+	if err != nil {
+		return nil, 0, err
+	}
+	registered := make(map[string]bool, len(all))
+	for _, p := range all {
+		if p.Path != "" {
+			registered[p.Path] = true
+		}
+	}
+
+	var found []Discovery
+	known := 0
+	for _, dir := range dirs {
+		if registered[dir] {
+			known++
+			continue
+		}
+		var gitRoot, remote string
+		if s.repos != nil {
+			gitRoot, _ = s.repos.Root(dir)
+			remote, _ = s.repos.RemoteURL(dir)
+		}
+		found = append(found, Discovery{Dir: dir, Name: domain.DefaultProjectName(dir, gitRoot, remote)})
+	}
+	return found, known, nil
+}
+
+type candidate struct {
+	dir         string
+	remote      string
+	fingerprint string
+}
+
+// relocationCandidates collects the env directories below roots that are
+// not already the location of a registered project.
+func (s *ProjectService) relocationCandidates(roots []string) (map[string]candidate, error) {
+	all, err := s.projects.ListAll()
+	if err != nil {
+		return nil, err
+	}
+	registered := make(map[string]bool, len(all))
+	for _, p := range all {
+		if p.Status == domain.StatusOK {
+			registered[p.Path] = true
+		}
+	}
+
+	candidates := make(map[string]candidate)
+	for _, root := range roots {
+		dirs, err := s.scanner.FindEnvDirs(root, 0)
+		if err != nil {
+			return nil, fmt.Errorf("scan %s: %w", root, err)
+		}
+		for _, dir := range dirs {
+			if registered[dir] {
+				continue
+			}
+			if _, seen := candidates[dir]; seen {
+				continue
+			}
+			c := candidate{dir: dir}
+			if s.repos != nil {
+				// Only a checkout's root stands in for the repository;
+				// subdirectories of a monorepo are matched by fingerprint.
+				if root, _ := s.repos.Root(dir); root == dir {
+					c.remote, _ = s.repos.RemoteURL(dir)
+				}
+			}
+			ef, err := s.envLoader.Load(dir)
+			if err == nil {
+				c.fingerprint = s.hasher.Fingerprint(ef)
+			}
+			candidates[dir] = c
+		}
+	}
+	return candidates, nil
+}
+
+// checkEnv marks a project whose directory exists but holds no .env.
+func checkEnv(loader port.EnvLoader, p *domain.Project) {
+	if p.Status != domain.StatusOK {
+		return
+	}
+	if ef, err := loader.Load(p.Path); err == nil && ef == nil {
+		p.Status = domain.StatusNoEnv
+	}
+}
+
+// Resolve finds a registered project by path first, then by name.
+func (s *ProjectService) Resolve(ref string) (*domain.Project, error) {
+	p, err := s.projects.FindByPath(ref)
+	if err != nil {
+		return nil, err
+	}
+	if p != nil {
+		return p, nil
+	}
+
+	p, err = s.projects.FindByName(ref)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, fmt.Errorf("%w: %s", domain.ErrProjectNotFound, ref)
+	}
+	return p, nil
+}
+
+func (s *ProjectService) checkNameFree(name string, id int) error {
+	other, err := s.projects.FindByName(name)
+	if err != nil {
+		return err
+	}
+	if other != nil && other.ID != id {
+		return fmt.Errorf("name %q is already used by %s", name, other.PortablePath)
+	}
+	return nil
+}
+
+// defaultName derives a name for abs and appends a numeric suffix when
+// another project already uses it.
+func (s *ProjectService) defaultName(abs, root, remote string) (string, error) {
+	base := domain.DefaultProjectName(abs, root, remote)
+
+	name := base
+	for i := 2; ; i++ {
+		other, err := s.projects.FindByName(name)
+		if err != nil {
+			return "", err
+		}
+		// The same repository checked out on another machine keeps its name
+		if other == nil || other.Path == abs || (remote != "" && other.RemoteURL == remote) {
+			return name, nil
+		}
+		name = fmt.Sprintf("%s-%d", base, i)
+	}
+}
@@ -0,0 +1,104 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/stormingluke/autoenv/internal/domain"
+)
+
+// PullResult is what pulling from a source would change in the .env in
+// Dir, the project's root. Values holds everything the source returned.
+type PullResult struct {
+	Target  domain.SyncTarget
+	Dir     string
+	Values  map[string]string
+	Changes []domain.EnvChange
+}
+
+// Pull reads the values stored at target, one of the named targets of the
+// project containing dir or else a target string, and plans merging them
+// into the project's .env against the ledger. Outside a registered
+// project, dir's own .env is used. It changes nothing.
+func (s *SyncService) Pull(ctx context.Context, dir, target string) (*PullResult, error) {
+	nt := domain.NamedSyncTarget{Target: target}
+	p, named, err := s.projectTargets(dir)
+	if err != nil {
+		return nil, err
+	}
+	root := projectRoot(p, dir)
+	for _, n := range named {
+		if n.Name == target {
+			nt = n
+			break
+		}
+	}
+
+	t, err := nt.SyncTarget(s.hosts)
+	if err != nil {
+		return nil, err
+	}
+	// A relative file is relative to the project, wherever pull runs.
+	if t.Provider == domain.ProviderFile && !filepath.IsAbs(t.Repo) {
+		t.Repo = filepath.Join(root, t.Repo)
+	}
+	source, ok := s.sources[t.Provider]
+	if !ok {
+		return nil, fmt.Errorf("cannot pull from %s: %s targets cannot be read back", t, t.Provider)
+	}
+	values, err := source.Fetch(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("%s is empty or does not exist", t)
+	}
+
+	envFile, err := s.envLoader.Load(root)
+	if err != nil {
+		return nil, err
+	}
+	var local map[string]string
+	if envFile != nil {
+		local = envFile.Values
+	}
+	entries, err := s.ledger.Entries(root, t.ID())
+	if err != nil {
+		return nil, err
+	}
+	synced := make(map[string]string, len(entries))
+	for key, e := range entries {
+		synced[key] = e.Hash
+	}
+	return &PullResult{
+		Target:  t,
+		Dir:     root,
+		Values:  values,
+		Changes: domain.PlanPull(s.hasher, local, values, synced),
+	}, nil
+}
+
+// ApplyPull writes the added and updated keys of r into the .env in
+// r.Dir, and the local-only ones too with force, keeping the rest of the
+// file as it is. Every key that then matches the source is recorded in the
+// ledger, so the next pull knows it may update them.
+func (s *SyncService) ApplyPull(r *PullResult, force bool) error {
+	write := make(map[string]string)
+	hashes := make(map[string]string)
+	for _, c := range r.Changes {
+		if c.Kind == domain.ChangeLocalOnly && !force {
+			continue
+		}
+		if c.Kind != domain.ChangeUnchanged {
+			write[c.Key] = r.Values[c.Key]
+		}
+		hashes[c.Key] = s.hasher.Hash(r.Values[c.Key])
+	}
+	if len(write) > 0 {
+		if err := s.writer.Merge(r.Dir, write); err != nil {
+			return err
+		}
+	}
+	return s.ledger.Record(r.Dir, r.Target.ID(), hashes)
+}
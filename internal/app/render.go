@@ -0,0 +1,21 @@
+package app
+
+import (
+	"github.com/stormingluke/autoenv/internal/domain"
+	"github.com/stormingluke/autoenv/internal/port"
+)
+
+type RenderService struct {
+	envLoader port.EnvLoader
+}
+
+func (s *RenderService) Render(projectPath string, formatter port.EnvFormatter) (string, error) {
+	envFile, err := s.envLoader.Load(projectPath)
+	if err != nil {
+		return "", err
+	}
+	if envFile == nil {
+		return "", domain.ErrNoEnvFile
+	}
+	return formatter.Format(envFile.Values)
+}
@@ -1,8 +1,8 @@
 package app
 
 import (
+	"context"
 	"fmt"
-	"strings"
 
 	"github.com/stormingluke/autoenv/internal/domain"
 	"github.com/stormingluke/autoenv/internal/port"
@@ -12,48 +12,421 @@ type SyncService struct {
 	projects  port.ProjectReader
 	envLoader port.EnvLoader
 	syncer    port.SecretSyncer
+	gitlab    port.SecretSyncer
+	vault     port.SecretSyncer
+	sources   map[domain.Provider]port.SecretSource
+	writer    port.EnvWriter
 	config    port.ConfigStore
+	ledger    port.SyncLedger
+	hasher    *domain.Hasher
+	hosts     domain.Hosts
 }
 
-func (s *SyncService) SyncSecrets(projectPath, target string) error {
-	if s.syncer == nil {
-		return fmt.Errorf("secret sync not configured")
+// SyncOptions refine a target string: what kind of value to write, the
+// environment or organization visibility when the target needs one, and
+// GitLab's variable attributes. DryRun only plans the changes; Prune
+// deletes remote keys missing locally; Force pushes every key, ignoring
+// the ledger.
+type SyncOptions struct {
+	Kind        domain.SecretKind
+	Environment string
+	Visibility  domain.Visibility
+	Protected   bool
+	Masked      bool
+	DryRun      bool
+	Prune       bool
+	Force       bool
+}
+
+// SyncResult lists the change for each key under the name it is pushed
+// as, how the project's sync rules mapped local keys, the local keys the
+// rules excluded, and the outcome of each key pushed or deleted.
+type SyncResult struct {
+	Target   domain.SyncTarget
+	Changes  []domain.EnvChange
+	Mappings []domain.KeyMapping
+	Excluded []string
+	Outcomes []domain.KeyResult
+}
+
+// TargetSyncResult is the outcome of syncing one project to one of its
+// named targets. Result is nil when the target could not be resolved.
+type TargetSyncResult struct {
+	Project *domain.Project
+	Name    string
+	Result  *SyncResult
+	Err     error
+}
+
+// SyncSecrets syncs the project containing dir to target: one of the
+// project's named targets, or else a target string. Outside a registered
+// project, dir's own .env is synced.
+func (s *SyncService) SyncSecrets(ctx context.Context, dir, target string, opts SyncOptions) (*SyncResult, error) {
+	p, named, err := s.projectTargets(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, nt := range named {
+		if nt.Name == target {
+			return s.syncNamed(ctx, p, nt, opts)
+		}
 	}
 
-	repo, err := s.resolveTarget(target)
+	t, syncer, err := s.resolveTarget(withOptions(domain.NamedSyncTarget{Target: target}, opts))
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return s.syncTo(ctx, syncer, p, projectRoot(p, dir), t, opts)
+}
 
-	envFile, err := s.envLoader.Load(projectPath)
+// SyncProject syncs the project at projectPath to each of its named
+// targets, or only those in names when given.
+func (s *SyncService) SyncProject(ctx context.Context, projectPath string, names []string, opts SyncOptions) ([]TargetSyncResult, error) {
+	p, named, err := s.projectTargets(projectPath)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if envFile == nil {
-		return domain.ErrNoEnvFile
+	if p == nil {
+		return nil, fmt.Errorf("%s is not a registered project; pass a target or run: autoenv project add", projectPath)
+	}
+	named = s.filterTargets(named, names)
+	if len(named) == 0 {
+		return nil, fmt.Errorf("no sync targets for %s; add one with: autoenv target add <name> <target>", p.Name)
 	}
+	return s.syncAll(ctx, p, named, opts), nil
+}
 
-	return s.syncer.Sync(repo, envFile.Values)
+// SyncAllProjects syncs every registered project checked out on this
+// machine to its named targets, or only those in names when given.
+func (s *SyncService) SyncAllProjects(ctx context.Context, names []string, opts SyncOptions) ([]TargetSyncResult, error) {
+	projects, err := s.projects.ListAll()
+	if err != nil {
+		return nil, err
+	}
+	var results []TargetSyncResult
+	for i := range projects {
+		p := &projects[i]
+		if p.Path == "" {
+			continue
+		}
+		named, err := s.projects.SyncTargets(p.ID)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, s.syncAll(ctx, p, s.filterTargets(named, names), opts)...)
+		if ctx.Err() != nil {
+			return results, ctx.Err()
+		}
+	}
+	return results, nil
 }
 
-func (s *SyncService) resolveTarget(target string) (string, error) {
-	// Strip github.com/ prefix if present
-	target = strings.TrimPrefix(target, "github.com/")
+func (s *SyncService) syncAll(ctx context.Context, p *domain.Project, named []domain.NamedSyncTarget, opts SyncOptions) []TargetSyncResult {
+	results := make([]TargetSyncResult, 0, len(named))
+	for _, nt := range named {
+		if ctx.Err() != nil {
+			break
+		}
+		r, err := s.syncNamed(ctx, p, nt, opts)
+		results = append(results, TargetSyncResult{Project: p, Name: nt.Name, Result: r, Err: err})
+	}
+	return results
+}
 
-	// If target already contains a slash, it's owner/repo
-	if strings.Contains(target, "/") {
-		return target, nil
+func (s *SyncService) syncNamed(ctx context.Context, p *domain.Project, nt domain.NamedSyncTarget, opts SyncOptions) (*SyncResult, error) {
+	if p.Path == "" {
+		return nil, fmt.Errorf("%s is not checked out on this machine", p.Name)
 	}
+	t, syncer, err := s.resolveTarget(withOptions(nt, opts))
+	if err != nil {
+		return nil, err
+	}
+	return s.syncTo(ctx, syncer, p, p.Path, t, opts)
+}
 
-	// Bare repo name — prepend default owner
-	if s.config == nil {
-		return "", fmt.Errorf("no default owner configured; use full path (e.g., github.com/owner/repo) or run: autoenv configure set github.default_owner <owner>")
+// projectRoot is the directory whose .env, sync rules and ledger entries
+// a command run in dir works with: the root of the registered project p
+// containing it, or dir itself when there is none.
+func projectRoot(p *domain.Project, dir string) string {
+	if p != nil && p.Path != "" {
+		return p.Path
+	}
+	return dir
+}
+
+// projectTargets returns the registered project containing dir, if any,
+// and its named targets.
+func (s *SyncService) projectTargets(dir string) (*domain.Project, []domain.NamedSyncTarget, error) {
+	p, err := s.matchProject(dir)
+	if err != nil || p == nil {
+		return nil, nil, err
+	}
+	named, err := s.projects.SyncTargets(p.ID)
+	return p, named, err
+}
+
+// matchProject returns the registered project containing dir, or nil.
+func (s *SyncService) matchProject(dir string) (*domain.Project, error) {
+	if s.projects == nil {
+		return nil, nil
+	}
+	return s.projects.MatchCurrent(dir)
+}
+
+// withOptions overrides a named target's saved settings with the ones
+// given on the command line.
+func withOptions(nt domain.NamedSyncTarget, opts SyncOptions) domain.NamedSyncTarget {
+	if opts.Kind != "" {
+		nt.Kind = opts.Kind
+	}
+	if opts.Environment != "" {
+		nt.Environment = opts.Environment
+	}
+	if opts.Visibility != "" {
+		nt.Visibility = opts.Visibility
+	}
+	nt.Protected = nt.Protected || opts.Protected
+	nt.Masked = nt.Masked || opts.Masked
+	return nt
+}
+
+// filterTargets keeps the targets in names or, when none are given, every
+// target that can be synced to.
+func (s *SyncService) filterTargets(named []domain.NamedSyncTarget, names []string) []domain.NamedSyncTarget {
+	var out []domain.NamedSyncTarget
+	for _, nt := range named {
+		if len(names) == 0 {
+			if t, err := nt.SyncTarget(s.hosts); err != nil || !t.PullOnly() {
+				out = append(out, nt)
+			}
+			continue
+		}
+		for _, name := range names {
+			if nt.Name == name {
+				out = append(out, nt)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// syncTo pushes the keys of the .env in root, the root of project p if
+// it is registered, that were added or changed since the last push to t,
+// and with Prune deletes remote keys that are no longer in the file.
+func (s *SyncService) syncTo(ctx context.Context, syncer port.SecretSyncer, p *domain.Project, root string, t domain.SyncTarget, opts SyncOptions) (*SyncResult, error) {
+	values, mappings, excluded, err := s.syncValues(p, root)
+	if err != nil {
+		return nil, err
+	}
+
+	remote, err := syncer.List(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	pushed := make(map[string]string)
+	if !opts.Force {
+		entries, err := s.ledger.Entries(root, t.ID())
+		if err != nil {
+			return nil, err
+		}
+		for key, e := range entries {
+			pushed[key] = e.Hash
+		}
+	}
+	result := &SyncResult{
+		Target:   t,
+		Changes:  domain.PlanSync(s.hasher, values, remote, pushed, opts.Prune),
+		Mappings: mappings,
+		Excluded: excluded,
 	}
+	if opts.DryRun {
+		return result, nil
+	}
+
+	push := make(map[string]string)
+	hashes := make(map[string]string)
+	var deletes []string
+	for _, c := range result.Changes {
+		switch c.Kind {
+		case domain.ChangeAdded, domain.ChangeUpdated:
+			push[c.Key] = values[c.Key]
+			hashes[c.Key] = s.hasher.Hash(push[c.Key])
+		case domain.ChangeDeleted:
+			deletes = append(deletes, c.Key)
+		}
+	}
+
+	// Only keys that made it are recorded, so running the sync again
+	// retries the ones that failed or were skipped.
+	if len(push) > 0 {
+		outcomes, err := syncer.Sync(ctx, t, push)
+		result.Outcomes = append(result.Outcomes, outcomes...)
+		if rerr := s.ledger.Record(root, t.ID(), succeeded(outcomes, hashes)); rerr != nil {
+			return result, rerr
+		}
+		if err != nil {
+			result.Outcomes = append(result.Outcomes, skipped(deletes)...)
+			return result, err
+		}
+	}
+	if len(deletes) > 0 {
+		outcomes, err := syncer.Delete(ctx, t, deletes)
+		result.Outcomes = append(result.Outcomes, outcomes...)
+		var gone []string
+		for _, o := range outcomes {
+			if o.Outcome == domain.KeyOK {
+				gone = append(gone, o.Key)
+			}
+		}
+		if rerr := s.ledger.Forget(root, t.ID(), gone); rerr != nil {
+			return result, rerr
+		}
+		if err != nil {
+			return result, err
+		}
+	}
+	if failed := domain.CountOutcomes(result.Outcomes, domain.KeyFailed); failed > 0 {
+		return result, fmt.Errorf("%d of %d key(s) failed", failed, len(result.Outcomes))
+	}
+	return result, nil
+}
+
+// succeeded returns the hashes of the keys pushed successfully.
+func succeeded(outcomes []domain.KeyResult, hashes map[string]string) map[string]string {
+	ok := make(map[string]string, len(outcomes))
+	for _, o := range outcomes {
+		if o.Outcome == domain.KeyOK {
+			ok[o.Key] = hashes[o.Key]
+		}
+	}
+	return ok
+}
 
-	owner, err := s.config.Get("github.default_owner")
+func skipped(keys []string) []domain.KeyResult {
+	results := make([]domain.KeyResult, len(keys))
+	for i, key := range keys {
+		results[i] = domain.KeyResult{Key: key, Outcome: domain.KeySkipped}
+	}
+	return results
+}
+
+// SyncTargetStatus compares the current .env with what the ledger says
+// was last pushed to one target.
+type SyncTargetStatus struct {
+	Target   string
+	Changes  []domain.EnvChange
+	LastPush string
+}
+
+// OutOfDate reports whether a sync would push anything.
+func (s SyncTargetStatus) OutOfDate() bool {
+	return domain.CountChanges(s.Changes, domain.ChangeAdded)+domain.CountChanges(s.Changes, domain.ChangeUpdated) > 0
+}
+
+// Status reports every target the project containing dir has been synced
+// to. It works from the local ledger only and does not contact the
+// targets.
+func (s *SyncService) Status(dir string) ([]SyncTargetStatus, error) {
+	p, err := s.matchProject(dir)
 	if err != nil {
-		return "", fmt.Errorf("no default owner configured; run: autoenv configure set github.default_owner <owner>")
+		return nil, err
+	}
+	root := projectRoot(p, dir)
+	values, _, _, err := s.syncValues(p, root)
+	if err != nil {
+		return nil, err
 	}
 
-	return owner + "/" + target, nil
+	targets, err := s.ledger.Targets(root)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]SyncTargetStatus, 0, len(targets))
+	for _, target := range targets {
+		entries, err := s.ledger.Entries(root, target)
+		if err != nil {
+			return nil, err
+		}
+		st := SyncTargetStatus{Target: target}
+		keys := make([]string, 0, len(entries))
+		pushed := make(map[string]string, len(entries))
+		for key, e := range entries {
+			keys = append(keys, key)
+			pushed[key] = e.Hash
+			if e.PushedAt > st.LastPush {
+				st.LastPush = e.PushedAt
+			}
+		}
+		st.Changes = domain.PlanSync(s.hasher, values, keys, pushed, false)
+		statuses = append(statuses, st)
+	}
+	return statuses, nil
+}
+
+// syncValues loads the .env in root and applies the sync rules of p, the
+// registered project at root, if any.
+func (s *SyncService) syncValues(p *domain.Project, root string) (map[string]string, []domain.KeyMapping, []string, error) {
+	envFile, err := s.envLoader.Load(root)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if envFile == nil {
+		return nil, nil, nil, fmt.Errorf("%w in %s", domain.ErrNoEnvFile, root)
+	}
+
+	var rules domain.SyncRules
+	if p != nil {
+		if rules, err = s.projects.SyncRules(p.ID); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	return rules.Apply(envFile.Values)
+}
+
+// resolveTarget turns a target into where to sync and the syncer for its
+// provider, filling in the default owner of a bare GitHub repository.
+func (s *SyncService) resolveTarget(nt domain.NamedSyncTarget) (domain.SyncTarget, port.SecretSyncer, error) {
+	t, err := nt.SyncTarget(s.hosts)
+	if err != nil {
+		return t, nil, err
+	}
+
+	if t.PullOnly() {
+		return t, nil, fmt.Errorf("cannot sync to %s: %s targets can only be pulled from", t, t.Provider)
+	}
+	if t.Provider == domain.ProviderVault {
+		if s.vault == nil {
+			return t, nil, fmt.Errorf("Vault sync not configured")
+		}
+		return t, s.vault, nil
+	}
+	if t.Provider == domain.ProviderGitLab {
+		if s.gitlab == nil {
+			return t, nil, fmt.Errorf("GitLab sync not configured")
+		}
+		if t.Host != s.hosts.GitLab {
+			return t, nil, fmt.Errorf("%s is not the configured GitLab instance (%s); set AUTOENV_GITLAB_URL=https://%s to sync to it", t.Host, s.hosts.GitLab, t.Host)
+		}
+		return t, s.gitlab, nil
+	}
+
+	if s.syncer == nil {
+		return t, nil, fmt.Errorf("secret sync not configured")
+	}
+	if t.Host != s.hosts.GitHub {
+		return t, nil, fmt.Errorf("%s is not the configured GitHub instance (%s); set AUTOENV_GITHUB_API_URL to its API URL to sync to it", t.Host, s.hosts.GitHub)
+	}
+	// Bare repo name — prepend default owner
+	if t.Owner == "" {
+		if s.config == nil {
+			return t, nil, fmt.Errorf("no default owner configured; use full path (e.g., github.com/owner/repo) or run: autoenv configure set github.default_owner <owner>")
+		}
+		owner, err := s.config.Get("github.default_owner")
+		if err != nil {
+			return t, nil, fmt.Errorf("no default owner configured; run: autoenv configure set github.default_owner <owner>")
+		}
+		t.Owner = owner
+	}
+	return t, s.syncer, nil
 }
@@ -0,0 +1,30 @@
+package domain
+
+import "fmt"
+
+// AutoloadModeKey is the ConfigStore key selecting which directories the
+// shell hook loads .env files from.
+const AutoloadModeKey = "autoload.mode"
+
+type AutoloadMode string
+
+const (
+	// AutoloadRegistered loads .env only inside registered projects.
+	AutoloadRegistered AutoloadMode = "registered"
+	// AutoloadAny loads .env from any directory that has one.
+	AutoloadAny AutoloadMode = "any"
+	// AutoloadOff disables loading; active sessions are unset.
+	AutoloadOff AutoloadMode = "off"
+)
+
+// DefaultAutoloadMode keeps the historical behavior of loading any .env.
+const DefaultAutoloadMode = AutoloadAny
+
+func ParseAutoloadMode(s string) (AutoloadMode, error) {
+	switch m := AutoloadMode(s); m {
+	case AutoloadRegistered, AutoloadAny, AutoloadOff:
+		return m, nil
+	default:
+		return "", fmt.Errorf("invalid %s %q (valid: registered, any, off)", AutoloadModeKey, s)
+	}
+}
@@ -0,0 +1,145 @@
+package domain
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type ChangeKind string
+
+const (
+	ChangeAdded     ChangeKind = "added"
+	ChangeUpdated   ChangeKind = "updated"
+	ChangeUnchanged ChangeKind = "unchanged"
+	// ChangeDeleted and ChangeRemoteOnly describe keys that exist on a
+	// sync target but not locally, with and without --prune.
+	ChangeDeleted    ChangeKind = "deleted"
+	ChangeRemoteOnly ChangeKind = "remote-only"
+	// ChangeLocalOnly describes a key a pull would overwrite whose local
+	// value did not come from the source.
+	ChangeLocalOnly ChangeKind = "local-only"
+)
+
+// EnvChange is the change to one key. Old and New hold the values when
+// both sides are known, as for an import or pull; print them through
+// MaskValue.
+type EnvChange struct {
+	Key  string
+	Kind ChangeKind
+	Old  string
+	New  string
+}
+
+// CompareEnv reports, per incoming key, whether merging incoming into
+// current would add, overwrite or leave the key untouched.
+func CompareEnv(current, incoming map[string]string) []EnvChange {
+	changes := make([]EnvChange, 0, len(incoming))
+	for key, value := range incoming {
+		old, exists := current[key]
+		c := EnvChange{Key: key, Kind: ChangeUnchanged, Old: old, New: value}
+		switch {
+		case !exists:
+			c.Kind = ChangeAdded
+		case old != value:
+			c.Kind = ChangeUpdated
+		}
+		changes = append(changes, c)
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	return changes
+}
+
+// PlanSync compares local values with the keys present on a sync target.
+// A key is unchanged when the hash of its value matches pushed, the hash
+// last written there; values themselves are never read back. Remote keys
+// missing locally are deleted when prune is set. Names match ignoring case
+// when there is no exact match, as some targets upper-case them.
+func PlanSync(h *Hasher, local map[string]string, remote []string, pushed map[string]string, prune bool) []EnvChange {
+	remaining := make(map[string]bool, len(remote))
+	for _, name := range remote {
+		remaining[name] = true
+	}
+	match := func(key string) bool {
+		if remaining[key] {
+			delete(remaining, key)
+			return true
+		}
+		for name := range remaining {
+			if strings.EqualFold(name, key) {
+				delete(remaining, name)
+				return true
+			}
+		}
+		return false
+	}
+
+	changes := make([]EnvChange, 0, len(local)+len(remote))
+	for key, value := range local {
+		switch {
+		case !match(key):
+			changes = append(changes, EnvChange{Key: key, Kind: ChangeAdded})
+		case pushed[key] != "" && h.Matches(pushed[key], value):
+			changes = append(changes, EnvChange{Key: key, Kind: ChangeUnchanged})
+		default:
+			changes = append(changes, EnvChange{Key: key, Kind: ChangeUpdated})
+		}
+	}
+	for name := range remaining {
+		kind := ChangeRemoteOnly
+		if prune {
+			kind = ChangeDeleted
+		}
+		changes = append(changes, EnvChange{Key: name, Kind: kind})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	return changes
+}
+
+// PlanPull compares values fetched from a source with the local ones. A
+// key whose local value differs is updated only when that value is the one
+// last synced with the source, per the hashes in synced; otherwise it was
+// set or edited locally and is local-only. Local keys the source lacks are
+// left out, as a pull never removes them.
+func PlanPull(h *Hasher, local, remote, synced map[string]string) []EnvChange {
+	changes := make([]EnvChange, 0, len(remote))
+	for key, value := range remote {
+		old, exists := local[key]
+		c := EnvChange{Key: key, Kind: ChangeLocalOnly, Old: old, New: value}
+		switch {
+		case !exists:
+			c.Kind = ChangeAdded
+		case old == value:
+			c.Kind = ChangeUnchanged
+		case synced[key] != "" && h.Matches(synced[key], old):
+			c.Kind = ChangeUpdated
+		}
+		changes = append(changes, c)
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	return changes
+}
+
+// MaskValue hides a value for display while keeping changes
+// recognisable: long values show their first characters and length.
+func MaskValue(value string) string {
+	runes := []rune(value)
+	switch {
+	case len(runes) == 0:
+		return `""`
+	case len(runes) < 12:
+		return "****"
+	default:
+		return fmt.Sprintf("%s**** (%d chars)", string(runes[:3]), len(runes))
+	}
+}
+
+func CountChanges(changes []EnvChange, kind ChangeKind) int {
+	n := 0
+	for _, c := range changes {
+		if c.Kind == kind {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,77 @@
+package domain
+
+import (
+	"slices"
+	"testing"
+)
+
+// kinds renders changes as key:kind pairs for comparison.
+func kinds(changes []EnvChange) []string {
+	out := make([]string, len(changes))
+	for i, c := range changes {
+		out[i] = c.Key + ":" + string(c.Kind)
+	}
+	return out
+}
+
+func TestPlanSync(t *testing.T) {
+	h := NewHasher([]byte("install key"))
+	local := map[string]string{"ADDED": "1", "SAME": "2", "EDITED": "3", "UNKNOWN": "4", "lower": "5"}
+	remote := []string{"SAME", "EDITED", "UNKNOWN", "LOWER", "GONE"}
+	pushed := map[string]string{"SAME": h.Hash("2"), "EDITED": h.Hash("old"), "lower": h.Hash("5")}
+
+	tests := []struct {
+		prune bool
+		want  []string
+	}{
+		{false, []string{"ADDED:added", "EDITED:updated", "GONE:remote-only", "SAME:unchanged", "UNKNOWN:updated", "lower:unchanged"}},
+		{true, []string{"ADDED:added", "EDITED:updated", "GONE:deleted", "SAME:unchanged", "UNKNOWN:updated", "lower:unchanged"}},
+	}
+	for _, tt := range tests {
+		got := kinds(PlanSync(h, local, remote, pushed, tt.prune))
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("prune=%v:\n got %v\nwant %v", tt.prune, got, tt.want)
+		}
+	}
+}
+
+// A legacy hash in the ledger still recognises an unchanged value.
+func TestPlanSyncAcceptsLegacyHashes(t *testing.T) {
+	h := NewHasher([]byte("install key"))
+	got := kinds(PlanSync(h, map[string]string{"A": "secret"}, []string{"A"}, map[string]string{"A": legacyHash("secret")}, false))
+	if want := []string{"A:unchanged"}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestPlanPull(t *testing.T) {
+	h := NewHasher([]byte("install key"))
+	local := map[string]string{"SAME": "1", "SYNCED": "old", "EDITED": "mine", "NEVER_SYNCED": "mine", "LOCAL_ONLY": "x"}
+	remote := map[string]string{"NEW": "n", "SAME": "1", "SYNCED": "new", "EDITED": "theirs", "NEVER_SYNCED": "theirs"}
+	synced := map[string]string{"SAME": h.Hash("1"), "SYNCED": h.Hash("old"), "EDITED": h.Hash("before")}
+
+	changes := PlanPull(h, local, remote, synced)
+	want := []string{"EDITED:local-only", "NEVER_SYNCED:local-only", "NEW:added", "SAME:unchanged", "SYNCED:updated"}
+	if got := kinds(changes); !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for _, c := range changes {
+		if c.Old != local[c.Key] || c.New != remote[c.Key] {
+			t.Errorf("%s: %q -> %q, want %q -> %q", c.Key, c.Old, c.New, local[c.Key], remote[c.Key])
+		}
+	}
+}
+
+func TestMaskValue(t *testing.T) {
+	tests := map[string]string{
+		"":                        `""`,
+		"short":                   "****",
+		"sk_live_1234567890":      "sk_**** (18 chars)",
+		"ünïcödé-välüé-lông-ênôù": "ünï**** (23 chars)",
+	}
+	for value, want := range tests {
+		if got := MaskValue(value); got != want {
+			t.Errorf("MaskValue(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
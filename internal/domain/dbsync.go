@@ -0,0 +1,44 @@
+package domain
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// SyncIntervalKey is the ConfigStore key holding how often full commands
+// pull from Turso. Empty or zero disables automatic syncing.
+const SyncIntervalKey = "sync.interval"
+
+// ParseSyncInterval accepts a Go duration ("30m", "2h") or a plain number
+// of minutes.
+func ParseSyncInterval(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	if minutes, err := strconv.Atoi(s); err == nil && minutes >= 0 {
+		return time.Duration(minutes) * time.Minute, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid %s %q (use minutes or a duration such as 30m)", SyncIntervalKey, s)
+	}
+	return d, nil
+}
+
+// Replication is what a database sync applied.
+type Replication struct {
+	FrameNo      int
+	FramesSynced int
+}
+
+// DBSyncRecord is one attempt to sync the project registry with Turso.
+type DBSyncRecord struct {
+	At string
+	Replication
+	Error string
+}
+
+func (r *DBSyncRecord) OK() bool {
+	return r.Error == ""
+}
@@ -1,10 +1,5 @@
 package domain
 
-import (
-	"crypto/sha256"
-	"fmt"
-)
-
 type EnvFile struct {
 	Path   string
 	Mtime  int64
@@ -16,23 +11,7 @@ type DiffResult struct {
 	Unset  []string
 }
 
-func HashValue(value string) string {
-	h := sha256.Sum256([]byte(value))
-	return fmt.Sprintf("%x", h[:8])
-}
-
-func KeyHashes(ef *EnvFile) map[string]string {
-	if ef == nil {
-		return nil
-	}
-	hashes := make(map[string]string, len(ef.Values))
-	for k, v := range ef.Values {
-		hashes[k] = HashValue(v)
-	}
-	return hashes
-}
-
-func Diff(envFile *EnvFile, loadedKeys []SessionKey) DiffResult {
+func Diff(h *Hasher, envFile *EnvFile, loadedKeys []SessionKey) DiffResult {
 	result := DiffResult{Export: make(map[string]string)}
 
 	if envFile == nil {
@@ -48,8 +27,7 @@ func Diff(envFile *EnvFile, loadedKeys []SessionKey) DiffResult {
 	}
 
 	for key, value := range envFile.Values {
-		newHash := HashValue(value)
-		if oldHash, exists := loadedMap[key]; !exists || oldHash != newHash {
+		if oldHash, exists := loadedMap[key]; !exists || !h.Matches(oldHash, value) {
 			result.Export[key] = value
 		}
 	}
@@ -6,6 +6,8 @@ var (
 	ErrProjectNotFound = errors.New("project not found")
 	ErrSessionNotFound = errors.New("session not found")
 	ErrNoEnvFile       = errors.New("no .env file found")
+	ErrSyncDisabled    = errors.New("turso cloud sync not configured")
+	ErrPathTaken       = errors.New("another project is registered at this path")
 )
 
 type DefaultSetting struct {
@@ -0,0 +1,82 @@
+package domain
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// hashPrefix marks HMAC-SHA256 hashes. Hashes without it were written by
+// older versions as a truncated, unkeyed SHA-256.
+const hashPrefix = "h1:"
+
+// Hasher fingerprints secret values with a per-install key, so the hashes
+// stored in the sessions database cannot be brute-forced on their own.
+type Hasher struct {
+	key []byte
+}
+
+func NewHasher(key []byte) *Hasher {
+	return &Hasher{key: key}
+}
+
+func (h *Hasher) Hash(value string) string {
+	mac := hmac.New(sha256.New, h.key)
+	mac.Write([]byte(value))
+	return hashPrefix + hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// Matches reports whether hash was computed from value, accepting hashes
+// in the legacy format.
+func (h *Hasher) Matches(hash, value string) bool {
+	want := h.Hash(value)
+	if !strings.HasPrefix(hash, hashPrefix) {
+		want = legacyHash(value)
+	}
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(want)) == 1
+}
+
+func (h *Hasher) KeyHashes(ef *EnvFile) map[string]string {
+	if ef == nil {
+		return nil
+	}
+	hashes := make(map[string]string, len(ef.Values))
+	for k, v := range ef.Values {
+		hashes[k] = h.Hash(v)
+	}
+	return hashes
+}
+
+// Fingerprint summarises an env file's keys and value hashes, so a
+// project can be recognised after its directory has moved.
+func (h *Hasher) Fingerprint(ef *EnvFile) string {
+	hashes := h.KeyHashes(ef)
+	if len(hashes) == 0 {
+		return ""
+	}
+	lines := make([]string, 0, len(hashes))
+	for k, v := range hashes {
+		lines = append(lines, k+"="+v)
+	}
+	sort.Strings(lines)
+	return h.Hash(strings.Join(lines, "\n"))
+}
+
+// NeedsRehash reports whether any loaded key still carries a legacy hash.
+func NeedsRehash(keys []SessionKey) bool {
+	for _, k := range keys {
+		if !strings.HasPrefix(k.KeyHash, hashPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func legacyHash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return fmt.Sprintf("%x", sum[:8])
+}
@@ -0,0 +1,75 @@
+package domain
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestHasherMatches(t *testing.T) {
+	h := NewHasher([]byte("install key"))
+	other := NewHasher([]byte("another key"))
+	legacy := fmt.Sprintf("%x", sha256.Sum256([]byte("secret")))[:16]
+
+	tests := []struct {
+		name  string
+		hash  string
+		value string
+		want  bool
+	}{
+		{"own hash", h.Hash("secret"), "secret", true},
+		{"other value", h.Hash("secret"), "secret2", false},
+		{"other install's key", other.Hash("secret"), "secret", false},
+		{"legacy hash", legacy, "secret", true},
+		{"legacy hash of another value", legacy, "other", false},
+		{"legacy-looking hash with the prefix", hashPrefix + legacy, "secret", false},
+		{"empty hash", "", "", false},
+	}
+	for _, tt := range tests {
+		if got := h.Matches(tt.hash, tt.value); got != tt.want {
+			t.Errorf("%s: Matches(%q, %q) = %v, want %v", tt.name, tt.hash, tt.value, got, tt.want)
+		}
+	}
+
+	if hash := h.Hash("secret"); !strings.HasPrefix(hash, hashPrefix) || len(hash) != len(hashPrefix)+32 {
+		t.Errorf("Hash = %q, want %s and 32 hex digits", hash, hashPrefix)
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	h := NewHasher([]byte("install key"))
+	current := SessionKey{KeyName: "A", KeyHash: h.Hash("1")}
+	legacy := SessionKey{KeyName: "B", KeyHash: "0123456789abcdef"}
+
+	tests := []struct {
+		keys []SessionKey
+		want bool
+	}{
+		{nil, false},
+		{[]SessionKey{current}, false},
+		{[]SessionKey{current, legacy}, true},
+		{[]SessionKey{legacy}, true},
+	}
+	for _, tt := range tests {
+		if got := NeedsRehash(tt.keys); got != tt.want {
+			t.Errorf("NeedsRehash(%v) = %v, want %v", tt.keys, got, tt.want)
+		}
+	}
+}
+
+// A fingerprint depends on keys and values but not on their order, and
+// is empty for a missing or empty file.
+func TestFingerprint(t *testing.T) {
+	h := NewHasher([]byte("install key"))
+	a := h.Fingerprint(&EnvFile{Values: map[string]string{"A": "1", "B": "2"}})
+	if a == "" || a != h.Fingerprint(&EnvFile{Values: map[string]string{"B": "2", "A": "1"}}) {
+		t.Errorf("fingerprint %q is not stable", a)
+	}
+	if a == h.Fingerprint(&EnvFile{Values: map[string]string{"A": "1", "B": "3"}}) {
+		t.Error("fingerprint ignores values")
+	}
+	if h.Fingerprint(nil) != "" || h.Fingerprint(&EnvFile{}) != "" {
+		t.Error("empty files have a fingerprint")
+	}
+}
@@ -1,8 +1,87 @@
 package domain
 
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
 type Project struct {
-	ID        int
-	Path      string
-	Name      string
-	CreatedAt string
+	ID int
+	// Path is where the project lives on this machine, or "" when it is
+	// not checked out here.
+	Path string
+	// PortablePath is the machine-independent form stored in the synced
+	// registry, e.g. "~/code/api" or "$CODE_ROOT/api".
+	PortablePath string
+	Name         string
+	Description  string
+	Tags         []string
+	RemoteURL    string
+	CreatedAt    string
+	LastUsedAt   string
+	Status       ProjectStatus
+	// Fingerprint identifies the .env last seen at Path on this machine.
+	Fingerprint string
+	// OtherDevices counts other machines with a recorded location.
+	OtherDevices int
+}
+
+type ProjectStatus string
+
+const (
+	StatusOK            ProjectStatus = "ok"
+	StatusMissing       ProjectStatus = "missing"
+	StatusNoEnv         ProjectStatus = "no-env"
+	StatusNotCheckedOut ProjectStatus = "not-checked-out"
+)
+
+// Stale reports whether the project's recorded location on this machine
+// no longer exists or no longer holds an env file.
+func (p *Project) Stale() bool {
+	return p.Status == StatusMissing || p.Status == StatusNoEnv
+}
+
+func (p *Project) HasTag(tag string) bool {
+	for _, t := range p.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateTag rejects tags that would be ambiguous on the command line or
+// in comma-separated output.
+func ValidateTag(tag string) error {
+	if tag == "" || strings.ContainsAny(tag, ", \t\n") {
+		return fmt.Errorf("invalid tag %q: tags must be non-empty and contain no commas or whitespace", tag)
+	}
+	return nil
+}
+
+// RepoName extracts the repository name from a git remote URL, e.g.
+// "git@github.com:org/api.git" and "https://github.com/org/api" both give
+// "api". It returns "" when the URL has no usable path.
+func RepoName(remoteURL string) string {
+	u := strings.TrimSuffix(strings.TrimRight(remoteURL, "/"), ".git")
+	if i := strings.LastIndexAny(u, "/:"); i >= 0 {
+		u = u[i+1:]
+	}
+	if u == "." {
+		return ""
+	}
+	return u
+}
+
+// DefaultProjectName picks a name for a project directory. A directory at
+// the root of a git working tree is named after the repository in its
+// remote URL; anything else is named after the directory itself.
+func DefaultProjectName(dir, gitRoot, remoteURL string) string {
+	if gitRoot == dir {
+		if name := RepoName(remoteURL); name != "" {
+			return name
+		}
+	}
+	return filepath.Base(dir)
 }
@@ -0,0 +1,119 @@
+package domain
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// PathRootsKey is the ConfigStore key listing the roots project paths are
+// stored relative to, as a comma-separated list such as "$CODE_ROOT,~".
+const PathRootsKey = "paths.roots"
+
+const DefaultPathRoots = "$CODE_ROOT,~"
+
+// PathRoot maps a portable prefix such as "~" or "$CODE_ROOT" to the
+// directory it stands for on this machine.
+type PathRoot struct {
+	Name string
+	Dir  string
+}
+
+// PathRoots converts between absolute paths on this machine and the
+// portable form stored in the synced registry.
+type PathRoots []PathRoot
+
+// ParsePathRoots resolves a roots spec using the given environment lookup
+// and home directory. Roots that are not set on this machine are dropped.
+func ParsePathRoots(spec string, getenv func(string) string, home string) PathRoots {
+	var roots PathRoots
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		var dir string
+		switch {
+		case name == "~":
+			dir = home
+		case strings.HasPrefix(name, "$") && len(name) > 1:
+			dir = getenv(name[1:])
+		default:
+			continue
+		}
+		if dir == "" || !filepath.IsAbs(dir) {
+			continue
+		}
+		roots = append(roots, PathRoot{Name: name, Dir: filepath.Clean(dir)})
+	}
+	return roots
+}
+
+// Portable rewrites abs relative to the most specific root containing it,
+// e.g. "/home/me/code/api" becomes "$CODE_ROOT/api". Paths outside every
+// root are returned unchanged.
+func (r PathRoots) Portable(abs string) string {
+	best := -1
+	bestRel := ""
+	for i, root := range r {
+		rel, err := filepath.Rel(root.Dir, abs)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if best < 0 || len(root.Dir) > len(r[best].Dir) {
+			best, bestRel = i, rel
+		}
+	}
+	if best < 0 {
+		return abs
+	}
+	if bestRel == "." {
+		return r[best].Name
+	}
+	return r[best].Name + "/" + filepath.ToSlash(bestRel)
+}
+
+// Resolve turns a portable path back into an absolute path on this
+// machine. It returns "" when the path uses a root this machine lacks.
+func (r PathRoots) Resolve(portable string) string {
+	if filepath.IsAbs(portable) {
+		return portable
+	}
+	name, rest, _ := strings.Cut(portable, "/")
+	for _, root := range r {
+		if root.Name == name {
+			return filepath.Join(root.Dir, filepath.FromSlash(rest))
+		}
+	}
+	return ""
+}
+
+// Forms lists every way abs may be stored in the registry: relative to
+// each root containing it, and as the absolute path older versions kept.
+func (r PathRoots) Forms(abs string) []string {
+	forms := []string{abs}
+	for _, root := range r {
+		rel, err := filepath.Rel(root.Dir, abs)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if rel == "." {
+			forms = append(forms, root.Name)
+		} else {
+			forms = append(forms, root.Name+"/"+filepath.ToSlash(rel))
+		}
+	}
+	return forms
+}
+
+// Ancestors returns abs followed by each of its parent directories up to
+// the filesystem root.
+func Ancestors(abs string) []string {
+	dirs := []string{abs}
+	for dir := filepath.Dir(abs); dir != dirs[len(dirs)-1]; dir = filepath.Dir(dir) {
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
+
+// Within reports whether path is dir or lies below it.
+func Within(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -1,9 +1,13 @@
 package domain
 
+// Session is what a shell has loaded. Pulled is set once `pull --session`
+// has added values of its own, which stay while the shell is in
+// ProjectPath even if it has no .env.
 type Session struct {
 	ShellPID     int
 	ProjectPath  string
 	EnvFileMtime int64
+	Pulled       bool
 	LoadedAt     string
 }
 
@@ -0,0 +1,98 @@
+package domain
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// SyncRules decide which .env keys a project pushes and under what names.
+// A key is pushed when it matches an Include glob (or there are none) and
+// no Exclude glob. An explicit Rename wins; otherwise StripPrefix is
+// removed and AddPrefix prepended.
+type SyncRules struct {
+	Include     []string          `json:"include,omitempty"`
+	Exclude     []string          `json:"exclude,omitempty"`
+	StripPrefix string            `json:"strip_prefix,omitempty"`
+	AddPrefix   string            `json:"add_prefix,omitempty"`
+	Rename      map[string]string `json:"rename,omitempty"`
+}
+
+// KeyMapping pairs a local key with the name it is pushed as.
+type KeyMapping struct {
+	Local  string
+	Remote string
+}
+
+func (r SyncRules) IsZero() bool {
+	return len(r.Include) == 0 && len(r.Exclude) == 0 && r.StripPrefix == "" &&
+		r.AddPrefix == "" && len(r.Rename) == 0
+}
+
+func (r SyncRules) Validate() error {
+	for _, glob := range append(append([]string{}, r.Include...), r.Exclude...) {
+		if _, err := path.Match(glob, ""); err != nil || strings.Contains(glob, ",") {
+			return fmt.Errorf("invalid glob %q", glob)
+		}
+	}
+	for from, to := range r.Rename {
+		if from == "" || to == "" {
+			return fmt.Errorf("invalid rename %q=%q", from, to)
+		}
+	}
+	return nil
+}
+
+// Apply maps local values to the names they are pushed as. It returns the
+// renamed values, the mapping of every pushed key and the excluded keys,
+// and fails if two keys would be pushed under the same name.
+func (r SyncRules) Apply(values map[string]string) (map[string]string, []KeyMapping, []string, error) {
+	mapped := make(map[string]string, len(values))
+	mappings := make([]KeyMapping, 0, len(values))
+	var excluded []string
+	from := make(map[string]string, len(values))
+
+	for key, value := range values {
+		if !r.included(key) {
+			excluded = append(excluded, key)
+			continue
+		}
+		remote := r.remoteName(key)
+		if remote == "" {
+			return nil, nil, nil, fmt.Errorf("sync rules map %s to an empty name", key)
+		}
+		if other, ok := from[remote]; ok {
+			return nil, nil, nil, fmt.Errorf("sync rules map both %s and %s to %s", other, key, remote)
+		}
+		from[remote] = key
+		mapped[remote] = value
+		mappings = append(mappings, KeyMapping{Local: key, Remote: remote})
+	}
+	sort.Slice(mappings, func(i, j int) bool { return mappings[i].Local < mappings[j].Local })
+	sort.Strings(excluded)
+	return mapped, mappings, excluded, nil
+}
+
+func (r SyncRules) included(key string) bool {
+	if len(r.Include) > 0 && !matchAny(r.Include, key) {
+		return false
+	}
+	return !matchAny(r.Exclude, key)
+}
+
+func (r SyncRules) remoteName(key string) string {
+	if to, ok := r.Rename[key]; ok {
+		return to
+	}
+	return r.AddPrefix + strings.TrimPrefix(key, r.StripPrefix)
+}
+
+func matchAny(globs []string, key string) bool {
+	for _, glob := range globs {
+		if ok, _ := path.Match(glob, key); ok {
+			return true
+		}
+	}
+	return false
+}
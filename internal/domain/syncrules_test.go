@@ -0,0 +1,92 @@
+package domain
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSyncRulesApply(t *testing.T) {
+	values := map[string]string{
+		"API_KEY":   "k",
+		"API_DEBUG": "1",
+		"API_URL":   "u",
+		"DB_URL":    "d",
+	}
+	tests := []struct {
+		name     string
+		rules    SyncRules
+		mapped   map[string]string
+		excluded []string
+	}{
+		{"no rules", SyncRules{}, values, nil},
+		{"include", SyncRules{Include: []string{"API_*"}},
+			map[string]string{"API_KEY": "k", "API_DEBUG": "1", "API_URL": "u"}, []string{"DB_URL"}},
+		{"exclude wins over include", SyncRules{Include: []string{"API_*"}, Exclude: []string{"*_DEBUG"}},
+			map[string]string{"API_KEY": "k", "API_URL": "u"}, []string{"API_DEBUG", "DB_URL"}},
+		{"prefixes", SyncRules{Exclude: []string{"API_DEBUG"}, StripPrefix: "API_", AddPrefix: "APP_"},
+			map[string]string{"APP_KEY": "k", "APP_URL": "u", "APP_DB_URL": "d"}, []string{"API_DEBUG"}},
+		{"rename wins over prefixes", SyncRules{Include: []string{"API_KEY", "API_URL"}, StripPrefix: "API_", Rename: map[string]string{"API_KEY": "TOKEN"}},
+			map[string]string{"TOKEN": "k", "URL": "u"}, []string{"API_DEBUG", "DB_URL"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mapped, mappings, excluded, err := tt.rules.Apply(values)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !maps.Equal(mapped, tt.mapped) {
+				t.Errorf("mapped = %v, want %v", mapped, tt.mapped)
+			}
+			if !slices.Equal(excluded, tt.excluded) {
+				t.Errorf("excluded = %v, want %v", excluded, tt.excluded)
+			}
+			if !slices.IsSortedFunc(mappings, func(a, b KeyMapping) int { return strings.Compare(a.Local, b.Local) }) {
+				t.Errorf("mappings not sorted: %v", mappings)
+			}
+			for _, m := range mappings {
+				if mapped[m.Remote] != values[m.Local] {
+					t.Errorf("%s pushed as %s = %q, want %q", m.Local, m.Remote, mapped[m.Remote], values[m.Local])
+				}
+			}
+			if len(mappings) != len(mapped) {
+				t.Errorf("%d mappings for %d pushed keys", len(mappings), len(mapped))
+			}
+		})
+	}
+}
+
+func TestSyncRulesApplyRejectsCollisions(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules SyncRules
+		want  string
+	}{
+		{"rename onto a stripped name", SyncRules{StripPrefix: "API_", Rename: map[string]string{"TOKEN": "KEY"}}, "to KEY"},
+		{"two renames onto one name", SyncRules{Rename: map[string]string{"API_KEY": "X", "TOKEN": "X"}}, "to X"},
+		{"prefix stripped to nothing", SyncRules{StripPrefix: "TOKEN"}, "empty name"},
+	}
+	for _, tt := range tests {
+		_, _, _, err := tt.rules.Apply(map[string]string{"API_KEY": "1", "TOKEN": "2"})
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: Apply = %v, want an error mentioning %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestSyncRulesValidate(t *testing.T) {
+	valid := SyncRules{Include: []string{"API_*", "DB_?"}, Exclude: []string{"[AB]_X"}, Rename: map[string]string{"A": "B"}}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Validate = %v", err)
+	}
+	for _, r := range []SyncRules{
+		{Include: []string{"[A"}},
+		{Exclude: []string{"A,B"}},
+		{Rename: map[string]string{"A": ""}},
+	} {
+		if err := r.Validate(); err == nil {
+			t.Errorf("Validate(%+v) accepted invalid rules", r)
+		}
+	}
+}
@@ -0,0 +1,435 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SecretKind selects whether values are written as encrypted secrets or
+// as plain configuration variables.
+type SecretKind string
+
+const (
+	KindSecret   SecretKind = "secret"
+	KindVariable SecretKind = "variable"
+)
+
+func ParseSecretKind(s string) (SecretKind, error) {
+	switch k := SecretKind(s); k {
+	case KindSecret, KindVariable:
+		return k, nil
+	default:
+		return "", fmt.Errorf("invalid kind %q (valid: secret, variable)", s)
+	}
+}
+
+// Provider is the service a sync target lives on.
+type Provider string
+
+const (
+	ProviderGitHub Provider = "github"
+	ProviderGitLab Provider = "gitlab"
+	ProviderVault  Provider = "vault"
+	// ProviderFile and ProviderExec can only be pulled from.
+	ProviderFile Provider = "file"
+	ProviderExec Provider = "exec"
+)
+
+// SecretApp is the GitHub feature a secret belongs to.
+type SecretApp string
+
+const (
+	AppActions    SecretApp = "actions"
+	AppDependabot SecretApp = "dependabot"
+	AppCodespaces SecretApp = "codespaces"
+)
+
+// Visibility controls which repositories can use an organization secret.
+// VisibilitySelected is not accepted yet: GitHub would share such a
+// secret with no repositories until they are listed with it.
+type Visibility string
+
+const (
+	VisibilityAll      Visibility = "all"
+	VisibilityPrivate  Visibility = "private"
+	VisibilitySelected Visibility = "selected"
+)
+
+var errSelectedVisibility = fmt.Errorf("visibility %q is not supported yet; use all or private", VisibilitySelected)
+
+func ParseVisibility(s string) (Visibility, error) {
+	switch v := Visibility(s); v {
+	case VisibilityAll, VisibilityPrivate:
+		return v, nil
+	case VisibilitySelected:
+		return "", errSelectedVisibility
+	default:
+		return "", fmt.Errorf("invalid visibility %q (valid: all, private)", s)
+	}
+}
+
+// SyncTarget is where `autoenv sync` writes. A target without a Repo is
+// organization-wide, or for GitLab a group; a GitLab Owner is the full
+// namespace path and Environment the variables' environment scope. A
+// Vault Owner is the KV v2 mount and Repo the secret's path in it. A file
+// target's Repo is its path; an exec target's Owner is the plugin and Repo
+// the reference passed to it.
+type SyncTarget struct {
+	Provider    Provider
+	Host        string
+	Owner       string
+	Repo        string
+	Environment string
+	App         SecretApp
+	Kind        SecretKind
+	// Visibility applies to GitHub organization targets only.
+	Visibility Visibility
+	// Protected and Masked apply to GitLab variables only.
+	Protected bool
+	Masked    bool
+}
+
+// Hosts are the web hosts of the GitHub and GitLab instances autoenv
+// talks to. They decide which provider a target's host belongs to, so a
+// GitHub Enterprise host is not mistaken for a GitLab one.
+type Hosts struct {
+	GitHub string
+	GitLab string
+}
+
+// DefaultHosts are github.com and gitlab.com.
+var DefaultHosts = Hosts{GitHub: "github.com", GitLab: "gitlab.com"}
+
+// provider returns the provider serving host. github.com and gitlab.com
+// are always recognized, so targets naming them parse whatever is
+// configured and fail at sync time with a clearer message.
+func (h Hosts) provider(host string) (Provider, bool) {
+	switch host {
+	case h.GitHub, "github.com":
+		return ProviderGitHub, true
+	case h.GitLab, "gitlab.com":
+		return ProviderGitLab, true
+	}
+	return "", false
+}
+
+// ParseSyncTarget parses targets such as
+//
+//	github.com/org/repo              repository Actions secrets
+//	github.com/org/repo@env:prod     environment secrets
+//	github.com/org/repo@dependabot   Dependabot secrets (or @codespaces)
+//	github.com/org                   organization Actions secrets
+//	repo                             repository of the default owner
+//	gitlab.com/group/sub/project     GitLab project CI/CD variables
+//	gitlab.com/group/sub@group       GitLab group CI/CD variables
+//	vault://secret/data/myapp        Vault KV v2 secret myapp in mount secret
+//	file://secrets/dev.env           a local file, relative to the project
+//	exec://op/vaults/dev/items/api   the output of the autoenv-source-op plugin
+//
+// A bare name is a repository whose Owner is left empty for the caller to
+// fill in. A host is GitHub or GitLab according to hosts, and a host that
+// is neither is an error. Kind defaults to secrets on GitHub and Vault and
+// variables on GitLab.
+func ParseSyncTarget(spec string, hosts Hosts) (SyncTarget, error) {
+	if path, ok := strings.CutPrefix(spec, "vault://"); ok {
+		return parseVaultTarget(spec, path)
+	}
+	if path, ok := strings.CutPrefix(spec, "file://"); ok {
+		if path == "" {
+			return SyncTarget{}, fmt.Errorf("invalid target %q: expected file://<path>", spec)
+		}
+		return SyncTarget{Provider: ProviderFile, Kind: KindSecret, Repo: path}, nil
+	}
+	if path, ok := strings.CutPrefix(spec, "exec://"); ok {
+		return parseExecTarget(spec, path)
+	}
+	path, mods, _ := strings.Cut(spec, "@")
+	t := SyncTarget{Provider: ProviderGitHub, Host: hosts.GitHub, App: AppActions, Kind: KindSecret}
+	full := false
+	if host, rest, ok := strings.Cut(path, "/"); ok && strings.Contains(host, ".") {
+		provider, known := hosts.provider(host)
+		switch {
+		case !known:
+			return t, fmt.Errorf("invalid target %q: %s is neither the GitHub host (%s) nor the GitLab host (%s); set AUTOENV_GITHUB_API_URL or AUTOENV_GITLAB_URL to use it", spec, host, hosts.GitHub, hosts.GitLab)
+		case provider == ProviderGitLab:
+			return parseGitLabTarget(spec, host, rest, mods)
+		}
+		t.Host, path, full = host, rest, true
+	}
+	path = strings.Trim(path, "/")
+	owner, repo, hasRepo := strings.Cut(path, "/")
+	switch {
+	case path == "":
+		return t, fmt.Errorf("invalid target %q", spec)
+	case hasRepo:
+		t.Owner, t.Repo = owner, repo
+	case full:
+		t.Owner = owner
+	default:
+		t.Repo = owner
+	}
+	if strings.Contains(t.Repo, "/") {
+		return t, fmt.Errorf("invalid target %q: expected %s/owner/repo", spec, t.Host)
+	}
+
+	if mods != "" {
+		for _, mod := range strings.Split(mods, "@") {
+			switch {
+			case strings.HasPrefix(mod, "env:") && len(mod) > len("env:"):
+				t.Environment = strings.TrimPrefix(mod, "env:")
+			case mod == string(AppActions), mod == string(AppDependabot), mod == string(AppCodespaces):
+				t.App = SecretApp(mod)
+			default:
+				return t, fmt.Errorf("invalid target %q: unknown qualifier @%s (valid: @env:<name>, @actions, @dependabot, @codespaces)", spec, mod)
+			}
+		}
+	}
+	return t, nil
+}
+
+func parseGitLabTarget(spec, host, path, mods string) (SyncTarget, error) {
+	t := SyncTarget{Provider: ProviderGitLab, Host: host, Kind: KindVariable}
+	path = strings.Trim(path, "/")
+	if path == "" || strings.Contains(path, "//") {
+		return t, fmt.Errorf("invalid target %q", spec)
+	}
+
+	group := false
+	if mods != "" {
+		for _, mod := range strings.Split(mods, "@") {
+			switch {
+			case strings.HasPrefix(mod, "env:") && len(mod) > len("env:"):
+				// "*", every environment, is GitLab's default scope.
+				if scope := strings.TrimPrefix(mod, "env:"); scope != "*" {
+					t.Environment = scope
+				}
+			case mod == "group":
+				group = true
+			default:
+				return t, fmt.Errorf("invalid target %q: unknown qualifier @%s (valid: @env:<scope>, @group)", spec, mod)
+			}
+		}
+	}
+
+	// Projects always live in a namespace, so a single segment is a group.
+	if i := strings.LastIndex(path, "/"); i >= 0 && !group {
+		t.Owner, t.Repo = path[:i], path[i+1:]
+	} else {
+		t.Owner = path
+	}
+	return t, nil
+}
+
+// parseVaultTarget splits a KV v2 path at its /data/ segment, which
+// separates the mount from the secret's path. Without one, the first
+// segment is the mount, as with `vault kv put`.
+func parseVaultTarget(spec, path string) (SyncTarget, error) {
+	t := SyncTarget{Provider: ProviderVault, Kind: KindSecret}
+	path = strings.Trim(path, "/")
+	if strings.ContainsAny(path, "@") || strings.Contains(path, "//") {
+		return t, fmt.Errorf("invalid target %q: expected vault://<mount>/data/<path>", spec)
+	}
+	mount, secret, ok := strings.Cut(path, "/data/")
+	if !ok {
+		mount, secret, _ = strings.Cut(path, "/")
+	}
+	if mount == "" || secret == "" {
+		return t, fmt.Errorf("invalid target %q: expected vault://<mount>/data/<path>", spec)
+	}
+	t.Owner, t.Repo = mount, secret
+	return t, nil
+}
+
+// parseExecTarget splits a plugin name from the reference handed to it.
+func parseExecTarget(spec, path string) (SyncTarget, error) {
+	t := SyncTarget{Provider: ProviderExec, Kind: KindSecret}
+	t.Owner, t.Repo, _ = strings.Cut(path, "/")
+	if t.Owner == "" || strings.Trim(t.Owner, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_") != "" {
+		return t, fmt.Errorf("invalid target %q: expected exec://<plugin>[/<reference>] with a plugin name of letters, digits, - and _", spec)
+	}
+	return t, nil
+}
+
+// IsOrg reports whether the target is an organization rather than a
+// repository.
+func (t SyncTarget) IsOrg() bool {
+	return t.Repo == ""
+}
+
+// PullOnly reports whether the target can be pulled from but not synced
+// to.
+func (t SyncTarget) PullOnly() bool {
+	return t.Provider == ProviderFile || t.Provider == ProviderExec
+}
+
+// Validate rejects combinations the target's provider does not support.
+func (t SyncTarget) Validate() error {
+	switch t.Provider {
+	case ProviderVault, ProviderFile, ProviderExec:
+		if t.Kind != KindSecret {
+			return fmt.Errorf("--kind does not apply to %s targets", t.Provider)
+		}
+		if t.Environment != "" || t.Visibility != "" || t.Protected || t.Masked {
+			return fmt.Errorf("environments, visibility, --protected and --masked do not apply to %s targets", t.Provider)
+		}
+		return nil
+	}
+	if t.Provider == ProviderGitLab {
+		if t.Kind != KindVariable {
+			return fmt.Errorf("GitLab has CI/CD variables only; use --masked to hide values in job logs")
+		}
+		if t.Visibility != "" {
+			return fmt.Errorf("visibility only applies to GitHub organization targets")
+		}
+		return nil
+	}
+	if t.Protected || t.Masked {
+		return fmt.Errorf("--protected and --masked only apply to GitLab targets")
+	}
+	if t.Environment != "" && (t.IsOrg() || t.App != AppActions) {
+		return fmt.Errorf("environments are only available for repository Actions secrets and variables")
+	}
+	if t.Kind == KindVariable && t.App != AppActions {
+		return fmt.Errorf("%s has no variables; use --kind secret", t.App)
+	}
+	if t.Visibility != "" && !t.IsOrg() {
+		return fmt.Errorf("visibility only applies to organization targets")
+	}
+	if t.Visibility == VisibilitySelected {
+		return errSelectedVisibility
+	}
+	return nil
+}
+
+func (t SyncTarget) String() string {
+	switch t.Provider {
+	case ProviderVault:
+		return "vault://" + t.Owner + "/data/" + t.Repo
+	case ProviderFile:
+		return "file://" + t.Repo
+	case ProviderExec:
+		if t.Repo == "" {
+			return "exec://" + t.Owner
+		}
+		return "exec://" + t.Owner + "/" + t.Repo
+	}
+	if t.Provider == ProviderGitLab {
+		s := t.Host + "/" + t.Owner
+		switch {
+		case !t.IsOrg():
+			s += "/" + t.Repo
+		case strings.Contains(t.Owner, "/"):
+			s += "@group"
+		}
+		if t.Environment != "" {
+			s += "@env:" + t.Environment
+		}
+		return s
+	}
+
+	host := t.Host
+	if host == "" {
+		host = "github.com"
+	}
+	s := host + "/" + t.Owner
+	if !t.IsOrg() {
+		s += "/" + t.Repo
+	}
+	if t.Environment != "" {
+		s += "@env:" + t.Environment
+	}
+	if t.App != "" && t.App != AppActions {
+		s += "@" + string(t.App)
+	}
+	return s
+}
+
+// ID identifies the target and kind together, since a GitHub secret and
+// variable of the same name are separate values.
+func (t SyncTarget) ID() string {
+	if t.Kind == KindVariable && t.Provider != ProviderGitLab {
+		return t.String() + "#variables"
+	}
+	return t.String()
+}
+
+// NamedSyncTarget is a sync target saved on a project under a short name,
+// so `autoenv sync` needs no arguments. Target is the target string as
+// given, possibly a bare repository resolved against the default owner at
+// sync time; empty fields leave the defaults in place.
+type NamedSyncTarget struct {
+	Name        string
+	Target      string
+	Environment string
+	Kind        SecretKind
+	Visibility  Visibility
+	Protected   bool
+	Masked      bool
+}
+
+// ValidateTargetName rejects names that could be mistaken for a target.
+func ValidateTargetName(name string) error {
+	if name == "" || strings.ContainsAny(name, "/@:, \t\n") {
+		return fmt.Errorf("invalid target name %q: names must be non-empty and contain no /, @, :, commas or whitespace", name)
+	}
+	return nil
+}
+
+// SyncTarget parses Target against hosts and applies the saved options.
+// The owner of a bare repository name is left empty.
+func (n NamedSyncTarget) SyncTarget(hosts Hosts) (SyncTarget, error) {
+	t, err := ParseSyncTarget(n.Target, hosts)
+	if err != nil {
+		return t, err
+	}
+	if n.Kind != "" {
+		t.Kind = n.Kind
+	}
+	if n.Environment != "" {
+		if t.Environment != "" && t.Environment != n.Environment {
+			return t, fmt.Errorf("target names environment %q but --environment is %q", t.Environment, n.Environment)
+		}
+		t.Environment = n.Environment
+	}
+	t.Visibility = n.Visibility
+	if t.Provider == ProviderGitHub && t.IsOrg() && t.Visibility == "" {
+		t.Visibility = VisibilityPrivate
+	}
+	t.Protected, t.Masked = n.Protected, n.Masked
+	return t, t.Validate()
+}
+
+// KeyOutcome is what happened to one key during a sync.
+type KeyOutcome string
+
+const (
+	KeyOK      KeyOutcome = "ok"
+	KeyFailed  KeyOutcome = "failed"
+	KeySkipped KeyOutcome = "skipped"
+)
+
+// KeyResult is the outcome of pushing or deleting one key. Err is set for
+// failed keys.
+type KeyResult struct {
+	Key     string
+	Outcome KeyOutcome
+	Err     error
+}
+
+func CountOutcomes(results []KeyResult, outcome KeyOutcome) int {
+	n := 0
+	for _, r := range results {
+		if r.Outcome == outcome {
+			n++
+		}
+	}
+	return n
+}
+
+// SyncLedgerEntry records the hash of the value last pushed for a key and
+// when it was pushed.
+type SyncLedgerEntry struct {
+	Key      string
+	Hash     string
+	PushedAt string
+}
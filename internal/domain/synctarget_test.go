@@ -0,0 +1,63 @@
+package domain
+
+import "testing"
+
+func TestParseSyncTargetProviderFollowsHosts(t *testing.T) {
+	enterprise := Hosts{GitHub: "ghe.example.com", GitLab: "gitlab.example.com"}
+	tests := []struct {
+		spec     string
+		hosts    Hosts
+		provider Provider
+		host     string
+		want     string
+	}{
+		{"github.com/acme/api", DefaultHosts, ProviderGitHub, "github.com", "github.com/acme/api"},
+		{"acme/api", DefaultHosts, ProviderGitHub, "github.com", "github.com/acme/api"},
+		{"gitlab.com/acme/backend/api", DefaultHosts, ProviderGitLab, "gitlab.com", "gitlab.com/acme/backend/api"},
+		{"ghe.example.com/acme/api@env:prod", enterprise, ProviderGitHub, "ghe.example.com", "ghe.example.com/acme/api@env:prod"},
+		{"ghe.example.com/acme", enterprise, ProviderGitHub, "ghe.example.com", "ghe.example.com/acme"},
+		{"acme/api", enterprise, ProviderGitHub, "ghe.example.com", "ghe.example.com/acme/api"},
+		{"gitlab.example.com/acme/api", enterprise, ProviderGitLab, "gitlab.example.com", "gitlab.example.com/acme/api"},
+		// The public hosts parse under any configuration; sync then
+		// reports that they are not the configured instance.
+		{"github.com/acme/api", enterprise, ProviderGitHub, "github.com", "github.com/acme/api"},
+		{"gitlab.com/acme/api", enterprise, ProviderGitLab, "gitlab.com", "gitlab.com/acme/api"},
+	}
+	for _, tt := range tests {
+		got, err := ParseSyncTarget(tt.spec, tt.hosts)
+		if err != nil {
+			t.Errorf("ParseSyncTarget(%q, %v): %v", tt.spec, tt.hosts, err)
+			continue
+		}
+		if got.Provider != tt.provider || got.Host != tt.host || got.String() != tt.want {
+			t.Errorf("ParseSyncTarget(%q, %v) = %s on %s (%s), want %s on %s (%s)",
+				tt.spec, tt.hosts, got.Provider, got.Host, got, tt.provider, tt.host, tt.want)
+		}
+	}
+}
+
+func TestParseSyncTargetRejectsUnknownHosts(t *testing.T) {
+	for _, spec := range []string{"ghe.example.com/acme/api", "git.example.org/acme/api@env:prod"} {
+		if got, err := ParseSyncTarget(spec, DefaultHosts); err == nil {
+			t.Errorf("ParseSyncTarget(%q) = %s on %s, want an error", spec, got.Provider, got.Host)
+		}
+	}
+}
+
+// GitHub shares a selected-visibility secret with no repositories until
+// they are listed with it, so neither the flag nor a saved target may
+// ask for it.
+func TestSelectedVisibilityIsRejected(t *testing.T) {
+	if _, err := ParseVisibility("selected"); err == nil {
+		t.Error("ParseVisibility accepted selected")
+	}
+	saved := NamedSyncTarget{Name: "org", Target: "acme", Kind: KindSecret, Visibility: VisibilitySelected}
+	if _, err := saved.SyncTarget(DefaultHosts); err == nil {
+		t.Error("a saved target with selected visibility was accepted")
+	}
+	for _, s := range []string{"all", "private"} {
+		if _, err := ParseVisibility(s); err != nil {
+			t.Errorf("ParseVisibility(%q): %v", s, err)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+package port
+
+import "github.com/stormingluke/autoenv/internal/domain"
+
+// DatabaseSyncer replicates the project registry with its remote.
+type DatabaseSyncer interface {
+	Sync() (domain.Replication, error)
+}
+
+// SyncLog keeps the history of database syncs on this machine.
+type SyncLog interface {
+	Record(rec domain.DBSyncRecord) error
+	Recent(limit int) ([]domain.DBSyncRecord, error)
+	LastSuccess() (*domain.DBSyncRecord, error)
+}
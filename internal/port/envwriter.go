@@ -0,0 +1,5 @@
+package port
+
+type EnvWriter interface {
+	Merge(projectPath string, values map[string]string) error
+}
@@ -0,0 +1,9 @@
+package port
+
+type EnvFormatter interface {
+	Format(vars map[string]string) (string, error)
+}
+
+type EnvParser interface {
+	Parse(data []byte) (map[string]string, error)
+}
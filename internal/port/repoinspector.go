@@ -0,0 +1,10 @@
+package port
+
+type RepoInspector interface {
+	// Root returns the working tree root containing dir, or "" when dir
+	// is not inside a git repository.
+	Root(dir string) (string, error)
+	// RemoteURL returns the fetch URL of the origin remote (or the first
+	// remote when there is no origin), or "" when there is none.
+	RemoteURL(dir string) (string, error)
+}
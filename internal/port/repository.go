@@ -6,11 +6,25 @@ type ProjectReader interface {
 	MatchCurrent(dir string) (*domain.Project, error)
 	ListAll() ([]domain.Project, error)
 	FindByPath(path string) (*domain.Project, error)
+	FindByName(name string) (*domain.Project, error)
+	FindByID(id int) (*domain.Project, error)
+	SyncRules(id int) (domain.SyncRules, error)
+	SyncTargets(id int) ([]domain.NamedSyncTarget, error)
 }
 
 type ProjectWriter interface {
-	Upsert(path, name string) error
-	Delete(path string) error
+	Upsert(path, name, remoteURL string) error
+	Rename(id int, name string) error
+	Relocate(id int, path string) error
+	SetFingerprint(id int, fingerprint string) error
+	RemoveLocation(id int) error
+	SetDescription(id int, description string) error
+	AddTags(id int, tags []string) error
+	RemoveTags(id int, tags []string) error
+	SetSyncRules(id int, rules domain.SyncRules) error
+	SaveSyncTarget(id int, target domain.NamedSyncTarget) error
+	RemoveSyncTarget(id int, name string) error
+	Delete(id int) error
 }
 
 type ProjectRepository interface {
@@ -20,8 +34,15 @@ type ProjectRepository interface {
 
 type SessionRepository interface {
 	Get(shellPID int) (*domain.Session, error)
-	Upsert(shellPID int, projectPath string, envFileMtime int64) error
+	Upsert(shellPID int, projectPath string, envFileMtime int64, pulled bool) error
 	Delete(shellPID int) error
 	GetKeys(shellPID int) ([]domain.SessionKey, error)
 	SetKeys(shellPID int, keys map[string]string) error
 }
+
+// UsageRepository records when each project directory was last loaded on
+// this machine. It lives next to the sessions and is never synced.
+type UsageRepository interface {
+	Touch(projectPath string) error
+	LastUsed() (map[string]string, error)
+}
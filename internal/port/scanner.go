@@ -0,0 +1,7 @@
+package port
+
+type ProjectScanner interface {
+	// FindEnvDirs returns every directory below root that contains a .env
+	// file, descending at most maxDepth levels (0 for no limit).
+	FindEnvDirs(root string, maxDepth int) ([]string, error)
+}
@@ -1,5 +1,34 @@
 package port
 
+import (
+	"context"
+
+	"github.com/stormingluke/autoenv/internal/domain"
+)
+
 type SecretSyncer interface {
-	Sync(repo string, secrets map[string]string) error
+	// List returns the names present on the target. Secret values cannot
+	// be read back.
+	List(ctx context.Context, target domain.SyncTarget) ([]string, error)
+	// Sync and Delete report the outcome of every key. Their error is for
+	// the run as a whole: nothing could be attempted, or ctx was cancelled
+	// and the remaining keys were skipped.
+	Sync(ctx context.Context, target domain.SyncTarget, values map[string]string) ([]domain.KeyResult, error)
+	Delete(ctx context.Context, target domain.SyncTarget, names []string) ([]domain.KeyResult, error)
+}
+
+// SecretSource reads values back from a target that can return them.
+type SecretSource interface {
+	Fetch(ctx context.Context, target domain.SyncTarget) (map[string]string, error)
+}
+
+// SyncLedger remembers, per project and target (by SyncTarget.ID), the
+// hash of each value last pushed or pulled, so unchanged keys need not be
+// pushed again, stale targets can be reported and a pull can tell values
+// edited locally from ones it may update.
+type SyncLedger interface {
+	Targets(project string) ([]string, error)
+	Entries(project, target string) (map[string]domain.SyncLedgerEntry, error)
+	Record(project, target string, hashes map[string]string) error
+	Forget(project, target string, keys []string) error
 }